@@ -2,29 +2,113 @@ package commands
 
 import (
 	"context"
+	"encoding/json"
+	"flag"
 	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
 
-	"github.com/DataDog/btfhub/pkg/utils"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/DataDog/btfhub/pkg/store"
 )
 
-func ACL(ctx context.Context) error {
-	if s3bucket == "" {
-		return fmt.Errorf("s3bucket is required")
+// aclDiff is an object whose ACL differs from the desired one
+type aclDiff struct {
+	Key      string    `json:"key"`
+	Actual   store.ACL `json:"actual"`
+	Expected store.ACL `json:"expected"`
+}
+
+// ACL applies the -acl ACL to the objects of the store which have a different
+// ACL, and reports them
+func ACL(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("acl", flag.ExitOnError)
+	output := flags.String("output", "table", "report format (table,json)")
+	concurrency := flags.Int("concurrency", 16, "number of objects to check concurrently")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *output != "table" && *output != "json" {
+		return fmt.Errorf("invalid output format %s", *output)
+	}
+
+	st, err := openStore(ctx)
+	if err != nil {
+		return err
 	}
-	if s3prefix == "" {
+	if st == nil {
+		return fmt.Errorf("-store or -s3-bucket is required")
+	}
+	if storeURL == "" && s3prefix == "" {
 		return fmt.Errorf("s3prefix is required")
 	}
+	_, expected, err := selectedStore()
+	if err != nil {
+		return err
+	}
+	if expected == store.ACLNone {
+		return fmt.Errorf("-acl %s leaves ACLs unchanged", store.ACLNone)
+	}
 
-	keys, err := utils.S3List(ctx, s3bucket, s3prefix)
+	keys, err := st.List(ctx, "")
 	if err != nil {
 		return err
 	}
 
+	var mu sync.Mutex
+	diffs := []aclDiff{}
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(*concurrency)
 	for _, key := range keys {
-		err = utils.S3PutACL(ctx, s3bucket, key)
-		if err != nil {
+		g.Go(func() error {
+			actual, err := st.ACL(gctx, key)
+			if err != nil {
+				return err
+			}
+			if actual == expected {
+				return nil
+			}
+			mu.Lock()
+			diffs = append(diffs, aclDiff{Key: key, Actual: actual, Expected: expected})
+			mu.Unlock()
+
+			if dryRun {
+				return nil
+			}
+			return st.SetACL(gctx, key)
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return err
+	}
+	slices.SortFunc(diffs, func(a, b aclDiff) int { return strings.Compare(a.Key, b.Key) })
+
+	if *output == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(diffs); err != nil {
+			return err
+		}
+	} else {
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(tw, "KEY\tACTUAL\tEXPECTED")
+		for _, d := range diffs {
+			_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\n", d.Key, d.Actual, d.Expected)
+		}
+		if err := tw.Flush(); err != nil {
 			return err
 		}
 	}
+
+	action := "updated"
+	if dryRun {
+		action = "would update"
+	}
+	log.Printf("%s the ACL of %d of %d objects\n", action, len(diffs), len(keys))
 	return nil
 }
@@ -1,29 +1,50 @@
 package commands
 
-import "flag"
+import (
+	"flag"
 
-var distroArg, releaseArg, archArg, queryArg, s3bucket, s3prefix, hashDir, catalogJSONPath string
+	"github.com/DataDog/btfhub/pkg/job"
+	"github.com/DataDog/btfhub/pkg/store"
+)
+
+var distroArg, releaseArg, archArg, queryArg, formatArg, storeURL, s3bucket, s3prefix, objectACL, mergerArg, hashDir, catalogJSONPath, configPath string
+var s3Options store.S3Options
 var numWorkers int
-var force, kernelModules, ordered, dryRun, launchpad bool
+var force, kernelModules, ordered, dryRun, launchpad, retryFailed, objectMetadata, objectTags, contentAddressed bool
 
 func init() {
-	flag.StringVar(&distroArg, "distro", "", "distribution to update (ubuntu,debian,centos,fedora,ol,rhel,amazon,sles)")
-	flag.StringVar(&distroArg, "d", "", "distribution to update (ubuntu,debian,centos,fedora,ol,rhel,amazon,sles)")
+	flag.StringVar(&distroArg, "distro", "", "distribution to update (ubuntu,debian,centos,fedora,ol,rhel,amzn,sles,opensuse-leap)")
+	flag.StringVar(&distroArg, "d", "", "distribution to update (ubuntu,debian,centos,fedora,ol,rhel,amzn,sles,opensuse-leap)")
 	flag.StringVar(&releaseArg, "release", "", "distribution release to update, requires specifying distribution")
 	flag.StringVar(&releaseArg, "r", "", "distribution release to update, requires specifying distribution")
-	flag.StringVar(&archArg, "arch", "", "architecture to update (x86_64,arm64)")
-	flag.StringVar(&archArg, "a", "", "architecture to update (x86_64,arm64)")
+	flag.StringVar(&archArg, "arch", "", "architecture to update (x86_64,arm64,...)")
+	flag.StringVar(&archArg, "a", "", "architecture to update (x86_64,arm64,...)")
 	flag.StringVar(&queryArg, "query", "", "regexp query to filter kernel versions")
 	flag.StringVar(&queryArg, "q", "", "regexp query to filter kernel versions")
 	flag.IntVar(&numWorkers, "workers", 0, "number of concurrent workers (defaults to runtime.NumCPU() - 1)")
 	flag.IntVar(&numWorkers, "j", 0, "number of concurrent workers (defaults to runtime.NumCPU() - 1)")
 	flag.BoolVar(&force, "f", false, "force update regardless of existing files (defaults to false)")
+	flag.BoolVar(&retryFailed, "retry-failed", false, "retry failed packages regardless of the retry policies (defaults to false)")
 	flag.BoolVar(&kernelModules, "kmod", true, "generate BTF for kernel modules, in addition to the base kernel (defaults to true)")
 	flag.BoolVar(&ordered, "ordered", true, "process kernels in order so future kernels can be skipped once BTF is detected")
-	flag.BoolVar(&dryRun, "dry-run", false, "do not make changes")
+	flag.BoolVar(&dryRun, "dry-run", false, "do not make changes, log what would be done (see the plan command for a report)")
 	flag.BoolVar(&launchpad, "launchpad", false, "query Ubuntu Launchpad for additional kernels")
-	flag.StringVar(&s3bucket, "s3-bucket", "", "AWS S3 bucket where new BTFs will be uploaded")
-	flag.StringVar(&s3prefix, "s3-prefix", "", "Key prefix to use when uploading BTFs")
+	flag.StringVar(&storeURL, "store", "", "object store where new BTFs will be uploaded (s3://bucket/prefix, gs://bucket/prefix, azblob://container/prefix, file:///path)")
+	flag.StringVar(&s3bucket, "s3-bucket", "", "AWS S3 bucket where new BTFs will be uploaded, same as -store s3://bucket")
+	flag.StringVar(&s3prefix, "s3-prefix", "", "Key prefix to use when uploading BTFs to -s3-bucket")
+	flag.StringVar(&objectACL, "acl", "", "ACL of uploaded objects (none,private,public-read,bucket-owner-full-control), none for buckets with ACLs disabled (defaults to public-read for s3 and gs, none for azblob and file)")
+	flag.BoolVar(&objectMetadata, "object-metadata", false, "store the distro, kernel version and sha256 of uploaded objects as metadata")
+	flag.BoolVar(&objectTags, "object-tags", false, "store the distro, kernel version and sha256 of uploaded objects as tags")
+	flag.StringVar(&s3Options.Endpoint, "s3-endpoint", "", "URL of an S3 compatible API, such as MinIO or Ceph, instead of AWS")
+	flag.StringVar(&s3Options.Region, "s3-region", "", "S3 region, overriding the AWS configuration")
+	flag.BoolVar(&s3Options.PathStyle, "s3-path-style", false, "use path-style S3 addressing, usually required by S3 compatible stores")
+	flag.StringVar(&s3Options.CABundle, "s3-ca-bundle", "", "PEM file with the CA certificates to trust for the S3 endpoint")
+	flag.StringVar(&s3Options.AccessKeyID, "s3-access-key-id", "", "static S3 access key ID, instead of the AWS credential chain")
+	flag.StringVar(&s3Options.SecretAccessKey, "s3-secret-access-key", "", "static S3 secret access key, defaults to $BTFHUB_S3_SECRET_ACCESS_KEY")
+	flag.BoolVar(&contentAddressed, "content-addressed", false, "store an archive per distinct BTF under blobs/, keyed by the hash of the BTF, and a .btf.ptr pointer file per kernel version")
+	flag.StringVar(&formatArg, "format", "xz", "format of generated archives (xz,zst,both), or a list whose first format is the one of catalog entries and the others are their variants")
+	flag.StringVar(&mergerArg, "merger", string(job.MergerBpftool), "tool which merges the BTF of kernel modules (bpftool,go), go does not require bpftool but its archives are not byte-identical to the published ones")
 	flag.StringVar(&hashDir, "hash-dir", "", "directory to store/read hash files")
 	flag.StringVar(&catalogJSONPath, "catalog-json", "", "path to catalog JSON file")
+	flag.StringVar(&configPath, "config", "", "path to YAML or JSON distro configuration file (defaults to built-in configuration)")
 }
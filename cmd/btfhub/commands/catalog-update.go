@@ -2,10 +2,16 @@ package commands
 
 import (
 	"context"
+	"flag"
 
 	"github.com/DataDog/btfhub/pkg/catalog"
 )
 
-func CatalogUpdate(ctx context.Context) error {
-	return catalog.Update(ctx, hashDir, catalogJSONPath)
+func CatalogUpdate(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("catalog-update", flag.ExitOnError)
+	replace := fs.Bool("replace", false, "replace catalog hashes which differ from the hash files, such as archives repacked by check -fix")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	return catalog.Update(ctx, hashDir, catalogJSONPath, *replace)
 }
@@ -0,0 +1,380 @@
+package commands
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/DataDog/btfhub/pkg/catalog"
+)
+
+const (
+	// signingKeyEnv is the base64 private key of catalog sign, if -key is not
+	// set
+	signingKeyEnv = "BTFHUB_SIGNING_KEY"
+	// trustedKeysEnv are the comma separated base64 public keys of catalog
+	// verify, if -pubkey is not set
+	trustedKeysEnv = "BTFHUB_TRUSTED_KEYS"
+)
+
+// Catalog runs the catalog subcommands
+func Catalog(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("catalog: missing subcommand (migrate,merge,diff,sign,verify,keygen)")
+	}
+	switch args[0] {
+	case "migrate":
+		return CatalogMigrate(ctx, args[1:])
+	case "merge":
+		return CatalogMerge(ctx, args[1:])
+	case "diff":
+		return CatalogDiff(ctx, args[1:])
+	case "sign":
+		return CatalogSign(ctx, args[1:])
+	case "verify":
+		return CatalogVerify(ctx, args[1:])
+	case "keygen":
+		return CatalogKeygen(ctx, args[1:])
+	default:
+		return fmt.Errorf("catalog: unknown subcommand %s", args[0])
+	}
+}
+
+// parseInterleaved parses flags which may follow the positional arguments,
+// and returns the positional arguments
+func parseInterleaved(flags *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
+		if flags.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, flags.Arg(0))
+		args = flags.Args()[1:]
+	}
+}
+
+// catalogArg returns the catalog file given as the only positional argument,
+// or -catalog-json
+func catalogArg(args []string) (string, error) {
+	switch len(args) {
+	case 0:
+		if catalogJSONPath == "" {
+			return "", fmt.Errorf("--catalog-json must be set")
+		}
+		return catalogJSONPath, nil
+	case 1:
+		return args[0], nil
+	default:
+		return "", fmt.Errorf("expected one catalog, got %d", len(args))
+	}
+}
+
+// CatalogMigrate rewrites catalog files, or -catalog-json if none are given,
+// in the latest schema version
+func CatalogMigrate(_ context.Context, args []string) error {
+	paths := args
+	if len(paths) == 0 {
+		if catalogJSONPath == "" {
+			return fmt.Errorf("--catalog-json must be set")
+		}
+		paths = []string{catalogJSONPath}
+	}
+	for _, p := range paths {
+		if dryRun {
+			log.Printf("DRY-RUN: would migrate %s to schema version %d\n", p, catalog.SchemaVersion)
+			continue
+		}
+		version, err := catalog.Migrate(p)
+		if err != nil {
+			return err
+		}
+		log.Printf("migrated %s from schema version %d to %d\n", p, version, catalog.SchemaVersion)
+	}
+	return nil
+}
+
+// CatalogMerge merges catalog files and hash directories into the -o catalog,
+// so sharded runs can each write their own catalog or hash directory. The
+// output is not written if entries conflict, and the conflicts are reported.
+func CatalogMerge(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("catalog merge", flag.ExitOnError)
+	out := flags.String("o", "", "merged catalog file (default -catalog-json)")
+	output := flags.String("output", "table", "conflict report format (table,json)")
+	sources, err := parseInterleaved(flags, args)
+	if err != nil {
+		return err
+	}
+	if *output != "table" && *output != "json" {
+		return fmt.Errorf("invalid output format %s", *output)
+	}
+	if len(sources) == 0 {
+		return fmt.Errorf("catalog merge: no catalogs or hash directories")
+	}
+	if *out == "" {
+		*out = catalogJSONPath
+	}
+	if *out == "" {
+		return fmt.Errorf("-o or --catalog-json must be set")
+	}
+
+	merged, conflicts, err := catalog.MergeFiles(ctx, sources)
+	if err != nil {
+		return err
+	}
+	if len(conflicts) > 0 {
+		if *output == "json" {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(conflicts); err != nil {
+				return err
+			}
+		} else {
+			tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			_, _ = fmt.Fprintln(tw, "ARCH\tDISTRO\tRELEASE\tVERSION\tSHA256\tCONFLICTING SHA256\tSOURCE")
+			for _, c := range conflicts {
+				version := c.Version
+				if c.Format != "" {
+					version += " (" + c.Format + ")"
+				}
+				_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", c.Arch, c.Distro, c.Release, version, c.SHA256, c.ConflictingSHA256, c.Source)
+			}
+			if err := tw.Flush(); err != nil {
+				return err
+			}
+		}
+		return fmt.Errorf("%d conflicting entries, %s not written", len(conflicts), *out)
+	}
+
+	if dryRun {
+		log.Printf("DRY-RUN: would merge %d sources into %s\n", len(sources), *out)
+		return nil
+	}
+	if err := catalog.Write(*out, merged); err != nil {
+		return err
+	}
+	log.Printf("merged %d sources into %s\n", len(sources), *out)
+	return nil
+}
+
+// CatalogDiff prints the entries added, removed and changed between two
+// catalogs, grouped by arch, distro and release
+func CatalogDiff(_ context.Context, args []string) error {
+	flags := flag.NewFlagSet("catalog diff", flag.ExitOnError)
+	output := flags.String("output", "text", "output format (text,json)")
+	args, err := parseInterleaved(flags, args)
+	if err != nil {
+		return err
+	}
+	if *output != "text" && *output != "json" {
+		return fmt.Errorf("invalid output format %s", *output)
+	}
+	if len(args) != 2 {
+		return fmt.Errorf("usage: catalog diff old.json new.json")
+	}
+	before, err := catalog.Read(args[0])
+	if err != nil {
+		return fmt.Errorf("%s: %w", args[0], err)
+	}
+	after, err := catalog.Read(args[1])
+	if err != nil {
+		return fmt.Errorf("%s: %w", args[1], err)
+	}
+
+	groups := catalog.Diff(before, after)
+	if *output == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(groups)
+	}
+	printCatalogDiff(groups)
+	return nil
+}
+
+// printCatalogDiff prints a summary line per group and a line per change,
+// prefixed with + for added, - for removed and ~ for changed entries
+func printCatalogDiff(groups []catalog.DiffGroup) {
+	var added, removed, changed int
+	for _, g := range groups {
+		added += g.Added
+		removed += g.Removed
+		changed += g.Changed
+	}
+	fmt.Printf("%d added, %d removed, %d changed in %d releases\n", added, removed, changed, len(groups))
+	for _, g := range groups {
+		fmt.Printf("\n%s/%s/%s: %d added, %d removed, %d changed\n", g.Arch, g.Distro, g.Release, g.Added, g.Removed, g.Changed)
+		for _, c := range g.Changes {
+			switch c.Kind {
+			case catalog.ChangeAdded:
+				fmt.Printf("+ %s %s\n", c.Version, c.New.SHA256)
+			case catalog.ChangeRemoved:
+				fmt.Printf("- %s %s\n", c.Version, c.Old.SHA256)
+			default:
+				if c.Old.SHA256 != c.New.SHA256 {
+					fmt.Printf("~ %s %s -> %s\n", c.Version, c.Old.SHA256, c.New.SHA256)
+				} else {
+					fmt.Printf("~ %s %s (metadata)\n", c.Version, c.New.SHA256)
+				}
+			}
+		}
+	}
+}
+
+// CatalogSign adds a detached signature of a catalog, by the key in -key or
+// $BTFHUB_SIGNING_KEY, to its signature file. An existing signature of the
+// same key is replaced.
+func CatalogSign(_ context.Context, args []string) error {
+	flags := flag.NewFlagSet("catalog sign", flag.ExitOnError)
+	keyPath := flags.String("key", "", "file with the base64 ed25519 private key (default $"+signingKeyEnv+")")
+	sigPath := flags.String("sig", "", "signature file (default <catalog>.sig)")
+	expires := flags.Duration("expires", 30*24*time.Hour, "validity of the signature")
+	args, err := parseInterleaved(flags, args)
+	if err != nil {
+		return err
+	}
+	catalogPath, err := catalogArg(args)
+	if err != nil {
+		return err
+	}
+	if *sigPath == "" {
+		*sigPath = catalogPath + ".sig"
+	}
+
+	keyData := os.Getenv(signingKeyEnv)
+	if *keyPath != "" {
+		data, err := os.ReadFile(*keyPath)
+		if err != nil {
+			return err
+		}
+		keyData = string(data)
+	}
+	if keyData == "" {
+		return fmt.Errorf("-key or $%s must be set", signingKeyEnv)
+	}
+	key, err := catalog.ParsePrivateKey(keyData)
+	if err != nil {
+		return err
+	}
+
+	cat, err := catalog.Read(catalogPath)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	sig, err := catalog.Sign(cat, key, now, now.Add(*expires))
+	if err != nil {
+		return err
+	}
+	sigs, err := catalog.ReadSignatures(*sigPath)
+	if err != nil {
+		return err
+	}
+	sigs.Add(sig)
+
+	if dryRun {
+		log.Printf("DRY-RUN: would sign %s with key %s in %s\n", catalogPath, sig.KeyID, *sigPath)
+		return nil
+	}
+	if err := catalog.WriteSignatures(*sigPath, sigs); err != nil {
+		return err
+	}
+	log.Printf("signed %s with key %s until %s in %s\n", catalogPath, sig.KeyID, sig.ExpiresAt.Format(time.RFC3339), *sigPath)
+	return nil
+}
+
+// CatalogVerify verifies the signatures of a catalog with the trusted keys in
+// -pubkey or $BTFHUB_TRUSTED_KEYS
+func CatalogVerify(_ context.Context, args []string) error {
+	flags := flag.NewFlagSet("catalog verify", flag.ExitOnError)
+	var pubkeys []string
+	flags.Func("pubkey", "file with a base64 ed25519 trusted public key, may be repeated (default $"+trustedKeysEnv+", comma separated)", func(p string) error {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		pubkeys = append(pubkeys, string(data))
+		return nil
+	})
+	sigPath := flags.String("sig", "", "signature file (default <catalog>.sig)")
+	threshold := flags.Int("threshold", 1, "number of trusted keys which must have signed the catalog")
+	args, err := parseInterleaved(flags, args)
+	if err != nil {
+		return err
+	}
+	catalogPath, err := catalogArg(args)
+	if err != nil {
+		return err
+	}
+	if *sigPath == "" {
+		*sigPath = catalogPath + ".sig"
+	}
+
+	if len(pubkeys) == 0 {
+		if env := os.Getenv(trustedKeysEnv); env != "" {
+			pubkeys = strings.Split(env, ",")
+		}
+	}
+	if len(pubkeys) == 0 {
+		return fmt.Errorf("-pubkey or $%s must be set", trustedKeysEnv)
+	}
+	var trusted []ed25519.PublicKey
+	for _, k := range pubkeys {
+		pub, err := catalog.ParsePublicKey(k)
+		if err != nil {
+			return err
+		}
+		trusted = append(trusted, pub)
+	}
+
+	cat, err := catalog.Read(catalogPath)
+	if err != nil {
+		return err
+	}
+	sigs, err := catalog.ReadSignatures(*sigPath)
+	if err != nil {
+		return err
+	}
+	if err := sigs.Verify(cat, trusted, *threshold, time.Now()); err != nil {
+		return fmt.Errorf("%s: %w", catalogPath, err)
+	}
+	log.Printf("%s: signatures verified\n", catalogPath)
+	return nil
+}
+
+// CatalogKeygen writes a new signing key to <name>.key and its public key to
+// <name>.pub
+func CatalogKeygen(_ context.Context, args []string) error {
+	flags := flag.NewFlagSet("catalog keygen", flag.ExitOnError)
+	name := flags.String("o", "", "output file name, without extension")
+	if _, err := parseInterleaved(flags, args); err != nil {
+		return err
+	}
+	if *name == "" {
+		return fmt.Errorf("-o must be set")
+	}
+	private, public, err := catalog.GenerateKey()
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(*name+".key", []byte(private+"\n"), 0600); err != nil {
+		return err
+	}
+	if err := os.WriteFile(*name+".pub", []byte(public+"\n"), 0644); err != nil {
+		return err
+	}
+	pub, err := catalog.ParsePublicKey(public)
+	if err != nil {
+		return err
+	}
+	log.Printf("wrote key %s to %s.key and %s.pub\n", catalog.KeyID(pub), *name, *name)
+	return nil
+}
@@ -1,29 +1,58 @@
 package commands
 
 import (
-	"archive/tar"
 	"context"
+	"encoding/json"
+	"encoding/xml"
+	"flag"
 	"fmt"
 	"io"
 	"io/fs"
-	"maps"
+	"log"
 	"os"
+	"path"
 	"path/filepath"
 	"slices"
 	"strings"
 
-	fastxz "github.com/therootcompany/xz"
-
+	"github.com/DataDog/btfhub/pkg/catalog"
+	"github.com/DataDog/btfhub/pkg/pkg"
 	"github.com/DataDog/btfhub/pkg/utils"
 )
 
+// checkFailure is a tar header attribute which is not normalized
+type checkFailure struct {
+	Attribute string `json:"attribute"`
+	File      string `json:"file"`
+	Actual    string `json:"actual"`
+	Expected  string `json:"expected"`
+}
+
 type checkResult struct {
-	time, mode, owner, group       bool
-	distro, release, arch, version string
+	Distro   string         `json:"distro"`
+	Release  string         `json:"release"`
+	Arch     string         `json:"arch"`
+	Version  string         `json:"version"`
+	Format   string         `json:"format"`
+	Path     string         `json:"path"`
+	Failures []checkFailure `json:"failures"`
 }
 
 func (r checkResult) Failed() bool {
-	return r.time || r.mode || r.owner || r.group
+	return len(r.Failures) > 0
+}
+
+// name is the version of the archive, with its format if it is not the
+// default one
+func (r checkResult) name() string {
+	if r.Format == catalog.DefaultFormat {
+		return r.Version
+	}
+	return r.Version + " (" + r.Format + ")"
+}
+
+func (r checkResult) failed(attribute string) bool {
+	return slices.ContainsFunc(r.Failures, func(f checkFailure) bool { return f.Attribute == attribute })
 }
 
 func failedToEmoji(v bool) string {
@@ -33,36 +62,32 @@ func failedToEmoji(v bool) string {
 	return "✅"
 }
 
-func Check(ctx context.Context) error {
-	distros, releases, archs, err := processArgs(slices.Sorted(maps.Keys(distroReleases)), distroReleases)
-	if err != nil {
+func Check(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("check", flag.ExitOnError)
+	fix := flags.Bool("fix", false, "repack non-normalized archives in place, and write their hash files to -hash-dir if set")
+	output := flags.String("output", "table", "output format (table,json,junit)")
+	if err := flags.Parse(args); err != nil {
 		return err
 	}
-
-	archiveDir, err := archivePath()
-	if err != nil {
-		return fmt.Errorf("pwd: %s", err)
+	if !slices.Contains([]string{"table", "json", "junit"}, *output) {
+		return fmt.Errorf("invalid output format %s", *output)
 	}
 
-	maxDistro := len("distro")
-	for _, distro := range distros {
-		maxDistro = max(maxDistro, len(distro))
-	}
-	maxRelease := len("release")
-	for _, release := range releases {
-		maxRelease = max(maxRelease, len(release))
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
 	}
-	maxArch := len("arch")
-	for _, arch := range archs {
-		maxArch = max(maxArch, len(arch))
+	distros, releases, archs, err := processArgs(cfg, false)
+	if err != nil {
+		return err
 	}
-	fmt.Printf(fmt.Sprintf(" time | mode | owner | group | %%-%ds | %%-%ds | %%-%ds | version\n", maxDistro, maxRelease, maxArch), "distro", "release", "arch")
 
-	var printResult = func(r checkResult) {
-		// widths are minus one because emoji is two chars wide
-		fmt.Printf(fmt.Sprintf(" %-3s | %-3s | %-4s | %-4s | %%-%ds | %%-%ds | %%-%ds | %%s\n", failedToEmoji(r.time), failedToEmoji(r.mode), failedToEmoji(r.owner), failedToEmoji(r.group), maxDistro, maxRelease, maxArch), r.distro, r.release, r.arch, r.version)
+	archiveDir, err := archivePath()
+	if err != nil {
+		return fmt.Errorf("pwd: %s", err)
 	}
 
+	results := []checkResult{}
 	for _, distro := range distros {
 		for _, release := range releases[distro] {
 			for _, arch := range archs {
@@ -83,57 +108,17 @@ func Check(ctx context.Context) error {
 					if info.IsDir() {
 						return nil
 					}
-					if !strings.HasSuffix(path, ".btf.tar.xz") {
+					version, format, ok := pkg.TrimFormat(filepath.Base(path))
+					if !ok {
 						return nil
 					}
 
-					unameName := strings.TrimSuffix(filepath.Base(path), ".tar.xz")
-
-					f, err := os.Open(path)
-					if err != nil {
-						return err
-					}
-					defer f.Close()
-
-					xr, err := fastxz.NewReader(f, 0)
+					res := checkResult{Distro: distro, Release: release, Arch: arch, Version: version, Format: string(format), Path: path}
+					res.Failures, err = checkTarball(path, format)
 					if err != nil {
-						return err
-					}
-
-					version := strings.TrimSuffix(unameName, ".btf")
-					res := checkResult{distro: distro, release: release, arch: arch, version: version}
-
-					tr := tar.NewReader(xr)
-					for {
-						hdr, err := tr.Next()
-						if err == io.EOF {
-							break // End of archive
-						}
-						if err != nil {
-							return err
-						}
-
-						if hdr.ModTime.Unix() != 0 {
-							res.time = true
-							//fmt.Printf("%s: BTF file timestamp is not unix epoch. name=%s time=%s unix=%d\n", path, hdr.Name, hdr.ModTime, hdr.ModTime.Unix())
-						}
-						if hdr.Mode != 0444 {
-							res.mode = true
-							//fmt.Printf("%s: BTF file mode is not 0444. name=%s mode=%o\n", path, hdr.Name, hdr.Mode)
-						}
-						if hdr.Uid != 0 {
-							res.owner = true
-							//fmt.Printf("%s: BTF file owner is not UID 0. name=%s uid=%d\n", path, hdr.Name, hdr.Uid)
-						}
-						if hdr.Gid != 0 {
-							res.group = true
-							//fmt.Printf("%s: BTF file group is not GID 0. name=%s gid=%d\n", path, hdr.Name, hdr.Gid)
-						}
-					}
-
-					if res.Failed() {
-						printResult(res)
+						return fmt.Errorf("%s: %w", path, err)
 					}
+					results = append(results, res)
 					return nil
 				})
 				if err != nil {
@@ -142,5 +127,203 @@ func Check(ctx context.Context) error {
 			}
 		}
 	}
+
+	switch *output {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(results)
+	case "junit":
+		err = printCheckJUnit(results)
+	default:
+		printCheckTable(results)
+	}
+	if err != nil {
+		return err
+	}
+
+	var failed []checkResult
+	for _, r := range results {
+		if r.Failed() {
+			failed = append(failed, r)
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	if !*fix {
+		return fmt.Errorf("%d archives are not normalized", len(failed))
+	}
+	for _, r := range failed {
+		if err := fixTarball(ctx, r); err != nil {
+			return fmt.Errorf("fix %s: %w", r.Path, err)
+		}
+	}
 	return nil
 }
+
+// checkTarball returns the tar header attributes of a BTF archive which are
+// not normalized by pkg.TarballBTF
+func checkTarball(path string, format pkg.ArchiveFormat) ([]checkFailure, error) {
+	tr, c, err := pkg.NewArchiveReader(path, format)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	failures := []checkFailure{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break // End of archive
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if hdr.ModTime.Unix() != 0 {
+			failures = append(failures, checkFailure{"time", hdr.Name, fmt.Sprintf("%d", hdr.ModTime.Unix()), "0"})
+		}
+		if hdr.Mode != 0444 {
+			failures = append(failures, checkFailure{"mode", hdr.Name, fmt.Sprintf("%04o", hdr.Mode), "0444"})
+		}
+		if hdr.Uid != 0 {
+			failures = append(failures, checkFailure{"owner", hdr.Name, fmt.Sprintf("%d", hdr.Uid), "0"})
+		}
+		if hdr.Gid != 0 {
+			failures = append(failures, checkFailure{"group", hdr.Name, fmt.Sprintf("%d", hdr.Gid), "0"})
+		}
+	}
+	return failures, nil
+}
+
+// printCheckTable prints the failed archives as a table
+func printCheckTable(results []checkResult) {
+	maxDistro, maxRelease, maxArch := len("distro"), len("release"), len("arch")
+	for _, r := range results {
+		maxDistro = max(maxDistro, len(r.Distro))
+		maxRelease = max(maxRelease, len(r.Release))
+		maxArch = max(maxArch, len(r.Arch))
+	}
+	fmt.Printf(fmt.Sprintf(" time | mode | owner | group | %%-%ds | %%-%ds | %%-%ds | version\n", maxDistro, maxRelease, maxArch), "distro", "release", "arch")
+
+	for _, r := range results {
+		if !r.Failed() {
+			continue
+		}
+		// widths are minus one because emoji is two chars wide
+		fmt.Printf(fmt.Sprintf(" %-3s | %-3s | %-4s | %-4s | %%-%ds | %%-%ds | %%-%ds | %%s\n", failedToEmoji(r.failed("time")), failedToEmoji(r.failed("mode")), failedToEmoji(r.failed("owner")), failedToEmoji(r.failed("group")), maxDistro, maxRelease, maxArch), r.Distro, r.Release, r.Arch, r.name())
+	}
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// printCheckJUnit prints the results as JUnit XML, with a test suite per
+// distro, release and arch, and a test case per archive
+func printCheckJUnit(results []checkResult) error {
+	report := junitTestSuites{}
+	for _, r := range results {
+		name := fmt.Sprintf("%s/%s/%s", r.Distro, r.Release, r.Arch)
+		if len(report.Suites) == 0 || report.Suites[len(report.Suites)-1].Name != name {
+			report.Suites = append(report.Suites, junitTestSuite{Name: name})
+		}
+		suite := &report.Suites[len(report.Suites)-1]
+		tc := junitTestCase{Name: r.name(), Classname: name}
+		if r.Failed() {
+			var attrs, lines []string
+			for _, f := range r.Failures {
+				if !slices.Contains(attrs, f.Attribute) {
+					attrs = append(attrs, f.Attribute)
+				}
+				lines = append(lines, fmt.Sprintf("%s: %s is %s, expected %s", f.File, f.Attribute, f.Actual, f.Expected))
+			}
+			tc.Failure = &junitFailure{
+				Message: "not normalized: " + strings.Join(attrs, ", "),
+				Text:    strings.Join(lines, "\n"),
+			}
+			suite.Failures++
+		}
+		suite.Tests++
+		suite.Cases = append(suite.Cases, tc)
+	}
+
+	if _, err := os.Stdout.WriteString(xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(os.Stdout)
+	enc.Indent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return err
+	}
+	_, err := fmt.Println()
+	return err
+}
+
+// fixTarball repacks a non-normalized archive in place, and writes its new
+// hash to the hash directory, if set, for catalog-update
+func fixTarball(ctx context.Context, r checkResult) error {
+	if dryRun {
+		log.Printf("DRY-RUN: would repack %s\n", r.Path)
+		return nil
+	}
+	tmp := r.Path + ".repack"
+	defer os.Remove(tmp)
+	if err := pkg.RepackTarball(ctx, r.Path, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, r.Path); err != nil {
+		return err
+	}
+	hash, err := utils.SHA256File(r.Path)
+	if err != nil {
+		return fmt.Errorf("sha256 hash: %w", err)
+	}
+	log.Printf("FIXED: %s sha256=%s\n", r.Path, hash)
+
+	if hashDir == "" {
+		return nil
+	}
+	info, err := os.Stat(r.Path)
+	if err != nil {
+		return err
+	}
+	// order is different to match catalog nesting
+	hashPath := filepath.Join(hashDir, r.Arch, r.Distro, r.Release, r.Version)
+	archive := catalog.BTFVariant{
+		Format: r.Format,
+		SHA256: hash,
+		Size:   info.Size(),
+		Key:    path.Join(r.Distro, r.Release, r.Arch, filepath.Base(r.Path)),
+	}
+	// keep the other archives of the entry, if it has a hash file already
+	var entry catalog.BTFEntry
+	if data, err := os.ReadFile(hashPath); err == nil {
+		entry, _ = catalog.ParseEntry(data)
+	}
+	if entry.SHA256 == "" && r.Format != catalog.DefaultFormat {
+		entry.Format = r.Format
+	}
+	entry.SetArchive(archive)
+	return catalog.WriteEntry(hashPath, entry)
+}
@@ -13,40 +13,14 @@ import (
 	"golang.org/x/sync/errgroup"
 
 	"github.com/DataDog/btfhub/pkg/catalog"
+	"github.com/DataDog/btfhub/pkg/config"
 	"github.com/DataDog/btfhub/pkg/job"
+	"github.com/DataDog/btfhub/pkg/pkg"
 	"github.com/DataDog/btfhub/pkg/repo"
+	"github.com/DataDog/btfhub/pkg/store"
 )
 
-var possibleArchs = []string{"x86_64", "arm64"}
-
-var distroReleases = map[string][]string{
-	"ubuntu":        {"16.04", "18.04", "20.04"},
-	"debian":        {"9", "10"},
-	"fedora":        {"24", "25", "26", "27", "28", "29", "30", "31"},
-	"centos":        {"7", "8"},
-	"ol":            {"7", "8"},
-	"rhel":          {"7", "8"},
-	"amzn":          {"2018", "2"},
-	"sles":          {"12.3", "12.4", "12.5", "15.0", "15.1", "15.2", "15.3"},
-	"opensuse-leap": {"15.0", "15.1", "15.2", "15.3"},
-}
-
-var defaultDistros = []string{"ubuntu", "debian", "fedora", "centos", "ol"}
-
-var defaultReleases = map[string][]string{
-	"ubuntu": {"16.04", "18.04", "20.04"},
-	// no 9/stretch for debian
-	"debian":        {"10"},
-	"fedora":        {"24", "25", "26", "27", "28", "29", "30", "31"},
-	"centos":        {"7", "8"},
-	"ol":            {"7", "8"},
-	"rhel":          {"7", "8"},
-	"amzn":          {"2018", "2"},
-	"sles":          {"12.3", "12.4", "12.5", "15.0", "15.1", "15.2", "15.3"},
-	"opensuse-leap": {"15.0", "15.1", "15.2", "15.3"},
-}
-
-type repoFunc func() repo.Repository
+type repoFunc func(*config.Distro) repo.Repository
 
 var repoCreators = map[string]repoFunc{
 	"ubuntu":        repo.NewUbuntuRepo,
@@ -61,7 +35,11 @@ var repoCreators = map[string]repoFunc{
 }
 
 func Generate(ctx context.Context) error {
-	distros, releases, archs, err := processArgs(defaultDistros, defaultReleases)
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	distros, releases, archs, err := processArgs(cfg, true)
 	if err != nil {
 		return err
 	}
@@ -70,6 +48,10 @@ func Generate(ctx context.Context) error {
 	if err != nil {
 		return fmt.Errorf("pwd: %s", err)
 	}
+	st, err := openStore(ctx)
+	if err != nil {
+		return err
+	}
 
 	if numWorkers == 0 {
 		numWorkers = runtime.NumCPU() - 1
@@ -104,44 +86,34 @@ func Generate(ctx context.Context) error {
 	// Workers: job producers (per distro, per release)
 	produce, prodCtx := errgroup.WithContext(ctx)
 	for _, d := range distros {
+		distroCfg := cfg.Distros[d]
 		for _, r := range releases[d] {
 			release := r
 			for _, a := range archs {
 				arch := a
 				distro := d
+				if !distroCfg.Release(release).SupportsArch(arch) {
+					log.Printf("INFO: %s %s does not have %s packages\n", distro, release, arch)
+					continue
+				}
 				produce.Go(func() error {
 					// workDir example: ./archive/ubuntu/20.04/x86_64
 					workDir := filepath.Join(archiveDir, distro, release, arch)
 					if err := os.MkdirAll(workDir, 0775); err != nil {
 						return fmt.Errorf("arch dir: %s", err)
 					}
-					var repoHashDir string
-					if hashDir != "" {
-						// order is different to match catalog nesting
-						repoHashDir, err = filepath.Abs(filepath.Join(hashDir, arch, distro, release))
-						if err != nil {
-							return fmt.Errorf("hash dir abs: %s", err)
-						}
+					opts, err := repoOptions(cfg, distro, release, arch, qre, cat, st)
+					if err != nil {
+						return err
 					}
 
 					// pick the repository creator and get the kernel packages
-					rep := repoCreators[distro]()
-					opts := repo.RepoOptions{
-						Force:         force,
-						KernelModules: kernelModules,
-						Ordered:       ordered,
-						DryRun:        dryRun,
-						Query:         qre,
-						Launchpad:     launchpad,
-						S3Bucket:      s3bucket,
-						S3Prefix:      path.Join(s3prefix, distro, release, arch),
-						HashDir:       repoHashDir,
-						Catalog:       cat,
-						Arch:          arch,
-						Release:       release,
-						Distro:        distro,
+					rep := repoCreators[distroCfg.Type](distroCfg)
+					pkgs, err := rep.GetKernelPackages(prodCtx, release, arch, opts)
+					if err != nil {
+						return err
 					}
-					return rep.GetKernelPackages(prodCtx, workDir, release, arch, opts, chans)
+					return repo.ProcessPackages(prodCtx, workDir, pkgs, opts, chans)
 				})
 			}
 		}
@@ -155,3 +127,50 @@ func Generate(ctx context.Context) error {
 	}
 	return consume.Wait()
 }
+
+// repoOptions returns the options used to discover and process the kernel
+// packages of a distro, release and arch.
+func repoOptions(cfg *config.Config, distro, release, arch string, qre *regexp.Regexp, cat *catalog.BTFCatalog, st store.ObjectStore) (repo.RepoOptions, error) {
+	var repoHashDir string
+	if hashDir != "" {
+		// order is different to match catalog nesting
+		var err error
+		repoHashDir, err = filepath.Abs(filepath.Join(hashDir, arch, distro, release))
+		if err != nil {
+			return repo.RepoOptions{}, fmt.Errorf("hash dir abs: %s", err)
+		}
+	}
+	archiveDir, err := archivePath()
+	if err != nil {
+		return repo.RepoOptions{}, err
+	}
+	formats, err := pkg.ParseFormats(formatArg)
+	if err != nil {
+		return repo.RepoOptions{}, err
+	}
+	merger, err := job.ParseMerger(mergerArg)
+	if err != nil {
+		return repo.RepoOptions{}, err
+	}
+	return repo.RepoOptions{
+		Force:            force,
+		KernelModules:    kernelModules,
+		Ordered:          ordered,
+		DryRun:           dryRun,
+		Query:            qre,
+		Launchpad:        launchpad,
+		Store:            st,
+		StorePrefix:      path.Join(distro, release, arch),
+		ContentAddressed: contentAddressed,
+		ArchiveDir:       archiveDir,
+		Formats:          formats,
+		Merger:           merger,
+		HashDir:          repoHashDir,
+		Catalog:          cat,
+		Arch:             arch,
+		Release:          release,
+		Distro:           distro,
+		Retry:            cfg.Retry,
+		RetryFailed:      retryFailed,
+	}, nil
+}
@@ -0,0 +1,94 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"regexp"
+	"slices"
+	"text/tabwriter"
+
+	"github.com/DataDog/btfhub/pkg/pkg"
+)
+
+type listEntry struct {
+	Distro  string `json:"distro"`
+	Release string `json:"release"`
+	Arch    string `json:"arch"`
+	pkg.Info
+}
+
+// List discovers the kernel packages of the selected distros, releases and
+// archs, and prints them without processing them.
+func List(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	output := fs.String("output", "table", "output format (table,json)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *output != "table" && *output != "json" {
+		return fmt.Errorf("invalid output format %s", *output)
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	distros, releases, archs, err := processArgs(cfg, true)
+	if err != nil {
+		return err
+	}
+
+	var qre *regexp.Regexp
+	if queryArg != "" {
+		qre = regexp.MustCompile(queryArg)
+	}
+
+	// discover concurrently, but keep results in a stable order
+	entries, err := forEachCell(ctx, cfg, distros, releases, archs, func(ctx context.Context, c cell) ([]listEntry, error) {
+		rep := repoCreators[c.distroCfg.Type](c.distroCfg)
+		opts, err := repoOptions(cfg, c.distro, c.release, c.arch, qre, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		pkgsByFlavor, err := rep.GetKernelPackages(ctx, c.release, c.arch, opts)
+		if err != nil {
+			return nil, err
+		}
+		var entries []listEntry
+		for _, flavor := range slices.Sorted(maps.Keys(pkgsByFlavor)) {
+			for _, p := range pkgsByFlavor[flavor] {
+				entries = append(entries, listEntry{Distro: c.distro, Release: c.release, Arch: c.arch, Info: p.Info()})
+			}
+		}
+		log.Printf("DEBUG: %s/%s/%s: %d packages\n", c.distro, c.release, c.arch, len(entries))
+		return entries, nil
+	})
+	if err != nil {
+		return err
+	}
+	if entries == nil {
+		entries = []listEntry{}
+	}
+
+	if *output == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(entries)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "DISTRO\tRELEASE\tARCH\tFLAVOR\tNAME\tVERSION\tSIZE\tBTF\tURL")
+	for _, e := range entries {
+		size := "-"
+		if e.Size > 0 {
+			size = fmt.Sprintf("%d", e.Size)
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", e.Distro, e.Release, e.Arch, e.Flavor, e.Name, e.Version, size, e.BTFFilename, e.URL)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,93 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/DataDog/btfhub/pkg/catalog"
+)
+
+type lookupResult struct {
+	catalog.HostKey
+	ArchivePath string            `json:"archive_path,omitempty"`
+	Entry       *catalog.BTFEntry `json:"entry,omitempty"`
+}
+
+// Lookup prints the catalog entry of a host, from its os-release and uname,
+// which default to the ones of the local host
+func Lookup(_ context.Context, args []string) error {
+	flags := flag.NewFlagSet("lookup", flag.ExitOnError)
+	osReleasePath := flags.String("os-release", "/etc/os-release", "os-release file of the host")
+	unameRelease := flags.String("uname-r", "", "kernel release of the host, as printed by uname -r (default local host)")
+	unameMachine := flags.String("uname-m", "", "machine of the host, as printed by uname -m (default local host)")
+	output := flags.String("output", "table", "output format (table,json)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *output != "table" && *output != "json" {
+		return fmt.Errorf("invalid output format %s", *output)
+	}
+	if catalogJSONPath == "" {
+		return fmt.Errorf("--catalog-json must be set")
+	}
+
+	if *unameRelease == "" || *unameMachine == "" {
+		var uts unix.Utsname
+		if err := unix.Uname(&uts); err != nil {
+			return fmt.Errorf("uname: %w", err)
+		}
+		if *unameRelease == "" {
+			*unameRelease = unix.ByteSliceToString(uts.Release[:])
+		}
+		if *unameMachine == "" {
+			*unameMachine = unix.ByteSliceToString(uts.Machine[:])
+		}
+	}
+	osRelease, err := os.ReadFile(*osReleasePath)
+	if err != nil {
+		return err
+	}
+	key, err := catalog.NewHostKey(catalog.ParseOSRelease(osRelease), *unameRelease, *unameMachine)
+	if err != nil {
+		return err
+	}
+
+	cat, err := catalog.Read(catalogJSONPath)
+	if err != nil {
+		return err
+	}
+	res := lookupResult{HostKey: key}
+	if entry, ok := cat.Lookup(key); ok {
+		res.Entry = &entry
+		res.ArchivePath = key.ArchivePath(entry)
+	}
+
+	if *output == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(res); err != nil {
+			return err
+		}
+	} else {
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(tw, "ARCH\tDISTRO\tRELEASE\tVERSION\tSHA256\tARCHIVE")
+		sha256, archivePath := "-", "-"
+		if res.Entry != nil {
+			sha256, archivePath = res.Entry.SHA256, res.ArchivePath
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", key.Arch, key.Distro, key.Release, key.Version, sha256, archivePath)
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+	if res.Entry == nil {
+		return fmt.Errorf("no BTF for %s/%s/%s/%s in %s", key.Arch, key.Distro, key.Release, key.Version, catalogJSONPath)
+	}
+	return nil
+}
@@ -1,14 +1,36 @@
 package commands
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path"
 	"slices"
 	"strings"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/DataDog/btfhub/pkg/config"
+	"github.com/DataDog/btfhub/pkg/store"
 )
 
-func processArgs(defDistros []string, defReleases map[string][]string) (distros []string, releases map[string][]string, archs []string, err error) {
+func loadConfig() (*config.Config, error) {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range cfg.DistroNames() {
+		if d := cfg.Distros[name]; repoCreators[d.Type] == nil {
+			return nil, fmt.Errorf("distro %s: unknown type %s", name, d.Type)
+		}
+	}
+	return cfg, nil
+}
+
+// processArgs selects the distros, releases and archs to operate on. If
+// useDefaults is set, the default distros and releases are used when none are
+// selected, otherwise everything in the configuration is used.
+func processArgs(cfg *config.Config, useDefaults bool) (distros []string, releases map[string][]string, archs []string, err error) {
 	releases = make(map[string][]string)
 	var rels []string
 	if releaseArg != "" {
@@ -16,30 +38,37 @@ func processArgs(defDistros []string, defReleases map[string][]string) (distros
 	}
 	if distroArg != "" {
 		distros = strings.Split(distroArg, " ")
-		for _, d := range distros {
-			if _, ok := distroReleases[d]; !ok {
-				err = fmt.Errorf("invalid distribution %s", d)
-				return
-			}
+	} else {
+		distros = cfg.DistroNames()
+		if useDefaults {
+			distros = cfg.DefaultDistros
+		}
+		rels = nil // no release if no distro is selected
+	}
+	for _, d := range distros {
+		distro, ok := cfg.Distros[d]
+		if !ok {
+			err = fmt.Errorf("invalid distribution %s", d)
+			return
+		}
 
-			for _, r := range rels {
-				if slices.Contains(distroReleases[d], r) {
-					releases[d] = append(releases[d], r)
-				}
+		for _, r := range rels {
+			if distro.Release(r) != nil {
+				releases[d] = append(releases[d], r)
 			}
-			if len(rels) == 0 {
-				releases[d] = defReleases[d]
+		}
+		if len(rels) == 0 {
+			releases[d] = distro.ReleaseVersions()
+			if useDefaults {
+				releases[d] = distro.DefaultReleaseVersions()
 			}
 		}
-	} else {
-		distros = defDistros
-		releaseArg = "" // no release if no distro is selected
 	}
 
 	// Architectures
-	archs = possibleArchs
+	archs = cfg.Archs()
 	if archArg != "" {
-		if !slices.Contains(possibleArchs, archArg) {
+		if !slices.Contains(archs, archArg) {
 			err = fmt.Errorf("invalid arch %s", archArg)
 			return
 		}
@@ -48,6 +77,84 @@ func processArgs(defDistros []string, defReleases map[string][]string) (distros
 	return
 }
 
+// cell is a distro, release and arch selected by processArgs
+type cell struct {
+	distro, release, arch string
+	distroCfg             *config.Distro
+}
+
+// forEachCell calls fn concurrently for each distro, release and arch whose
+// release supports the arch, and returns the results of fn in the order of
+// the cells
+func forEachCell[T any](ctx context.Context, cfg *config.Config, distros []string, releases map[string][]string, archs []string, fn func(ctx context.Context, c cell) ([]T, error)) ([]T, error) {
+	var cells []cell
+	for _, distro := range distros {
+		distroCfg := cfg.Distros[distro]
+		for _, release := range releases[distro] {
+			for _, arch := range archs {
+				if distroCfg.Release(release).SupportsArch(arch) {
+					cells = append(cells, cell{distro, release, arch, distroCfg})
+				}
+			}
+		}
+	}
+
+	// the results are allocated before any goroutine writes to them
+	results := make([][]T, len(cells))
+	g, gctx := errgroup.WithContext(ctx)
+	for i, c := range cells {
+		g.Go(func() error {
+			r, err := fn(gctx, c)
+			if err != nil {
+				return fmt.Errorf("%s/%s/%s: %w", c.distro, c.release, c.arch, err)
+			}
+			results[i] = r
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	return slices.Concat(results...), nil
+}
+
+// selectedStore returns the URL of the object store selected by -store, or by
+// -s3-bucket and -s3-prefix, and the ACL of its objects, or an empty URL if
+// none is selected
+func selectedStore() (string, store.ACL, error) {
+	if storeURL != "" && s3bucket != "" {
+		return "", "", fmt.Errorf("-store and -s3-bucket are mutually exclusive")
+	}
+	u := storeURL
+	if s3bucket != "" {
+		u = "s3://" + path.Join(s3bucket, s3prefix)
+	}
+	if u == "" {
+		return "", "", nil
+	}
+	acl, err := store.ParseACL(objectACL)
+	if err != nil {
+		return "", "", err
+	}
+	acl, err = store.ResolveACL(u, acl)
+	return u, acl, err
+}
+
+// openStore returns the object store selected by -store, or by -s3-bucket and
+// -s3-prefix, or nil if none is selected
+func openStore(ctx context.Context) (store.ObjectStore, error) {
+	u, acl, err := selectedStore()
+	if err != nil || u == "" {
+		return nil, err
+	}
+	opts := store.Options{ACL: acl, Metadata: objectMetadata, Tags: objectTags, S3: s3Options}
+	if opts.S3.SecretAccessKey == "" {
+		// prefer the environment, flags are visible to other users
+		opts.S3.SecretAccessKey = os.Getenv("BTFHUB_S3_SECRET_ACCESS_KEY")
+	}
+	return store.Open(ctx, u, opts)
+}
+
 func archivePath() (string, error) {
 	basedir, err := os.Getwd()
 	if err != nil {
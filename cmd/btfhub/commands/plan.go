@@ -0,0 +1,94 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/DataDog/btfhub/pkg/repo"
+)
+
+type planReport struct {
+	Packages []repo.PackagePlan  `json:"packages"`
+	Summary  map[repo.Action]int `json:"summary"`
+}
+
+// Plan discovers the kernel packages of the selected distros, releases and
+// archs, and reports what generate would do with each of them, without
+// making any changes.
+func Plan(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("plan", flag.ExitOnError)
+	output := fs.String("o", "", "write the report to this file instead of stdout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	archiveDir, err := archivePath()
+	if err != nil {
+		return err
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	distros, releases, archs, err := processArgs(cfg, true)
+	if err != nil {
+		return err
+	}
+	st, err := openStore(ctx)
+	if err != nil {
+		return err
+	}
+
+	var qre *regexp.Regexp
+	if queryArg != "" {
+		qre = regexp.MustCompile(queryArg)
+	}
+
+	// discover concurrently, but keep results in a stable order
+	plans, err := forEachCell(ctx, cfg, distros, releases, archs, func(ctx context.Context, c cell) ([]repo.PackagePlan, error) {
+		workDir := filepath.Join(archiveDir, c.distro, c.release, c.arch)
+		opts, err := repoOptions(cfg, c.distro, c.release, c.arch, qre, nil, st)
+		if err != nil {
+			return nil, err
+		}
+		rep := repoCreators[c.distroCfg.Type](c.distroCfg)
+		pkgsByFlavor, err := rep.GetKernelPackages(ctx, c.release, c.arch, opts)
+		if err != nil {
+			return nil, err
+		}
+		plans, err := repo.PlanPackages(ctx, workDir, pkgsByFlavor, opts)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("DEBUG: %s/%s/%s: %d packages planned\n", c.distro, c.release, c.arch, len(plans))
+		return plans, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	report := planReport{Packages: []repo.PackagePlan{}, Summary: map[repo.Action]int{}}
+	for _, p := range plans {
+		report.Packages = append(report.Packages, p)
+		report.Summary[p.Action]++
+	}
+
+	out := os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("create report: %s", err)
+		}
+		defer f.Close()
+		out = f
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
@@ -0,0 +1,222 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"maps"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/DataDog/btfhub/pkg/catalog"
+	"github.com/DataDog/btfhub/pkg/job"
+	"github.com/DataDog/btfhub/pkg/pkg"
+	"github.com/DataDog/btfhub/pkg/repo"
+)
+
+type reproduceResult struct {
+	Distro  string `json:"distro"`
+	Release string `json:"release"`
+	Arch    string `json:"arch"`
+	Version string `json:"version"`
+	repo.Reproduction
+	Error string `json:"error,omitempty"`
+}
+
+type reproduceReport struct {
+	Tools repo.Tools `json:"tools"`
+	// Scratch has the BTF of each stage of the reproduced kernels
+	Scratch string            `json:"scratch"`
+	Kernels []reproduceResult `json:"kernels"`
+}
+
+// reproduceCandidate is a published kernel package to reproduce
+type reproduceCandidate struct {
+	distro, release, arch string
+	pkg                   pkg.Package
+	entry                 catalog.BTFEntry
+	opts                  repo.RepoOptions
+}
+
+// Reproduce regenerates the BTF archives of the kernel versions given as
+// arguments, or of a sample of the published kernels, and reports the first
+// stage whose output differs from the published archives.
+func Reproduce(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("reproduce", flag.ExitOnError)
+	sample := fs.Int("sample", 5, "number of published kernels to reproduce, chosen at random, if no kernel versions are given (0 for all)")
+	seed := fs.Uint64("seed", 0, "seed of the sample, to reproduce the same kernels again (defaults to the current time)")
+	scratch := fs.String("scratch", "", "directory where kernels are reproduced, which is kept (defaults to a new temporary directory)")
+	output := fs.String("output", "table", "output format (table,json)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *output != "table" && *output != "json" {
+		return fmt.Errorf("invalid output format %s", *output)
+	}
+	if catalogJSONPath == "" {
+		return fmt.Errorf("--catalog-json must be set")
+	}
+	versions := fs.Args()
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	distros, releases, archs, err := processArgs(cfg, true)
+	if err != nil {
+		return err
+	}
+	cat, err := catalog.Read(catalogJSONPath)
+	if err != nil {
+		return err
+	}
+	var qre *regexp.Regexp
+	if queryArg != "" {
+		qre = regexp.MustCompile(queryArg)
+	}
+
+	// discover the packages of the published kernels, in a stable order
+	candidates, err := forEachCell(ctx, cfg, distros, releases, archs, func(ctx context.Context, c cell) ([]reproduceCandidate, error) {
+		entries := cat.Entries(c.arch, c.distro, c.release)
+		if len(entries) == 0 {
+			return nil, nil
+		}
+		opts, err := repoOptions(cfg, c.distro, c.release, c.arch, qre, cat, nil)
+		if err != nil {
+			return nil, err
+		}
+		rep := repoCreators[c.distroCfg.Type](c.distroCfg)
+		pkgsByFlavor, err := rep.GetKernelPackages(ctx, c.release, c.arch, opts)
+		if err != nil {
+			return nil, err
+		}
+		var candidates []reproduceCandidate
+		for _, flavor := range slices.Sorted(maps.Keys(pkgsByFlavor)) {
+			for _, p := range pkgsByFlavor[flavor] {
+				version := p.BTFFilename()
+				entry, ok := entries[version]
+				if !ok || (len(versions) > 0 && !slices.Contains(versions, version)) {
+					continue
+				}
+				candidates = append(candidates, reproduceCandidate{c.distro, c.release, c.arch, p, entry, opts})
+			}
+		}
+		return candidates, nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(versions) == 0 && *sample > 0 && *sample < len(candidates) {
+		if *seed == 0 {
+			*seed = uint64(time.Now().UnixNano())
+		}
+		log.Printf("sampling %d of %d published kernels with -seed %d\n", *sample, len(candidates), *seed)
+		rand.New(rand.NewPCG(*seed, 0)).Shuffle(len(candidates), func(i, j int) {
+			candidates[i], candidates[j] = candidates[j], candidates[i]
+		})
+		candidates = candidates[:*sample]
+	}
+	if len(candidates) == 0 {
+		return fmt.Errorf("no published kernels to reproduce")
+	}
+
+	if *scratch == "" {
+		*scratch, err = os.MkdirTemp("", "btfhub-reproduce-*")
+		if err != nil {
+			return err
+		}
+	}
+	log.Printf("reproducing %d kernels in %s\n", len(candidates), *scratch)
+
+	if numWorkers == 0 {
+		numWorkers = runtime.NumCPU() - 1
+	}
+	jobChan := make(chan job.Job)
+	btfChan := make(chan job.Job)
+	consume, consCtx := errgroup.WithContext(ctx)
+	for i := 0; i < numWorkers; i++ {
+		consume.Go(func() error {
+			return job.StartWorker(consCtx, btfChan, jobChan)
+		})
+	}
+	chans := &repo.JobChannels{BTF: btfChan, Default: jobChan}
+
+	report := reproduceReport{Tools: repo.ToolVersions(), Scratch: *scratch, Kernels: make([]reproduceResult, len(candidates))}
+	produce, prodCtx := errgroup.WithContext(ctx)
+	produce.SetLimit(numWorkers)
+	for i, c := range candidates {
+		produce.Go(func() error {
+			version := c.pkg.BTFFilename()
+			dir := filepath.Join(*scratch, c.distro, c.release, c.arch, version)
+			r, err := repo.Reproduce(prodCtx, c.pkg, dir, c.entry, c.opts, chans)
+			res := reproduceResult{Distro: c.distro, Release: c.release, Arch: c.arch, Version: version, Reproduction: r}
+			if err != nil {
+				if prodCtx.Err() != nil {
+					return prodCtx.Err()
+				}
+				log.Printf("ERROR: reproduce %s: %s\n", c.pkg, err)
+				res.Error = err.Error()
+			}
+			report.Kernels[i] = res
+			return nil
+		})
+	}
+	err = produce.Wait()
+	close(jobChan)
+	if err != nil {
+		return err
+	}
+	if err := consume.Wait(); err != nil {
+		return err
+	}
+
+	if *output == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return err
+		}
+	} else if err := printReproduceTable(report); err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, r := range report.Kernels {
+		if r.Stage != "" || r.Error != "" {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d kernels were not reproduced", failed, len(report.Kernels))
+	}
+	return nil
+}
+
+// printReproduceTable prints the tool versions, and the stage which diverged
+// for each kernel
+func printReproduceTable(report reproduceReport) error {
+	fmt.Printf("pahole %s, bpftool %s, btfhub %s, xz %s, zstd %s\n\n", report.Tools.Pahole, report.Tools.Bpftool, report.Tools.Btfhub, report.Tools.XZ, report.Tools.Zstd)
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "ARCH\tDISTRO\tRELEASE\tVERSION\tSTAGE\tDETAIL")
+	for _, r := range report.Kernels {
+		stage, detail := string(r.Stage), r.Detail
+		switch {
+		case r.Error != "":
+			stage, detail = "error", r.Error
+		case stage == "":
+			stage = "reproduced"
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", r.Arch, r.Distro, r.Release, r.Version, stage, detail)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,97 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"text/tabwriter"
+	"time"
+
+	"github.com/DataDog/btfhub/pkg/state"
+)
+
+type statusEntry struct {
+	Distro  string `json:"distro"`
+	Release string `json:"release"`
+	Arch    string `json:"arch"`
+	Kernel  string `json:"kernel"`
+	state.Record
+}
+
+// Status prints the recorded processing state of the kernel packages in the
+// archive, so it is possible to tell why a kernel is missing.
+func Status(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	output := fs.String("output", "table", "output format (table,json)")
+	statusArg := fs.String("status", "", "only show packages with this status (success,failed,hasbtf)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *output != "table" && *output != "json" {
+		return fmt.Errorf("invalid output format %s", *output)
+	}
+
+	archiveDir, err := archivePath()
+	if err != nil {
+		return err
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	distros, releases, archs, err := processArgs(cfg, false)
+	if err != nil {
+		return err
+	}
+
+	var qre *regexp.Regexp
+	if queryArg != "" {
+		qre = regexp.MustCompile(queryArg)
+	}
+
+	entries := []statusEntry{}
+	for _, distro := range distros {
+		for _, release := range releases[distro] {
+			for _, arch := range archs {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				workDir := filepath.Join(archiveDir, distro, release, arch)
+				if _, err := os.Stat(workDir); err != nil {
+					continue
+				}
+				st, err := state.Open(workDir)
+				if err != nil {
+					return fmt.Errorf("%s/%s/%s: %w", distro, release, arch, err)
+				}
+				for _, name := range st.Names() {
+					if qre != nil && !qre.MatchString(name) {
+						continue
+					}
+					rec, _ := st.Get(name)
+					if *statusArg != "" && string(rec.Status) != *statusArg {
+						continue
+					}
+					entries = append(entries, statusEntry{Distro: distro, Release: release, Arch: arch, Kernel: name, Record: rec})
+				}
+			}
+		}
+	}
+
+	if *output == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(entries)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "DISTRO\tRELEASE\tARCH\tKERNEL\tSTATUS\tSTAGE\tATTEMPTS\tLAST ATTEMPT\tERROR")
+	for _, e := range entries {
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%d\t%s\t%s\n", e.Distro, e.Release, e.Arch, e.Kernel, e.Status, e.Stage, e.Attempts, e.LastAttempt.Format(time.RFC3339), e.Error)
+	}
+	return tw.Flush()
+}
@@ -2,27 +2,67 @@ package commands
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"io/fs"
 	"log"
-	"maps"
 	"os"
-	"path"
 	"path/filepath"
-	"slices"
 	"strings"
+	"sync/atomic"
 
+	"github.com/cenkalti/backoff/v5"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/DataDog/btfhub/pkg/catalog"
+	"github.com/DataDog/btfhub/pkg/pkg"
+	"github.com/DataDog/btfhub/pkg/store"
+	"github.com/DataDog/btfhub/pkg/upload"
 	"github.com/DataDog/btfhub/pkg/utils"
 )
 
-func Upload(ctx context.Context) error {
-	distros, releases, archs, err := processArgs(slices.Sorted(maps.Keys(distroReleases)), distroReleases)
+// defaultUploadWorkers is the number of concurrent uploads, if -workers is not
+// set, as uploads are bound by the network rather than the CPU
+const defaultUploadWorkers = 16
+
+type uploadFile struct {
+	path    string
+	key     string
+	info    fs.FileInfo
+	distro  string
+	version string
+	// blob is a content-addressed blob, which may be shared by versions
+	blob bool
+}
+
+type uploadSummary struct {
+	uploaded, inManifest, exists, failed atomic.Int64
+	bytes                                atomic.Int64
+}
+
+func Upload(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("upload", flag.ExitOnError)
+	manifestPath := flags.String("manifest", ".upload-manifest", "file recording completed uploads, to resume an interrupted upload (empty to disable)")
+	retries := flags.Uint("retries", 5, "number of attempts to upload each object")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	distros, releases, archs, err := processArgs(cfg, false)
 	if err != nil {
 		return err
 	}
 
-	if s3bucket == "" {
-		return fmt.Errorf("s3bucket is required")
+	st, err := openStore(ctx)
+	if err != nil {
+		return err
+	}
+	if st == nil {
+		return fmt.Errorf("-store or -s3-bucket is required")
 	}
 
 	archiveDir, err := archivePath()
@@ -30,6 +70,9 @@ func Upload(ctx context.Context) error {
 		return fmt.Errorf("pwd: %s", err)
 	}
 
+	var files []uploadFile
+	// blobs are uploaded once, for the first version which points to them
+	blobs := map[string]bool{}
 	for _, distro := range distros {
 		for _, release := range releases[distro] {
 			for _, arch := range archs {
@@ -50,32 +93,36 @@ func Upload(ctx context.Context) error {
 					if info.IsDir() {
 						return nil
 					}
-					if !strings.HasSuffix(walkPath, ".btf.tar.xz") {
+					if strings.HasSuffix(walkPath, ".btf.ptr") {
+						blobFiles, err := pointerBlobs(archiveDir, walkPath, distro)
+						if err != nil {
+							return err
+						}
+						for _, f := range blobFiles {
+							if !blobs[f.key] {
+								blobs[f.key] = true
+								files = append(files, f)
+							}
+						}
 						return nil
 					}
-
-					f, err := os.Open(walkPath)
-					if err != nil {
-						return err
+					version, _, ok := pkg.TrimFormat(info.Name())
+					if !ok {
+						return nil
 					}
-					defer f.Close()
 
 					relPath, err := filepath.Rel(archiveDir, walkPath)
 					if err != nil {
 						return err
 					}
-					key := path.Join(s3prefix, relPath)
-					if !force {
-						exists, err := utils.S3Exists(ctx, s3bucket, key)
-						if err != nil || exists {
-							return err
-						}
-					}
-					log.Printf("uploading %s to %s/%s", walkPath, s3bucket, key)
-					if dryRun {
-						return nil
-					}
-					return utils.S3Upload(ctx, s3bucket, key, f)
+					files = append(files, uploadFile{
+						path:    walkPath,
+						key:     filepath.ToSlash(relPath),
+						info:    info,
+						distro:  distro,
+						version: version,
+					})
+					return nil
 				})
 				if err != nil {
 					return err
@@ -84,5 +131,144 @@ func Upload(ctx context.Context) error {
 		}
 	}
 
+	var manifest *upload.Manifest
+	// a dry run does not create the manifest, but skips the files already in it
+	if *manifestPath != "" && (!dryRun || utils.Exists(*manifestPath)) {
+		manifest, err = upload.OpenManifest(*manifestPath)
+		if err != nil {
+			return fmt.Errorf("manifest: %w", err)
+		}
+		defer manifest.Close()
+	}
+
+	workers := numWorkers
+	if workers == 0 {
+		workers = defaultUploadWorkers
+	}
+	log.Printf("uploading %d files with %d workers\n", len(files), workers)
+
+	var summary uploadSummary
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(workers)
+	for _, f := range files {
+		if gctx.Err() != nil {
+			break
+		}
+		g.Go(func() error {
+			err := uploadOne(gctx, st, f, manifest, *retries, &summary)
+			if err != nil {
+				if gctx.Err() != nil {
+					return gctx.Err()
+				}
+				// keep uploading other files, the failure is in the summary
+				log.Printf("ERROR: upload %s: %s\n", f.path, err)
+				summary.failed.Add(1)
+			}
+			return nil
+		})
+	}
+	err = g.Wait()
+
+	action := "uploaded"
+	if dryRun {
+		action = "would upload"
+	}
+	log.Printf("%s %d files (%d bytes), skipped %d in manifest and %d already in store, %d failed\n",
+		action, summary.uploaded.Load(), summary.bytes.Load(), summary.inManifest.Load(), summary.exists.Load(), summary.failed.Load())
+	if err != nil {
+		return err
+	}
+	if n := summary.failed.Load(); n > 0 {
+		return fmt.Errorf("%d uploads failed", n)
+	}
 	return nil
 }
+
+// pointerBlobs returns the blobs of the archives a pointer file points to
+func pointerBlobs(archiveDir, ptrPath, distro string) ([]uploadFile, error) {
+	data, err := os.ReadFile(ptrPath)
+	if err != nil {
+		return nil, err
+	}
+	entry, ok := catalog.ParseEntry(data)
+	if !ok || entry.Key == "" {
+		return nil, fmt.Errorf("invalid pointer file %s", ptrPath)
+	}
+	var files []uploadFile
+	for _, archive := range entry.Archives() {
+		blobPath := filepath.Join(archiveDir, filepath.FromSlash(archive.Key))
+		info, err := os.Stat(blobPath)
+		if err != nil {
+			return nil, fmt.Errorf("blob of %s: %w", ptrPath, err)
+		}
+		files = append(files, uploadFile{
+			path:    blobPath,
+			key:     archive.Key,
+			info:    info,
+			distro:  distro,
+			version: strings.TrimSuffix(filepath.Base(ptrPath), ".btf.ptr"),
+			blob:    true,
+		})
+	}
+	return files, nil
+}
+
+// uploadOne uploads a file, unless it is in the manifest or already exists in
+// the object store, retrying with exponential backoff
+func uploadOne(ctx context.Context, st store.ObjectStore, f uploadFile, manifest *upload.Manifest, retries uint, summary *uploadSummary) error {
+	storeName := st.URL("")
+	if !force && manifest != nil && manifest.Done(storeName, f.key, f.info.Size(), f.info.ModTime()) {
+		summary.inManifest.Add(1)
+		return nil
+	}
+
+	_, err := backoff.Retry(ctx, func() (struct{}, error) {
+		// blobs are immutable, so they are never uploaded again
+		if !force || f.blob {
+			exists, err := st.Exists(ctx, f.key)
+			if err != nil {
+				return struct{}{}, err
+			}
+			if exists {
+				summary.exists.Add(1)
+				return struct{}{}, nil
+			}
+		}
+		if dryRun {
+			log.Printf("DRY-RUN: would upload %s to %s\n", f.path, st.URL(f.key))
+			summary.uploaded.Add(1)
+			summary.bytes.Add(f.info.Size())
+			return struct{}{}, nil
+		}
+
+		hash, err := utils.SHA256File(f.path)
+		if err != nil {
+			return struct{}{}, backoff.Permanent(fmt.Errorf("sha256 hash: %w", err))
+		}
+		file, err := os.Open(f.path)
+		if err != nil {
+			return struct{}{}, backoff.Permanent(err)
+		}
+		defer file.Close()
+		if err := st.Upload(ctx, f.key, file, store.ArchiveAttributes(f.distro, f.version, hash)); err != nil {
+			return struct{}{}, err
+		}
+		log.Printf("uploaded %s to %s\n", f.path, st.URL(f.key))
+		summary.uploaded.Add(1)
+		summary.bytes.Add(f.info.Size())
+		return struct{}{}, nil
+	}, backoff.WithMaxTries(retries))
+	if err != nil {
+		return err
+	}
+
+	if manifest == nil || dryRun {
+		return nil
+	}
+	return manifest.Add(upload.Entry{
+		Store:   storeName,
+		Key:     f.key,
+		Size:    f.info.Size(),
+		ModTime: f.info.ModTime().Unix(),
+	})
+}
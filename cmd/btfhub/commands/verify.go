@@ -0,0 +1,207 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/DataDog/btfhub/pkg/catalog"
+	"github.com/DataDog/btfhub/pkg/pkg"
+	"github.com/DataDog/btfhub/pkg/store"
+	"github.com/DataDog/btfhub/pkg/utils"
+)
+
+// Verify re-hashes the archived BTFs and compares them with the catalog and,
+// optionally, with the objects in the object store. It returns an error if there is any
+// drift between them.
+func Verify(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	output := fs.String("output", "table", "output format (table,json)")
+	checkS3 := fs.Bool("s3", false, "also compare with the objects in -store, or -s3-bucket under -s3-prefix")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *output != "table" && *output != "json" {
+		return fmt.Errorf("invalid output format %s", *output)
+	}
+	if catalogJSONPath == "" {
+		return fmt.Errorf("--catalog-json must be set")
+	}
+	var st store.ObjectStore
+	if *checkS3 {
+		var err error
+		st, err = openStore(ctx)
+		if err != nil {
+			return err
+		}
+		if st == nil {
+			return fmt.Errorf("--store or --s3-bucket must be set")
+		}
+	}
+
+	archiveDir, err := archivePath()
+	if err != nil {
+		return err
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	distros, releases, archs, err := processArgs(cfg, false)
+	if err != nil {
+		return err
+	}
+	cat, err := catalog.Read(catalogJSONPath)
+	if err != nil {
+		return err
+	}
+
+	drifts := []catalog.Drift{}
+	for _, distro := range distros {
+		for _, release := range releases[distro] {
+			for _, arch := range archs {
+				btfdir := filepath.Join(archiveDir, distro, release, arch)
+				hashes, blobKeys, err := hashArchive(ctx, archiveDir, btfdir)
+				if err != nil {
+					return err
+				}
+
+				var s3Versions []string
+				if *checkS3 {
+					keys, err := st.List(ctx, path.Join(distro, release, arch))
+					if err != nil {
+						return fmt.Errorf("store list: %s", err)
+					}
+					s3Versions = []string{}
+					for _, key := range keys {
+						if version, _, ok := pkg.TrimFormat(path.Base(key)); ok && !slices.Contains(s3Versions, version) {
+							s3Versions = append(s3Versions, version)
+						}
+					}
+					// content-addressed versions are in the store if their blob is
+					for version, key := range blobKeys {
+						exists, err := st.Exists(ctx, key)
+						if err != nil {
+							return fmt.Errorf("store exists: %s", err)
+						}
+						if exists && !slices.Contains(s3Versions, version) {
+							s3Versions = append(s3Versions, version)
+						}
+					}
+				}
+
+				entries := cat.Entries(arch, distro, release)
+				drifts = append(drifts, catalog.CompareArchives(arch, distro, release, entries, hashes, s3Versions)...)
+			}
+		}
+	}
+
+	if *output == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(drifts); err != nil {
+			return err
+		}
+	} else {
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(tw, "KIND\tARCH\tDISTRO\tRELEASE\tVERSION\tDETAIL")
+		for _, d := range drifts {
+			_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", d.Kind, d.Arch, d.Distro, d.Release, d.Version, d.Detail)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if len(drifts) > 0 {
+		return fmt.Errorf("found %d differences between archive, catalog and S3", len(drifts))
+	}
+	return nil
+}
+
+// hashArchive returns the SHA256 hashes of the BTF archives in dir, keyed by
+// kernel version and format. The archives of pointer files are their blobs in
+// archiveDir, and the keys of the blobs of the catalog entries are also
+// returned by version.
+func hashArchive(ctx context.Context, archiveDir, dir string) (map[string]map[string]string, map[string]string, error) {
+	hashes := map[string]map[string]string{}
+	blobKeys := map[string]string{}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return hashes, blobKeys, nil
+		}
+		return nil, nil, err
+	}
+
+	var mu sync.Mutex
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(runtime.NumCPU())
+	hash := func(version, format, archivePath string) {
+		g.Go(func() error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			hash, err := utils.SHA256File(archivePath)
+			if err != nil {
+				return fmt.Errorf("sha256 hash: %w", err)
+			}
+			mu.Lock()
+			if hashes[version] == nil {
+				hashes[version] = map[string]string{}
+			}
+			hashes[version][format] = hash
+			mu.Unlock()
+			return nil
+		})
+	}
+	var readErr error
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		archivePath := filepath.Join(dir, e.Name())
+		if version, format, ok := pkg.TrimFormat(e.Name()); ok {
+			hash(version, string(format), archivePath)
+			continue
+		}
+		version, ok := strings.CutSuffix(e.Name(), ".btf.ptr")
+		if !ok {
+			continue
+		}
+		data, err := os.ReadFile(archivePath)
+		if err != nil {
+			readErr = err
+			break
+		}
+		ptr, ok := catalog.ParseEntry(data)
+		if !ok || ptr.Key == "" {
+			readErr = fmt.Errorf("invalid pointer file %s", archivePath)
+			break
+		}
+		blobKeys[version] = ptr.Key
+		for _, archive := range ptr.Archives() {
+			hash(version, archive.Format, filepath.Join(archiveDir, filepath.FromSlash(archive.Key)))
+		}
+	}
+	// archives already submitted are hashed before returning, on error too
+	err = g.Wait()
+	if readErr != nil {
+		return nil, nil, readErr
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return hashes, blobKeys, nil
+}
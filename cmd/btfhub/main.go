@@ -23,14 +23,28 @@ func main() {
 func run(ctx context.Context) error {
 	if fa := flag.Args(); len(fa) > 0 {
 		switch fa[0] {
+		case "list":
+			return commands.List(ctx, fa[1:])
+		case "plan":
+			return commands.Plan(ctx, fa[1:])
+		case "status":
+			return commands.Status(ctx, fa[1:])
+		case "verify":
+			return commands.Verify(ctx, fa[1:])
 		case "check":
-			return commands.Check(ctx)
+			return commands.Check(ctx, fa[1:])
 		case "upload":
-			return commands.Upload(ctx)
+			return commands.Upload(ctx, fa[1:])
 		case "catalog-update":
-			return commands.CatalogUpdate(ctx)
+			return commands.CatalogUpdate(ctx, fa[1:])
+		case "catalog":
+			return commands.Catalog(ctx, fa[1:])
 		case "acl":
-			return commands.ACL(ctx)
+			return commands.ACL(ctx, fa[1:])
+		case "lookup":
+			return commands.Lookup(ctx, fa[1:])
+		case "reproduce":
+			return commands.Reproduce(ctx, fa[1:])
 		default:
 			log.Fatalf("unknown command %s", fa[0])
 		}
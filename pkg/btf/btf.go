@@ -0,0 +1,419 @@
+// Package btf reads, writes and merges raw BPF Type Format data, as generated
+// by pahole with --btf_encode_detached.
+package btf
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+)
+
+const (
+	btfMagic   = 0xeb9f
+	btfVersion = 1
+	headerLen  = 24
+	typeLen    = 12
+)
+
+// Kind is the kind of a BTF type
+type Kind uint8
+
+const (
+	KindUnknown Kind = iota
+	KindInt
+	KindPtr
+	KindArray
+	KindStruct
+	KindUnion
+	KindEnum
+	KindFwd
+	KindTypedef
+	KindVolatile
+	KindConst
+	KindRestrict
+	KindFunc
+	KindFuncProto
+	KindVar
+	KindDatasec
+	KindFloat
+	KindDeclTag
+	KindTypeTag
+	KindEnum64
+)
+
+var kindNames = [...]string{
+	"UNKNOWN", "INT", "PTR", "ARRAY", "STRUCT", "UNION", "ENUM", "FWD", "TYPEDEF", "VOLATILE",
+	"CONST", "RESTRICT", "FUNC", "FUNC_PROTO", "VAR", "DATASEC", "FLOAT", "DECL_TAG", "TYPE_TAG", "ENUM64",
+}
+
+func (k Kind) String() string {
+	if int(k) < len(kindNames) {
+		return kindNames[k]
+	}
+	return fmt.Sprintf("KIND(%d)", k)
+}
+
+// refersToType reports whether the size/type field of the kind is a type ID
+func (k Kind) refersToType() bool {
+	switch k {
+	case KindPtr, KindTypedef, KindVolatile, KindConst, KindRestrict, KindFunc,
+		KindFuncProto, KindVar, KindDeclTag, KindTypeTag:
+		return true
+	}
+	return false
+}
+
+// TypeID identifies a type. ID 0 is void.
+type TypeID uint32
+
+// Type is a single BTF type. Which fields are used depends on the kind.
+type Type struct {
+	Kind     Kind
+	Name     string
+	KindFlag bool
+	// SizeType is the size of the type, or the ID of the referenced type,
+	// depending on the kind
+	SizeType uint32
+	// Extra is the INT encoding, VAR linkage or DECL_TAG component index
+	Extra uint32
+	// Linkage is the FUNC linkage
+	Linkage uint16
+
+	Array   *Array
+	Members []Member
+	Enums   []Enum
+	Params  []Param
+	Vars    []VarSecinfo
+}
+
+// Array is the element description of an ARRAY type
+type Array struct {
+	Type      TypeID
+	IndexType TypeID
+	Nelems    uint32
+}
+
+// Member is a member of a STRUCT or UNION type
+type Member struct {
+	Name   string
+	Type   TypeID
+	Offset uint32
+}
+
+// Enum is a value of an ENUM or ENUM64 type. ENUM values only use the lower
+// 32 bits.
+type Enum struct {
+	Name  string
+	Value uint64
+}
+
+// Param is a parameter of a FUNC_PROTO type
+type Param struct {
+	Name string
+	Type TypeID
+}
+
+// VarSecinfo is a variable of a DATASEC type
+type VarSecinfo struct {
+	Type   TypeID
+	Offset uint32
+	Size   uint32
+}
+
+// vlen returns the value of the vlen bits in the type info
+func (t *Type) vlen() int {
+	switch t.Kind {
+	case KindStruct, KindUnion:
+		return len(t.Members)
+	case KindEnum, KindEnum64:
+		return len(t.Enums)
+	case KindFuncProto:
+		return len(t.Params)
+	case KindDatasec:
+		return len(t.Vars)
+	case KindFunc:
+		return int(t.Linkage)
+	}
+	return 0
+}
+
+// visitRefs calls fn with a pointer to every type ID referenced by t
+func (t *Type) visitRefs(fn func(id *TypeID)) {
+	if t.Kind.refersToType() {
+		id := TypeID(t.SizeType)
+		fn(&id)
+		t.SizeType = uint32(id)
+	}
+	if t.Array != nil {
+		fn(&t.Array.Type)
+		fn(&t.Array.IndexType)
+	}
+	for i := range t.Members {
+		fn(&t.Members[i].Type)
+	}
+	for i := range t.Params {
+		fn(&t.Params[i].Type)
+	}
+	for i := range t.Vars {
+		fn(&t.Vars[i].Type)
+	}
+}
+
+// copy returns a deep copy of t
+func (t *Type) copy() *Type {
+	c := *t
+	if t.Array != nil {
+		a := *t.Array
+		c.Array = &a
+	}
+	c.Members = append([]Member(nil), t.Members...)
+	c.Enums = append([]Enum(nil), t.Enums...)
+	c.Params = append([]Param(nil), t.Params...)
+	c.Vars = append([]VarSecinfo(nil), t.Vars...)
+	return &c
+}
+
+// Spec is a parsed BTF blob. Split BTF, as generated for kernel modules, has
+// a base Spec, and its type IDs and string offsets continue after those of
+// the base.
+type Spec struct {
+	byteOrder binary.ByteOrder
+	base      *Spec
+	types     []*Type
+	strings   *stringTable
+}
+
+// NewSpec returns an empty Spec. If base is not nil, the Spec is split BTF.
+func NewSpec(base *Spec) *Spec {
+	s := &Spec{byteOrder: binary.LittleEndian, base: base}
+	if base != nil {
+		s.byteOrder = base.byteOrder
+		s.strings = newSplitStringTable(base.strings)
+	} else {
+		s.strings = newStringTable()
+	}
+	return s
+}
+
+// LoadFile reads raw BTF from a file. base must be set for split BTF.
+func LoadFile(path string, base *Spec) (*Spec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s, err := Parse(data, base)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Parse parses raw BTF. base must be set for split BTF.
+func Parse(data []byte, base *Spec) (*Spec, error) {
+	if base != nil && base.base != nil {
+		return nil, errors.New("base BTF must not be split BTF")
+	}
+	if len(data) < headerLen {
+		return nil, fmt.Errorf("btf header: %d bytes is too short", len(data))
+	}
+	var bo binary.ByteOrder = binary.LittleEndian
+	if bo.Uint16(data) != btfMagic {
+		bo = binary.BigEndian
+		if bo.Uint16(data) != btfMagic {
+			return nil, fmt.Errorf("btf header: invalid magic %#x", binary.LittleEndian.Uint16(data))
+		}
+	}
+	if data[2] != btfVersion {
+		return nil, fmt.Errorf("btf header: unsupported version %d", data[2])
+	}
+	if base != nil && base.byteOrder != bo {
+		return nil, errors.New("byte order does not match base BTF")
+	}
+	hdrLen := bo.Uint32(data[4:])
+	typeOff, typeSize := bo.Uint32(data[8:]), bo.Uint32(data[12:])
+	strOff, strSize := bo.Uint32(data[16:]), bo.Uint32(data[20:])
+	if hdrLen < headerLen || uint64(hdrLen) > uint64(len(data)) {
+		return nil, fmt.Errorf("btf header: invalid header length %d", hdrLen)
+	}
+	body := data[hdrLen:]
+	if uint64(typeOff)+uint64(typeSize) > uint64(len(body)) {
+		return nil, errors.New("btf header: type section out of bounds")
+	}
+	if uint64(strOff)+uint64(strSize) > uint64(len(body)) {
+		return nil, errors.New("btf header: string section out of bounds")
+	}
+
+	s := &Spec{byteOrder: bo, base: base}
+	var err error
+	if base != nil {
+		s.strings, err = parseSplitStringTable(base.strings, body[strOff:strOff+strSize])
+	} else {
+		s.strings, err = parseStringTable(body[strOff : strOff+strSize])
+	}
+	if err != nil {
+		return nil, fmt.Errorf("btf strings: %w", err)
+	}
+	if err := s.parseTypes(body[typeOff : typeOff+typeSize]); err != nil {
+		return nil, fmt.Errorf("btf types: %w", err)
+	}
+	return s, nil
+}
+
+func (s *Spec) parseTypes(data []byte) error {
+	bo := s.byteOrder
+	off := 0
+	next := func(n int) ([]byte, error) {
+		if n < 0 || len(data)-off < n {
+			return nil, fmt.Errorf("type %d truncated", int(s.startID())+len(s.types))
+		}
+		b := data[off : off+n]
+		off += n
+		return b, nil
+	}
+	name := func(b []byte) (string, error) {
+		return s.strings.lookup(bo.Uint32(b))
+	}
+
+	for off < len(data) {
+		b, err := next(typeLen)
+		if err != nil {
+			return err
+		}
+		info := bo.Uint32(b[4:])
+		t := &Type{
+			Kind:     Kind((info >> 24) & 0x1f),
+			KindFlag: info>>31 == 1,
+			SizeType: bo.Uint32(b[8:]),
+		}
+		if t.Name, err = name(b); err != nil {
+			return err
+		}
+		vlen := int(info & 0xffff)
+
+		switch t.Kind {
+		case KindInt, KindVar, KindDeclTag:
+			if b, err = next(4); err != nil {
+				return err
+			}
+			t.Extra = bo.Uint32(b)
+		case KindPtr, KindFwd, KindTypedef, KindVolatile, KindConst, KindRestrict, KindFloat, KindTypeTag:
+		case KindFunc:
+			t.Linkage = uint16(vlen)
+		case KindArray:
+			if b, err = next(12); err != nil {
+				return err
+			}
+			t.Array = &Array{Type: TypeID(bo.Uint32(b)), IndexType: TypeID(bo.Uint32(b[4:])), Nelems: bo.Uint32(b[8:])}
+		case KindStruct, KindUnion:
+			if b, err = next(vlen * 12); err != nil {
+				return err
+			}
+			t.Members = make([]Member, vlen)
+			for i := range t.Members {
+				m := b[i*12:]
+				if t.Members[i].Name, err = name(m); err != nil {
+					return err
+				}
+				t.Members[i].Type = TypeID(bo.Uint32(m[4:]))
+				t.Members[i].Offset = bo.Uint32(m[8:])
+			}
+		case KindEnum:
+			if b, err = next(vlen * 8); err != nil {
+				return err
+			}
+			t.Enums = make([]Enum, vlen)
+			for i := range t.Enums {
+				e := b[i*8:]
+				if t.Enums[i].Name, err = name(e); err != nil {
+					return err
+				}
+				t.Enums[i].Value = uint64(bo.Uint32(e[4:]))
+			}
+		case KindEnum64:
+			if b, err = next(vlen * 12); err != nil {
+				return err
+			}
+			t.Enums = make([]Enum, vlen)
+			for i := range t.Enums {
+				e := b[i*12:]
+				if t.Enums[i].Name, err = name(e); err != nil {
+					return err
+				}
+				t.Enums[i].Value = uint64(bo.Uint32(e[8:]))<<32 | uint64(bo.Uint32(e[4:]))
+			}
+		case KindFuncProto:
+			if b, err = next(vlen * 8); err != nil {
+				return err
+			}
+			t.Params = make([]Param, vlen)
+			for i := range t.Params {
+				p := b[i*8:]
+				if t.Params[i].Name, err = name(p); err != nil {
+					return err
+				}
+				t.Params[i].Type = TypeID(bo.Uint32(p[4:]))
+			}
+		case KindDatasec:
+			if b, err = next(vlen * 12); err != nil {
+				return err
+			}
+			t.Vars = make([]VarSecinfo, vlen)
+			for i := range t.Vars {
+				v := b[i*12:]
+				t.Vars[i] = VarSecinfo{Type: TypeID(bo.Uint32(v)), Offset: bo.Uint32(v[4:]), Size: bo.Uint32(v[8:])}
+			}
+		default:
+			return fmt.Errorf("type %d: unknown kind %s", int(s.startID())+len(s.types), t.Kind)
+		}
+		s.types = append(s.types, t)
+	}
+	return nil
+}
+
+// startID returns the ID of the first type of the Spec
+func (s *Spec) startID() TypeID {
+	if s.base == nil {
+		return 1
+	}
+	return s.base.startID() + TypeID(len(s.base.types))
+}
+
+// Base returns the base Spec of split BTF, or nil
+func (s *Spec) Base() *Spec {
+	return s.base
+}
+
+// NumTypes returns the number of types in the Spec, excluding void and the
+// types of the base
+func (s *Spec) NumTypes() int {
+	return len(s.types)
+}
+
+// Types returns the types of the Spec, excluding the types of the base. The
+// first type has ID 1, or the ID following the last base type.
+func (s *Spec) Types() []*Type {
+	return s.types
+}
+
+// Add appends a type to the Spec and returns its ID
+func (s *Spec) Add(t *Type) TypeID {
+	s.types = append(s.types, t)
+	return s.startID() + TypeID(len(s.types)-1)
+}
+
+// TypeByID returns the type with the ID, looking up the base for split BTF.
+// Void is not a type, so ID 0 returns an error.
+func (s *Spec) TypeByID(id TypeID) (*Type, error) {
+	start := s.startID()
+	if id >= start {
+		if idx := int(id - start); idx < len(s.types) {
+			return s.types[idx], nil
+		}
+		return nil, fmt.Errorf("type %d not found", id)
+	}
+	if s.base != nil && id > 0 {
+		return s.base.TypeByID(id)
+	}
+	return nil, fmt.Errorf("type %d not found", id)
+}
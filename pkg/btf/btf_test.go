@@ -0,0 +1,331 @@
+package btf
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	fastxz "github.com/therootcompany/xz"
+)
+
+// testBase returns base BTF with an example of every kind
+func testBase() *Spec {
+	s := NewSpec(nil)
+	intID := s.Add(&Type{Kind: KindInt, Name: "int", SizeType: 4, Extra: 1<<24 | 32})
+	s.Add(&Type{Kind: KindPtr, SizeType: uint32(intID)})
+	s.Add(&Type{Kind: KindArray, Array: &Array{Type: intID, IndexType: intID, Nelems: 16}})
+	listID := TypeID(s.NumTypes() + 1)
+	ptrListID := listID + 1
+	s.Add(&Type{Kind: KindStruct, Name: "list_head", SizeType: 16, Members: []Member{
+		{Name: "next", Type: ptrListID, Offset: 0},
+		{Name: "prev", Type: ptrListID, Offset: 64},
+	}})
+	s.Add(&Type{Kind: KindPtr, SizeType: uint32(listID)})
+	s.Add(&Type{Kind: KindUnion, Name: "u", SizeType: 4, Members: []Member{{Name: "a", Type: intID}}})
+	s.Add(&Type{Kind: KindEnum, Name: "e", SizeType: 4, Enums: []Enum{{Name: "A", Value: 1}, {Name: "B", Value: 0xffffffff}}})
+	s.Add(&Type{Kind: KindFwd, Name: "task_struct"})
+	s.Add(&Type{Kind: KindTypedef, Name: "pid_t", SizeType: uint32(intID)})
+	s.Add(&Type{Kind: KindVolatile, SizeType: uint32(intID)})
+	s.Add(&Type{Kind: KindConst, SizeType: uint32(intID)})
+	s.Add(&Type{Kind: KindRestrict, SizeType: uint32(intID)})
+	protoID := s.Add(&Type{Kind: KindFuncProto, SizeType: uint32(intID), Params: []Param{{Name: "x", Type: intID}}})
+	s.Add(&Type{Kind: KindFunc, Name: "f", SizeType: uint32(protoID), Linkage: 1})
+	varID := s.Add(&Type{Kind: KindVar, Name: "v", SizeType: uint32(intID), Extra: 1})
+	s.Add(&Type{Kind: KindDatasec, Name: ".data", SizeType: 4, Vars: []VarSecinfo{{Type: varID, Offset: 0, Size: 4}}})
+	s.Add(&Type{Kind: KindFloat, Name: "double", SizeType: 8})
+	s.Add(&Type{Kind: KindDeclTag, Name: "tag", SizeType: uint32(intID), Extra: 0xffffffff})
+	s.Add(&Type{Kind: KindTypeTag, Name: "user", SizeType: uint32(intID)})
+	s.Add(&Type{Kind: KindEnum64, Name: "e64", SizeType: 8, KindFlag: true, Enums: []Enum{{Name: "C", Value: 1 << 40}}})
+	return s
+}
+
+// testModule returns split BTF of base, with a struct that refers to itself
+// and to a base type
+func testModule(t *testing.T, base *Spec, name string) *Spec {
+	s := NewSpec(base)
+	start := TypeID(base.NumTypes() + 1)
+	s.Add(&Type{Kind: KindStruct, Name: "shared", SizeType: 16, Members: []Member{
+		{Name: "self", Type: start + 1},
+		{Name: "list", Type: 4, Offset: 64},
+	}})
+	s.Add(&Type{Kind: KindPtr, SizeType: uint32(start)})
+	s.Add(&Type{Kind: KindVar, Name: name, SizeType: uint32(start + 1)})
+
+	// round trip through the raw format
+	data, err := s.Marshal()
+	require.NoError(t, err)
+	parsed, err := Parse(data, base)
+	require.NoError(t, err)
+	return parsed
+}
+
+func TestRoundTrip(t *testing.T) {
+	base := testBase()
+	data, err := base.Marshal()
+	require.NoError(t, err)
+
+	parsed, err := Parse(data, nil)
+	require.NoError(t, err)
+	assert.Equal(t, base.Types(), parsed.Types())
+
+	again, err := parsed.Marshal()
+	require.NoError(t, err)
+	assert.Equal(t, data, again)
+}
+
+func TestSplit(t *testing.T) {
+	base := testBase()
+	data, err := base.Marshal()
+	require.NoError(t, err)
+	base, err = Parse(data, nil)
+	require.NoError(t, err)
+
+	mod := testModule(t, base, "mod_var")
+	assert.Equal(t, 3, mod.NumTypes())
+	typ, err := mod.TypeByID(TypeID(base.NumTypes() + 3))
+	require.NoError(t, err)
+	assert.Equal(t, "mod_var", typ.Name)
+	typ, err = mod.TypeByID(4)
+	require.NoError(t, err)
+	assert.Equal(t, "list_head", typ.Name)
+	_, err = mod.TypeByID(TypeID(base.NumTypes() + 4))
+	assert.Error(t, err)
+
+	// strings already in the base must not be added to the split strings
+	assert.Equal(t, "shared\x00self\x00list\x00mod_var\x00", string(mod.strings.data))
+}
+
+func TestMerge(t *testing.T) {
+	base := testBase()
+	data, err := base.Marshal()
+	require.NoError(t, err)
+	base, err = Parse(data, nil)
+	require.NoError(t, err)
+
+	mod1 := testModule(t, base, "var1")
+	mod2 := testModule(t, base, "var2")
+	merged, err := Merge(base, mod1, mod2)
+	require.NoError(t, err)
+
+	n := base.NumTypes()
+	require.Equal(t, n+4, merged.NumTypes())
+	assert.Equal(t, base.Types(), merged.Types()[:n])
+
+	out, err := merged.Marshal()
+	require.NoError(t, err)
+	parsed, err := Parse(out, nil)
+	require.NoError(t, err)
+	assert.Nil(t, parsed.Base())
+
+	shared, ptr := TypeID(n+1), TypeID(n+2)
+	typ, err := parsed.TypeByID(shared)
+	require.NoError(t, err)
+	assert.Equal(t, []Member{{Name: "self", Type: ptr}, {Name: "list", Type: 4, Offset: 64}}, typ.Members)
+	for i, name := range []string{"var1", "var2"} {
+		typ, err := parsed.TypeByID(TypeID(n + 3 + i))
+		require.NoError(t, err)
+		assert.Equal(t, name, typ.Name)
+		assert.Equal(t, uint32(ptr), typ.SizeType)
+	}
+
+	// base strings are kept as is, and module strings are appended
+	assert.True(t, bytes.HasPrefix(parsed.strings.data, base.strings.data))
+
+	_, err = Merge(base, testModule(t, testBase(), "other"))
+	assert.Error(t, err)
+}
+
+func TestMergeDedup(t *testing.T) {
+	base := testBase()
+	data, err := base.Marshal()
+	require.NoError(t, err)
+	base, err = Parse(data, nil)
+	require.NoError(t, err)
+	n := TypeID(base.NumTypes())
+
+	// a module which defines base types again, with forward declarations
+	mod := NewSpec(base)
+	mod.Add(&Type{Kind: KindInt, Name: "int", SizeType: 4, Extra: 1<<24 | 32})
+	mod.Add(&Type{Kind: KindFwd, Name: "list_head"})
+	mod.Add(&Type{Kind: KindPtr, SizeType: uint32(n + 2)})
+	mod.Add(&Type{Kind: KindStruct, Name: "list_head", SizeType: 16, Members: []Member{
+		{Name: "next", Type: n + 3},
+		{Name: "prev", Type: n + 3, Offset: 64},
+	}})
+	mod.Add(&Type{Kind: KindFwd, Name: "missing"})
+	mod.Add(&Type{Kind: KindPtr, SizeType: uint32(n + 5)})
+	mod.Add(&Type{Kind: KindStruct, Name: "mod", SizeType: 24, Members: []Member{
+		{Name: "list", Type: n + 4},
+		{Name: "a", Type: n + 1, Offset: 128},
+		{Name: "m", Type: n + 6, Offset: 160},
+	}})
+	// two different structs of the same name, and a forward declaration of it
+	other := NewSpec(base)
+	other.Add(&Type{Kind: KindStruct, Name: "mod", SizeType: 4, Members: []Member{{Name: "a", Type: 1}}})
+	other.Add(&Type{Kind: KindFwd, Name: "mod"})
+	other.Add(&Type{Kind: KindPtr, SizeType: uint32(n + 2)})
+
+	merged, err := Merge(base, mod, other)
+	require.NoError(t, err)
+	assert.Equal(t, base.Types(), merged.Types()[:n])
+	assert.Equal(t, []*Type{
+		{Kind: KindFwd, Name: "missing"},
+		{Kind: KindPtr, SizeType: uint32(n + 1)},
+		{Kind: KindStruct, Name: "mod", SizeType: 24, Members: []Member{
+			{Name: "list", Type: 4},
+			{Name: "a", Type: 1, Offset: 128},
+			{Name: "m", Type: n + 2, Offset: 160},
+		}},
+		{Kind: KindStruct, Name: "mod", SizeType: 4, Members: []Member{{Name: "a", Type: 1}}},
+		{Kind: KindFwd, Name: "mod"},
+		{Kind: KindPtr, SizeType: uint32(n + 5)},
+	}, merged.Types()[n:])
+	require.NoError(t, merged.CheckRefs())
+}
+
+func TestCheck(t *testing.T) {
+	base := testBase()
+	require.NoError(t, base.CheckRefs())
+	id, typ, err := base.TypeByName("list_head", KindStruct)
+	require.NoError(t, err)
+	assert.Equal(t, TypeID(4), id)
+	assert.Len(t, typ.Members, 2)
+	_, _, err = base.TypeByName("task_struct", KindStruct)
+	assert.Error(t, err)
+
+	mod := testModule(t, base, "mod_var")
+	require.NoError(t, mod.CheckRefs())
+	id, _, err = mod.TypeByName("shared", KindStruct)
+	require.NoError(t, err)
+	assert.Equal(t, TypeID(base.NumTypes()+1), id)
+
+	mod.Add(&Type{Kind: KindPtr, SizeType: 1000})
+	assert.Error(t, mod.CheckRefs())
+}
+
+func TestFirstDifference(t *testing.T) {
+	base := testBase()
+	data, err := base.Marshal()
+	require.NoError(t, err)
+	parsed, err := Parse(data, nil)
+	require.NoError(t, err)
+	assert.Equal(t, TypeID(0), FirstDifference(base, parsed, -1))
+
+	parsed.Add(&Type{Kind: KindPtr, SizeType: 1})
+	assert.Equal(t, TypeID(0), FirstDifference(base, parsed, base.NumTypes()))
+	assert.Equal(t, TypeID(base.NumTypes()+1), FirstDifference(base, parsed, -1))
+
+	parsed.Types()[3].Members[1].Offset = 32
+	assert.Equal(t, TypeID(4), FirstDifference(base, parsed, -1))
+}
+
+func TestParseErrors(t *testing.T) {
+	data, err := testBase().Marshal()
+	require.NoError(t, err)
+
+	_, err = Parse(data[:10], nil)
+	assert.Error(t, err)
+	_, err = Parse(append([]byte{0, 0}, data[2:]...), nil)
+	assert.Error(t, err)
+	// truncated string section
+	_, err = Parse(data[:len(data)-1], nil)
+	assert.Error(t, err)
+}
+
+// TestRawRoundTrip parses and re-encodes BTF generated by compilers, and
+// checks that the output is byte identical. testdata/list.btf is the .BTF
+// section of testdata/list.c compiled by gcc 12 with -gbtf, and the BTF of
+// the running kernel, generated by pahole, is used if it is exposed.
+func TestRawRoundTrip(t *testing.T) {
+	paths := []string{filepath.Join("testdata", "list.btf")}
+	if _, err := os.Stat("/sys/kernel/btf/vmlinux"); err == nil {
+		paths = append(paths, "/sys/kernel/btf/vmlinux")
+	}
+	for _, path := range paths {
+		t.Run(path, func(t *testing.T) {
+			data, err := os.ReadFile(path)
+			require.NoError(t, err)
+			spec, err := Parse(data, nil)
+			require.NoError(t, err)
+			require.NoError(t, spec.CheckRefs())
+			out, err := spec.Marshal()
+			require.NoError(t, err)
+			assert.True(t, bytes.Equal(data, out), "re-encoded BTF differs")
+		})
+	}
+}
+
+// TestArchiveRoundTrip parses and re-encodes BTF from archives generated by
+// pahole and bpftool, and checks that the output is byte identical. Set
+// BTFHUB_TEST_ARCHIVE to a directory with .btf.tar.xz files to run it.
+func TestArchiveRoundTrip(t *testing.T) {
+	dir := os.Getenv("BTFHUB_TEST_ARCHIVE")
+	if dir == "" {
+		t.Skip("BTFHUB_TEST_ARCHIVE is not set")
+	}
+	count := 0
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(path, ".btf.tar.xz") {
+			return err
+		}
+		count++
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			data := readArchivedBTF(t, path)
+			spec, err := Parse(data, nil)
+			require.NoError(t, err)
+			out, err := spec.Marshal()
+			require.NoError(t, err)
+			assert.True(t, bytes.Equal(data, out), "re-encoded BTF differs")
+		})
+		return nil
+	})
+	require.NoError(t, err)
+	require.NotZero(t, count, "no archives found")
+}
+
+// TestMergeCompat merges BTF generated by pahole and compares the result with
+// the output of bpftool btf merge. testdata/merge has the base BTF in
+// vmlinux, module BTF in modules/ and the bpftool output in merged.btf, and
+// BTFHUB_TEST_MERGE may be set to another directory with the same layout.
+func TestMergeCompat(t *testing.T) {
+	dir := os.Getenv("BTFHUB_TEST_MERGE")
+	if dir == "" {
+		dir = filepath.Join("testdata", "merge")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "merged.btf")); os.IsNotExist(err) {
+		t.Skipf("no bpftool output in %s", dir)
+	}
+	modules, err := filepath.Glob(filepath.Join(dir, "modules", "*"))
+	require.NoError(t, err)
+	merged, err := MergeFiles(filepath.Join(dir, "vmlinux"), modules)
+	require.NoError(t, err)
+	out, err := merged.Marshal()
+	require.NoError(t, err)
+	expected, err := os.ReadFile(filepath.Join(dir, "merged.btf"))
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal(expected, out), "merged BTF differs from bpftool output")
+}
+
+func readArchivedBTF(t *testing.T, path string) []byte {
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	xr, err := fastxz.NewReader(f, 0)
+	require.NoError(t, err)
+	tr := tar.NewReader(xr)
+	for {
+		hdr, err := tr.Next()
+		require.NoError(t, err)
+		if strings.HasSuffix(hdr.Name, ".btf") {
+			data, err := io.ReadAll(tr)
+			require.NoError(t, err)
+			return data
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package btf
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// CheckRefs checks that every type ID referenced by the types of the Spec
+// resolves, either to a type of the Spec or to a type of its base
+func (s *Spec) CheckRefs() error {
+	end := s.startID() + TypeID(len(s.types))
+	for i, t := range s.types {
+		var bad TypeID
+		t.visitRefs(func(id *TypeID) {
+			if *id >= end && bad == 0 {
+				bad = *id
+			}
+		})
+		if bad != 0 {
+			return fmt.Errorf("type %d (%s %s) references missing type %d", int(s.startID())+i, t.Kind, t.Name, bad)
+		}
+	}
+	return nil
+}
+
+// TypeByName returns the first type with the name and kind, looking up the
+// base first for split BTF
+func (s *Spec) TypeByName(name string, kind Kind) (TypeID, *Type, error) {
+	if s.base != nil {
+		if id, t, err := s.base.TypeByName(name, kind); err == nil {
+			return id, t, nil
+		}
+	}
+	for i, t := range s.types {
+		if t.Kind == kind && t.Name == name {
+			return s.startID() + TypeID(i), t, nil
+		}
+	}
+	return 0, nil, fmt.Errorf("%s %s not found", kind, name)
+}
+
+// FirstDifference returns the ID of the first of the first n types of the Specs
+// which differs, excluding the types of their bases, or 0 if they are
+// identical. Types are compared by value, so BTF with the same types and a
+// different string table is identical. A negative n compares every type.
+func FirstDifference(a, b *Spec, n int) TypeID {
+	if n < 0 {
+		n = max(len(a.types), len(b.types))
+	}
+	for i := 0; i < n; i++ {
+		if i >= len(a.types) && i >= len(b.types) {
+			return 0
+		}
+		if i >= len(a.types) || i >= len(b.types) || !reflect.DeepEqual(a.types[i], b.types[i]) {
+			return a.startID() + TypeID(i)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,97 @@
+package btf
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+)
+
+// Marshal encodes the Spec as raw BTF, with the type section followed by the
+// string section. Strings missing from the string section are appended to it.
+func (s *Spec) Marshal() ([]byte, error) {
+	bo := s.byteOrder
+	types := &bytes.Buffer{}
+	var b [4]byte
+	u32 := func(v uint32) {
+		bo.PutUint32(b[:], v)
+		types.Write(b[:])
+	}
+
+	for i, t := range s.types {
+		vlen := t.vlen()
+		if vlen > 0xffff {
+			return nil, fmt.Errorf("type %d: vlen %d is too large", int(s.startID())+i, vlen)
+		}
+		info := uint32(vlen) | uint32(t.Kind&0x1f)<<24
+		if t.KindFlag {
+			info |= 1 << 31
+		}
+		u32(s.strings.add(t.Name))
+		u32(info)
+		u32(t.SizeType)
+
+		switch t.Kind {
+		case KindInt, KindVar, KindDeclTag:
+			u32(t.Extra)
+		case KindArray:
+			if t.Array == nil {
+				return nil, fmt.Errorf("type %d: array without element type", int(s.startID())+i)
+			}
+			u32(uint32(t.Array.Type))
+			u32(uint32(t.Array.IndexType))
+			u32(t.Array.Nelems)
+		case KindStruct, KindUnion:
+			for _, m := range t.Members {
+				u32(s.strings.add(m.Name))
+				u32(uint32(m.Type))
+				u32(m.Offset)
+			}
+		case KindEnum:
+			for _, e := range t.Enums {
+				u32(s.strings.add(e.Name))
+				u32(uint32(e.Value))
+			}
+		case KindEnum64:
+			for _, e := range t.Enums {
+				u32(s.strings.add(e.Name))
+				u32(uint32(e.Value))
+				u32(uint32(e.Value >> 32))
+			}
+		case KindFuncProto:
+			for _, p := range t.Params {
+				u32(s.strings.add(p.Name))
+				u32(uint32(p.Type))
+			}
+		case KindDatasec:
+			for _, v := range t.Vars {
+				u32(uint32(v.Type))
+				u32(v.Offset)
+				u32(v.Size)
+			}
+		}
+	}
+
+	hdr := make([]byte, headerLen)
+	bo.PutUint16(hdr, btfMagic)
+	hdr[2] = btfVersion
+	bo.PutUint32(hdr[4:], headerLen)
+	bo.PutUint32(hdr[8:], 0)
+	bo.PutUint32(hdr[12:], uint32(types.Len()))
+	bo.PutUint32(hdr[16:], uint32(types.Len()))
+	bo.PutUint32(hdr[20:], uint32(len(s.strings.data)))
+
+	out := make([]byte, 0, headerLen+types.Len()+len(s.strings.data))
+	out = append(out, hdr...)
+	out = append(out, types.Bytes()...)
+	out = append(out, s.strings.data...)
+	return out, nil
+}
+
+// WriteFile encodes the Spec as raw BTF and writes it to a file
+func (s *Spec) WriteFile(path string) error {
+	data, err := s.Marshal()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
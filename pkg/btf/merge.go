@@ -0,0 +1,283 @@
+package btf
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// MergeFiles reads base BTF and the split BTF of kernel modules from files,
+// and merges them
+func MergeFiles(basePath string, modulePaths []string) (*Spec, error) {
+	base, err := LoadFile(basePath, nil)
+	if err != nil {
+		return nil, err
+	}
+	modules := make([]*Spec, 0, len(modulePaths))
+	for _, p := range modulePaths {
+		mod, err := LoadFile(p, base)
+		if err != nil {
+			return nil, err
+		}
+		modules = append(modules, mod)
+	}
+	return Merge(base, modules...)
+}
+
+// Merge combines base BTF and the split BTF of kernel modules into a single
+// standalone BTF. The base types keep their IDs, and module types are
+// appended in order. Module types which are structurally identical to a base
+// type or to an earlier module type, such as a type defined by several
+// modules, are deduplicated, and forward declarations of modules are resolved
+// to the struct or union of the same name, if there is exactly one.
+//
+// The string section of the base is kept as is, and the strings of the module
+// types are appended to it. The output is valid BTF with the same types as
+// the output of bpftool btf merge, but it is not byte-identical to it, as
+// libbpf orders types and strings differently when deduplicating them, so
+// archives of kernels with modules have different hashes than archives
+// merged by bpftool, which remains the default merger.
+func Merge(base *Spec, modules ...*Spec) (*Spec, error) {
+	if base.base != nil {
+		return nil, errors.New("merge: base BTF must not be split BTF")
+	}
+	merged := &Spec{
+		byteOrder: base.byteOrder,
+		types:     append([]*Type(nil), base.types...),
+		strings:   base.strings.copy(),
+	}
+	for i, mod := range modules {
+		if mod.base != base {
+			return nil, fmt.Errorf("merge: module %d is not split BTF of base", i)
+		}
+		modStart := mod.startID()
+		newStart := merged.startID() + TypeID(len(merged.types))
+		for _, t := range mod.types {
+			t = t.copy()
+			var err error
+			t.visitRefs(func(id *TypeID) {
+				if *id < modStart {
+					return
+				}
+				if int(*id-modStart) >= len(mod.types) {
+					err = fmt.Errorf("merge: module %d references unknown type %d", i, *id)
+					return
+				}
+				*id = *id - modStart + newStart
+			})
+			if err != nil {
+				return nil, err
+			}
+			merged.types = append(merged.types, t)
+		}
+	}
+	merged.types = resolveFwds(dedup(merged.types, len(base.types)), len(base.types))
+	return merged, nil
+}
+
+// dedup removes types which are structurally identical to an earlier type,
+// and remaps references to them. The first fixed types are never removed,
+// and keep their IDs, but later types which are identical to one of them are
+// removed.
+//
+// Types are partitioned by their local contents, and the partitions are
+// refined by the partitions of the types they reference until they are
+// stable. This finds identical types even when they reference each other in
+// cycles, e.g. struct list_head.
+func dedup(types []*Type, fixed int) []*Type {
+	n := len(types)
+	if n == fixed {
+		return types
+	}
+
+	// class returns the partition of a type ID. Void is its own partition.
+	classes := make([]int, n)
+	class := func(id TypeID) int {
+		if id == 0 {
+			return 0
+		}
+		return 1 + classes[id-1]
+	}
+
+	count := partition(classes, func(i int, key []byte) []byte {
+		return localKey(key, types[i])
+	})
+	for {
+		newClasses := make([]int, len(classes))
+		newCount := partition(newClasses, func(i int, key []byte) []byte {
+			key = binary.LittleEndian.AppendUint32(key, uint32(classes[i]))
+			types[i].visitRefs(func(id *TypeID) {
+				key = binary.LittleEndian.AppendUint32(key, uint32(class(*id)))
+			})
+			return key
+		})
+		classes = newClasses
+		if newCount == count {
+			break
+		}
+		count = newCount
+	}
+
+	// keep the fixed types, and the first type of every other partition
+	newIDs := make([]TypeID, n+1)
+	first := make([]TypeID, count)
+	out := types[:fixed:fixed]
+	for i, c := range classes {
+		id := TypeID(i + 1)
+		switch {
+		case i < fixed:
+			newIDs[id] = id
+			if first[c] == 0 {
+				first[c] = id
+			}
+		case first[c] != 0:
+			newIDs[id] = first[c]
+		default:
+			out = append(out, types[i])
+			newIDs[id] = TypeID(len(out))
+			first[c] = newIDs[id]
+		}
+	}
+	for _, t := range out[fixed:] {
+		t.visitRefs(func(id *TypeID) {
+			*id = newIDs[*id]
+		})
+	}
+	return out
+}
+
+// fwdKey is the name of a struct or union, and of its forward declarations
+type fwdKey struct {
+	name  string
+	union bool
+}
+
+func fwdKeyOf(t *Type) (fwdKey, bool) {
+	switch t.Kind {
+	case KindStruct, KindUnion:
+		return fwdKey{t.Name, t.Kind == KindUnion}, t.Name != ""
+	case KindFwd:
+		// the kind flag of a forward declaration is set for unions
+		return fwdKey{t.Name, t.KindFlag}, true
+	}
+	return fwdKey{}, false
+}
+
+// resolveFwds resolves the forward declarations after the first fixed types
+// of deduplicated types to the struct or union of the same name, and
+// deduplicates the types again. A forward declaration is resolved if all the
+// structs or unions of its name are identical once it is resolved, e.g. a
+// module struct which refers to itself through a forward declaration and the
+// same base struct.
+//
+// Forward declarations are tentatively replaced with a copy of the first
+// struct or union of their name, and the names whose structs are not all
+// deduplicated into one are dropped, until the remaining names are.
+func resolveFwds(types []*Type, fixed int) []*Type {
+	first := map[fwdKey]*Type{}
+	for _, t := range types {
+		if k, ok := fwdKeyOf(t); ok && t.Kind != KindFwd && first[k] == nil {
+			first[k] = t
+		}
+	}
+	names := map[fwdKey]bool{}
+	for _, t := range types[fixed:] {
+		if k, ok := fwdKeyOf(t); ok && t.Kind == KindFwd && first[k] != nil {
+			names[k] = true
+		}
+	}
+	for len(names) > 0 {
+		// dedup only changes the types after the fixed ones
+		trial := types[:fixed:fixed]
+		for _, t := range types[fixed:] {
+			if k, ok := fwdKeyOf(t); ok && t.Kind == KindFwd && names[k] {
+				t = first[k]
+			}
+			trial = append(trial, t.copy())
+		}
+		trial = dedup(trial, fixed)
+
+		count := map[fwdKey]int{}
+		for _, t := range trial {
+			if k, ok := fwdKeyOf(t); ok && names[k] {
+				count[k]++
+			}
+		}
+		resolved := true
+		for k := range names {
+			if count[k] != 1 {
+				delete(names, k)
+				resolved = false
+			}
+		}
+		if resolved {
+			return trial
+		}
+	}
+	return types
+}
+
+// partition assigns a class to every index, so that indexes with equal keys
+// share a class. Classes are numbered in order of first appearance. It
+// returns the number of classes.
+func partition(classes []int, key func(i int, buf []byte) []byte) int {
+	ids := map[string]int{}
+	var buf []byte
+	for i := range classes {
+		buf = key(i, buf[:0])
+		c, ok := ids[string(buf)]
+		if !ok {
+			c = len(ids)
+			ids[string(buf)] = c
+		}
+		classes[i] = c
+	}
+	return len(ids)
+}
+
+// localKey appends the contents of a type, excluding referenced types, to buf
+func localKey(buf []byte, t *Type) []byte {
+	u32 := func(v uint32) {
+		buf = binary.LittleEndian.AppendUint32(buf, v)
+	}
+	str := func(s string) {
+		u32(uint32(len(s)))
+		buf = append(buf, s...)
+	}
+
+	u32(uint32(t.Kind))
+	str(t.Name)
+	if t.KindFlag {
+		u32(1)
+	} else {
+		u32(0)
+	}
+	if !t.Kind.refersToType() {
+		u32(t.SizeType)
+	}
+	u32(t.Extra)
+	u32(uint32(t.Linkage))
+	if t.Array != nil {
+		u32(t.Array.Nelems)
+	}
+	u32(uint32(len(t.Members)))
+	for _, m := range t.Members {
+		str(m.Name)
+		u32(m.Offset)
+	}
+	u32(uint32(len(t.Enums)))
+	for _, e := range t.Enums {
+		str(e.Name)
+		buf = binary.LittleEndian.AppendUint64(buf, e.Value)
+	}
+	u32(uint32(len(t.Params)))
+	for _, p := range t.Params {
+		str(p.Name)
+	}
+	u32(uint32(len(t.Vars)))
+	for _, v := range t.Vars {
+		u32(v.Offset)
+		u32(v.Size)
+	}
+	return buf
+}
@@ -0,0 +1,109 @@
+package btf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// stringTable is the BTF string section. Offsets of split BTF strings
+// continue after the base string section.
+type stringTable struct {
+	base    *stringTable
+	data    []byte
+	offsets map[string]uint32
+}
+
+func newStringTable() *stringTable {
+	return &stringTable{data: []byte{0}, offsets: map[string]uint32{"": 0}}
+}
+
+func newSplitStringTable(base *stringTable) *stringTable {
+	return &stringTable{base: base, offsets: map[string]uint32{}}
+}
+
+func parseStringTable(data []byte) (*stringTable, error) {
+	if len(data) == 0 || data[0] != 0 {
+		return nil, errors.New("string section must start with an empty string")
+	}
+	return indexStrings(&stringTable{}, data)
+}
+
+func parseSplitStringTable(base *stringTable, data []byte) (*stringTable, error) {
+	return indexStrings(&stringTable{base: base}, data)
+}
+
+func indexStrings(st *stringTable, data []byte) (*stringTable, error) {
+	if len(data) > 0 && data[len(data)-1] != 0 {
+		return nil, errors.New("string section is not NUL terminated")
+	}
+	st.data = data
+	st.offsets = map[string]uint32{}
+	for off := 0; off < len(data); {
+		end := off + bytes.IndexByte(data[off:], 0)
+		s := string(data[off:end])
+		if _, ok := st.offsets[s]; !ok {
+			st.offsets[s] = st.start() + uint32(off)
+		}
+		off = end + 1
+	}
+	return st, nil
+}
+
+// start returns the offset of the first string of the table
+func (st *stringTable) start() uint32 {
+	if st.base == nil {
+		return 0
+	}
+	return st.base.start() + uint32(len(st.base.data))
+}
+
+func (st *stringTable) lookup(off uint32) (string, error) {
+	start := st.start()
+	if off < start {
+		return st.base.lookup(off)
+	}
+	rel := off - start
+	if rel >= uint32(len(st.data)) {
+		return "", fmt.Errorf("string offset %d out of bounds", off)
+	}
+	end := bytes.IndexByte(st.data[rel:], 0)
+	return string(st.data[rel : int(rel)+end]), nil
+}
+
+func (st *stringTable) find(s string) (uint32, bool) {
+	if st.base != nil {
+		if off, ok := st.base.find(s); ok {
+			return off, true
+		}
+	}
+	off, ok := st.offsets[s]
+	return off, ok
+}
+
+// add returns the offset of s, appending it to the table if necessary
+func (st *stringTable) add(s string) uint32 {
+	if off, ok := st.find(s); ok {
+		return off
+	}
+	off := st.start() + uint32(len(st.data))
+	st.data = append(st.data, s...)
+	st.data = append(st.data, 0)
+	st.offsets[s] = off
+	return off
+}
+
+// copy returns a standalone copy of a table without a base
+func (st *stringTable) copy() *stringTable {
+	if st.base != nil {
+		panic("copy of split string table")
+	}
+	c := &stringTable{
+		data:    append([]byte(nil), st.data...),
+		offsets: make(map[string]uint32, len(st.offsets)),
+	}
+	for s, off := range st.offsets {
+		c.offsets[s] = off
+	}
+	return c
+}
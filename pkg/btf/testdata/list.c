@@ -0,0 +1,33 @@
+struct list_head {
+	struct list_head *next, *prev;
+};
+
+struct task;
+
+enum state { RUNNING, SLEEPING = 2 };
+
+struct item {
+	struct list_head list;
+	struct task *owner;
+	const char *name;
+	unsigned long flags[4];
+	enum state st;
+	union {
+		int id;
+		float weight;
+	};
+	unsigned int refs : 4, dead : 1;
+};
+
+typedef int (*visit_fn)(struct item *item, void *data);
+
+struct item items[8];
+volatile int nr_items;
+
+int visit(visit_fn fn, void *data)
+{
+	for (int i = 0; i < nr_items; i++)
+		if (fn(&items[i], data))
+			return 1;
+	return 0;
+}
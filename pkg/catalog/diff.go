@@ -0,0 +1,99 @@
+package catalog
+
+import (
+	"maps"
+	"reflect"
+	"slices"
+)
+
+// ChangeKind is the kind of change of an entry between two catalogs
+type ChangeKind string
+
+const (
+	ChangeAdded   ChangeKind = "added"
+	ChangeRemoved ChangeKind = "removed"
+	// ChangeChanged is an entry with a different hash or other fields
+	ChangeChanged ChangeKind = "changed"
+)
+
+// Change is an entry which differs between two catalogs. Old is not set for
+// added entries, and New is not set for removed entries.
+type Change struct {
+	Kind    ChangeKind `json:"kind"`
+	Version string     `json:"version"`
+	Old     *BTFEntry  `json:"old,omitempty"`
+	New     *BTFEntry  `json:"new,omitempty"`
+}
+
+// DiffGroup is the changes of a release, with their counts
+type DiffGroup struct {
+	Arch    string   `json:"arch"`
+	Distro  string   `json:"distro"`
+	Release string   `json:"release"`
+	Added   int      `json:"added"`
+	Removed int      `json:"removed"`
+	Changed int      `json:"changed"`
+	Changes []Change `json:"changes"`
+}
+
+// Diff returns the entries which differ between the before and after
+// catalogs, grouped by arch, distro and release. Groups and changes are
+// sorted, and groups without changes are omitted.
+func Diff(before, after *BTFCatalog) []DiffGroup {
+	groups := []DiffGroup{}
+	for _, arch := range unionKeys(before.Archs, after.Archs) {
+		oldArch, newArch := before.Archs[arch], after.Archs[arch]
+		for _, distro := range unionKeys(oldArch, newArch) {
+			oldDistro, newDistro := oldArch[distro], newArch[distro]
+			for _, release := range unionKeys(oldDistro, newDistro) {
+				g := diffRelease(oldDistro[release], newDistro[release])
+				if len(g.Changes) == 0 {
+					continue
+				}
+				g.Arch, g.Distro, g.Release = arch, distro, release
+				groups = append(groups, g)
+			}
+		}
+	}
+	return groups
+}
+
+func diffRelease(before, after BTFReleaseCatalog) DiffGroup {
+	var g DiffGroup
+	for _, version := range unionKeys(before, after) {
+		oldEntry, inOld := before[version]
+		newEntry, inNew := after[version]
+		switch {
+		case !inOld:
+			g.Added++
+			g.Changes = append(g.Changes, Change{Kind: ChangeAdded, Version: version, New: &newEntry})
+		case !inNew:
+			g.Removed++
+			g.Changes = append(g.Changes, Change{Kind: ChangeRemoved, Version: version, Old: &oldEntry})
+		case !oldEntry.equal(newEntry):
+			g.Changed++
+			g.Changes = append(g.Changes, Change{Kind: ChangeChanged, Version: version, Old: &oldEntry, New: &newEntry})
+		}
+	}
+	return g
+}
+
+func (entry BTFEntry) equal(other BTFEntry) bool {
+	if !entry.GeneratedAt.Equal(other.GeneratedAt) {
+		return false
+	}
+	entry.GeneratedAt = other.GeneratedAt
+	return reflect.DeepEqual(entry, other)
+}
+
+// unionKeys returns the sorted keys of both maps
+func unionKeys[V any](a, b map[string]V) []string {
+	keys := slices.Collect(maps.Keys(a))
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+	return keys
+}
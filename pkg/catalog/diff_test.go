@@ -0,0 +1,42 @@
+package catalog
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff(t *testing.T) {
+	before := &BTFCatalog{Archs: map[string]BTFArchCatalog{
+		"x86_64": {"amzn": {
+			"2":    {"same": {SHA256: testHash1}, "removed": {SHA256: testHash1}, "rehashed": {SHA256: testHash1}, "resized": {SHA256: testHash1}},
+			"2018": {"same": {SHA256: testHash1}},
+		}},
+	}}
+	after := &BTFCatalog{Archs: map[string]BTFArchCatalog{
+		"x86_64": {"amzn": {
+			"2":    {"same": {SHA256: testHash1}, "added": {SHA256: testHash2}, "rehashed": {SHA256: testHash2}, "resized": {SHA256: testHash1, Size: 10}},
+			"2018": {"same": {SHA256: testHash1}},
+		}},
+		"s390x": {"rhel": {"8": {"added": {SHA256: testHash1}}}},
+	}}
+
+	groups := Diff(before, after)
+	assert.Equal(t, []DiffGroup{
+		{
+			Arch: "s390x", Distro: "rhel", Release: "8", Added: 1,
+			Changes: []Change{{Kind: ChangeAdded, Version: "added", New: &BTFEntry{SHA256: testHash1}}},
+		},
+		{
+			Arch: "x86_64", Distro: "amzn", Release: "2", Added: 1, Removed: 1, Changed: 2,
+			Changes: []Change{
+				{Kind: ChangeAdded, Version: "added", New: &BTFEntry{SHA256: testHash2}},
+				{Kind: ChangeChanged, Version: "rehashed", Old: &BTFEntry{SHA256: testHash1}, New: &BTFEntry{SHA256: testHash2}},
+				{Kind: ChangeRemoved, Version: "removed", Old: &BTFEntry{SHA256: testHash1}},
+				{Kind: ChangeChanged, Version: "resized", Old: &BTFEntry{SHA256: testHash1}, New: &BTFEntry{SHA256: testHash1, Size: 10}},
+			},
+		},
+	}, groups)
+
+	assert.Empty(t, Diff(after, after))
+}
@@ -0,0 +1,184 @@
+package catalog
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+)
+
+const sha256HexLen = sha256.Size * 2
+
+// DefaultFormat is the format of the archives of entries without a format
+const DefaultFormat = "tar.xz"
+
+// ParseEntry parses a hash file, which is either a JSON BTFEntry, or only the
+// hex SHA256 hash of the archive in older hash directories. It returns false
+// if the file has no valid SHA256 hash.
+func ParseEntry(data []byte) (BTFEntry, bool) {
+	var entry BTFEntry
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return BTFEntry{}, false
+		}
+	} else {
+		entry.SHA256 = string(data)
+	}
+	if len(entry.SHA256) != sha256HexLen {
+		return BTFEntry{}, false
+	}
+	if _, err := hex.DecodeString(entry.SHA256); err != nil {
+		return BTFEntry{}, false
+	}
+	return entry, true
+}
+
+// WriteEntry writes entry as a hash file to path, creating directories as
+// necessary
+func WriteEntry(path string, entry BTFEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("marshal entry: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// BlobKey returns the key of the archive of a BTF in a format in the
+// content-addressed layout, both in the archive directory and in the object
+// store. Kernel versions with identical BTF share the blob, and have a pointer
+// file with their entry in the archive directory instead of their own archive.
+func BlobKey(btfSHA256 string, format string) string {
+	return path.Join("blobs", "sha256", btfSHA256[:2], btfSHA256+".btf."+format)
+}
+
+// ArchiveFormat returns the format of the archive of the entry
+func (entry BTFEntry) ArchiveFormat() string {
+	if entry.Format == "" {
+		return DefaultFormat
+	}
+	return entry.Format
+}
+
+// Archives returns the archive of the entry, followed by its variants
+func (entry BTFEntry) Archives() []BTFVariant {
+	archives := []BTFVariant{{
+		Format: entry.ArchiveFormat(),
+		SHA256: entry.SHA256,
+		Size:   entry.Size,
+		Key:    entry.Key,
+	}}
+	return append(archives, entry.Variants...)
+}
+
+// SetArchive sets the hash, size and key of the archive in the format of
+// archive, which is either the archive of the entry or one of its variants
+func (entry *BTFEntry) SetArchive(archive BTFVariant) {
+	if archive.Format == entry.ArchiveFormat() {
+		entry.SHA256, entry.Size, entry.Key = archive.SHA256, archive.Size, archive.Key
+		return
+	}
+	for i, v := range entry.Variants {
+		if v.Format == archive.Format {
+			entry.Variants[i] = archive
+			return
+		}
+	}
+	entry.Variants = append(entry.Variants, archive)
+}
+
+// Archive returns the archive of the entry in a format, which is either the
+// archive of the entry or one of its variants
+func (entry BTFEntry) Archive(format string) (BTFVariant, bool) {
+	for _, archive := range entry.Archives() {
+		if archive.Format == format {
+			return archive, true
+		}
+	}
+	return BTFVariant{}, false
+}
+
+// Mismatch returns the first archive of the entry whose hash differs from the
+// archive of other in the same format, and the archive of other. Archives in
+// formats which only one of the entries has do not mismatch.
+func (entry BTFEntry) Mismatch(other BTFEntry) (BTFVariant, BTFVariant, bool) {
+	for _, archive := range entry.Archives() {
+		if o, ok := other.Archive(archive.Format); ok && o.SHA256 != archive.SHA256 {
+			return archive, o, true
+		}
+	}
+	return BTFVariant{}, BTFVariant{}, false
+}
+
+// merge returns the entry with the fields which are not set filled from other,
+// and with the archives of other in the formats the entry does not have as
+// variants. The archives of both entries must not conflict.
+func (entry BTFEntry) merge(other BTFEntry) BTFEntry {
+	return entry.mergeProvenance(other).mergeArchives(other, false)
+}
+
+// replace returns the entry with the archives of other, replacing its archives
+// in the same formats, and with the provenance of other, keeping the fields
+// which other does not set. The archive of the entry keeps its format.
+func (entry BTFEntry) replace(other BTFEntry) BTFEntry {
+	replaced := other.mergeProvenance(entry)
+	replaced.SHA256, replaced.Size, replaced.Key = entry.SHA256, entry.Size, entry.Key
+	replaced.Format, replaced.Variants = entry.Format, entry.Variants
+	return replaced.mergeArchives(other, true)
+}
+
+// mergeArchives adds the archives of other to the entry. Archives in formats
+// the entry already has are replaced if replace is set and their hashes
+// differ, otherwise only their size and key are filled from other.
+func (entry BTFEntry) mergeArchives(other BTFEntry, replace bool) BTFEntry {
+	// the variants may be shared with the entry in the catalog
+	entry.Variants = slices.Clone(entry.Variants)
+	for _, archive := range other.Archives() {
+		if existing, ok := entry.Archive(archive.Format); ok && (!replace || existing.SHA256 == archive.SHA256) {
+			if existing.Size == 0 {
+				existing.Size = archive.Size
+			}
+			if existing.Key == "" {
+				existing.Key = archive.Key
+			}
+			archive = existing
+		}
+		entry.SetArchive(archive)
+	}
+	return entry
+}
+
+// mergeProvenance returns the entry with the fields other than its archives
+// which are not set filled from other
+func (entry BTFEntry) mergeProvenance(other BTFEntry) BTFEntry {
+	if entry.UncompressedSize == 0 {
+		entry.UncompressedSize = other.UncompressedSize
+	}
+	if entry.BTFSHA256 == "" {
+		entry.BTFSHA256 = other.BTFSHA256
+	}
+	if entry.GeneratedAt.IsZero() {
+		entry.GeneratedAt = other.GeneratedAt
+	}
+	if entry.SourcePackage == "" {
+		entry.SourcePackage = other.SourcePackage
+	}
+	if entry.SourceURL == "" {
+		entry.SourceURL = other.SourceURL
+	}
+	if entry.PaholeVersion == "" {
+		entry.PaholeVersion = other.PaholeVersion
+	}
+	if entry.Merger == "" {
+		entry.Merger = other.Merger
+	}
+	entry.HasModules = entry.HasModules || other.HasModules
+	return entry
+}
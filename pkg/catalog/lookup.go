@@ -0,0 +1,116 @@
+package catalog
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// HostKey is the catalog key of the BTF of a host
+type HostKey struct {
+	Arch    string `json:"arch"`
+	Distro  string `json:"distro"`
+	Release string `json:"release"`
+	Version string `json:"version"`
+}
+
+// ArchivePath is the path of the archive of the catalog entry of the key in the
+// archive directory and in the object store
+func (k HostKey) ArchivePath(entry BTFEntry) string {
+	if entry.Key != "" {
+		return entry.Key
+	}
+	return path.Join(k.Distro, k.Release, k.Arch, k.Version+".btf."+entry.ArchiveFormat())
+}
+
+// ParseOSRelease parses the KEY=value lines of /etc/os-release
+func ParseOSRelease(data []byte) map[string]string {
+	fields := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		} else {
+			value = strings.Trim(value, `'"`)
+		}
+		fields[key] = value
+	}
+	return fields
+}
+
+// archAliases maps uname -m to catalog architectures
+var archAliases = map[string]string{
+	"amd64":   "x86_64",
+	"aarch64": "arm64",
+}
+
+// distroAliases maps os-release IDs to catalog distros
+var distroAliases = map[string]string{
+	// Leap 42 and older
+	"opensuse": "opensuse-leap",
+}
+
+// NewHostKey returns the catalog key of a host from the fields of its
+// os-release, and its uname release and machine
+func NewHostKey(osRelease map[string]string, unameRelease, unameMachine string) (HostKey, error) {
+	id, versionID := osRelease["ID"], osRelease["VERSION_ID"]
+	if id == "" || versionID == "" {
+		return HostKey{}, fmt.Errorf("os-release: ID and VERSION_ID must be set")
+	}
+	if unameRelease == "" || unameMachine == "" {
+		return HostKey{}, fmt.Errorf("uname release and machine must be set")
+	}
+
+	key := HostKey{
+		Arch:    unameMachine,
+		Distro:  id,
+		Release: versionID,
+		Version: strings.TrimSpace(unameRelease),
+	}
+	if arch, ok := archAliases[key.Arch]; ok {
+		key.Arch = arch
+	}
+	if distro, ok := distroAliases[key.Distro]; ok {
+		key.Distro = distro
+	}
+
+	switch key.Distro {
+	case "amzn", "centos", "ol", "rhel":
+		// only major releases are in the catalog, and Amazon Linux 2018.03
+		// is 2018
+		key.Release, _, _ = strings.Cut(key.Release, ".")
+	case "sles":
+		// SLES GA releases have no service pack
+		if !strings.Contains(key.Release, ".") {
+			key.Release += ".0"
+		}
+	case "ubuntu", "debian":
+		// accept debug package names, which are named as in
+		// launchpad.go and debian.go
+		key.Version = strings.TrimPrefix(key.Version, "linux-image-")
+		key.Version = strings.TrimPrefix(key.Version, "unsigned-")
+		key.Version = strings.TrimSuffix(key.Version, "-dbgsym")
+		key.Version = strings.TrimSuffix(key.Version, "-dbg")
+	}
+	// uname -r is the BTF file name of the other distros: RPM based distros
+	// include the architecture, and SUSE drops the build counter of the
+	// package version, as uname does
+	return key, nil
+}
+
+// Lookup returns the entry of a host key, and whether it exists
+func (catalog *BTFCatalog) Lookup(key HostKey) (BTFEntry, bool) {
+	entry, ok := catalog.Entries(key.Arch, key.Distro, key.Release)[key.Version]
+	return entry, ok
+}
@@ -0,0 +1,74 @@
+package catalog
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseOSRelease(t *testing.T) {
+	data := []byte(`NAME="Amazon Linux"
+VERSION="2"
+# comment
+ID="amzn"
+ID_LIKE='centos rhel fedora'
+VERSION_ID=2
+PRETTY_NAME="Amazon \"Linux\" 2"
+`)
+	assert.Equal(t, map[string]string{
+		"NAME":        "Amazon Linux",
+		"VERSION":     "2",
+		"ID":          "amzn",
+		"ID_LIKE":     "centos rhel fedora",
+		"VERSION_ID":  "2",
+		"PRETTY_NAME": `Amazon "Linux" 2`,
+	}, ParseOSRelease(data))
+}
+
+func TestNewHostKey(t *testing.T) {
+	for name, tc := range map[string]struct {
+		id, versionID, release, machine string
+		expected                        HostKey
+	}{
+		"amzn2":       {"amzn", "2", "4.14.355-276.639.amzn2.x86_64", "x86_64", HostKey{"x86_64", "amzn", "2", "4.14.355-276.639.amzn2.x86_64"}},
+		"amzn2018":    {"amzn", "2018.03", "4.14.355-196.647.amzn1.x86_64", "x86_64", HostKey{"x86_64", "amzn", "2018", "4.14.355-196.647.amzn1.x86_64"}},
+		"rhel arm64":  {"rhel", "8.10", "4.18.0-553.el8_10.aarch64", "aarch64", HostKey{"arm64", "rhel", "8", "4.18.0-553.el8_10.aarch64"}},
+		"rhel s390x":  {"rhel", "8.10", "4.18.0-553.el8_10.s390x", "s390x", HostKey{"s390x", "rhel", "8", "4.18.0-553.el8_10.s390x"}},
+		"sles ga":     {"sles", "15", "4.12.14-150.78-default", "x86_64", HostKey{"x86_64", "sles", "15.0", "4.12.14-150.78-default"}},
+		"sles sp":     {"sles", "15.3", "5.3.18-150300.59.87-default", "ppc64le", HostKey{"ppc64le", "sles", "15.3", "5.3.18-150300.59.87-default"}},
+		"leap 42":     {"opensuse", "15.0", "4.12.14-lp150.12.82-default", "x86_64", HostKey{"x86_64", "opensuse-leap", "15.0", "4.12.14-lp150.12.82-default"}},
+		"ubuntu":      {"ubuntu", "20.04", "5.4.0-1097-aws", "x86_64", HostKey{"x86_64", "ubuntu", "20.04", "5.4.0-1097-aws"}},
+		"ubuntu ddeb": {"ubuntu", "20.04", "linux-image-unsigned-5.4.0-1097-aws-dbgsym", "x86_64", HostKey{"x86_64", "ubuntu", "20.04", "5.4.0-1097-aws"}},
+		"debian":      {"debian", "10", "4.19.0-27-cloud-amd64", "x86_64", HostKey{"x86_64", "debian", "10", "4.19.0-27-cloud-amd64"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			key, err := NewHostKey(map[string]string{"ID": tc.id, "VERSION_ID": tc.versionID}, tc.release, tc.machine)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, key)
+		})
+	}
+
+	_, err := NewHostKey(map[string]string{"ID": "amzn"}, "4.14.355-276.639.amzn2.x86_64", "x86_64")
+	assert.Error(t, err)
+	_, err = NewHostKey(map[string]string{"ID": "amzn", "VERSION_ID": "2"}, "", "x86_64")
+	assert.Error(t, err)
+}
+
+func TestLookup(t *testing.T) {
+	catalog := &BTFCatalog{Archs: map[string]BTFArchCatalog{
+		"x86_64": {"amzn": {"2": {"4.14.355-276.639.amzn2.x86_64": {SHA256: testHash1}}}},
+	}}
+	key := HostKey{"x86_64", "amzn", "2", "4.14.355-276.639.amzn2.x86_64"}
+	entry, ok := catalog.Lookup(key)
+	require.True(t, ok)
+	assert.Equal(t, testHash1, entry.SHA256)
+	assert.Equal(t, "amzn/2/x86_64/4.14.355-276.639.amzn2.x86_64.btf.tar.xz", key.ArchivePath(entry))
+	assert.Equal(t, "amzn/2/x86_64/4.14.355-276.639.amzn2.x86_64.btf.tar.zst", key.ArchivePath(BTFEntry{Format: "tar.zst"}))
+	blob := BlobKey(testHash2, "tar.zst")
+	assert.Equal(t, blob, key.ArchivePath(BTFEntry{Format: "tar.zst", Key: blob}))
+
+	_, ok = catalog.Lookup(HostKey{"arm64", "amzn", "2", "4.14.355-276.639.amzn2.x86_64"})
+	assert.False(t, ok)
+	assert.Empty(t, catalog.Archs["arm64"], "lookup must not create entries")
+}
@@ -0,0 +1,108 @@
+package catalog
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Conflict is a kernel version with different hashes in two merged sources
+type Conflict struct {
+	Arch    string `json:"arch"`
+	Distro  string `json:"distro"`
+	Release string `json:"release"`
+	Version string `json:"version"`
+	// Format is the format of the conflicting archives, if it is not
+	// DefaultFormat
+	Format string `json:"format,omitempty"`
+	// SHA256 is the hash kept in the merged catalog, and ConflictingSHA256
+	// the hash from Source which was not merged
+	SHA256            string `json:"sha256"`
+	ConflictingSHA256 string `json:"conflicting_sha256"`
+	Source            string `json:"source"`
+}
+
+// Merge merges the entries of other into the catalog. Entries with the same
+// hash are merged, and entries with a different hash are kept and returned as
+// conflicts, with source as their Source.
+func (catalog *BTFCatalog) Merge(other *BTFCatalog, source string) []Conflict {
+	var conflicts []Conflict
+	for _, arch := range slices.Sorted(maps.Keys(other.Archs)) {
+		for _, distro := range slices.Sorted(maps.Keys(other.Archs[arch])) {
+			for _, release := range slices.Sorted(maps.Keys(other.Archs[arch][distro])) {
+				releaseCatalog := other.Archs[arch][distro][release]
+				for _, version := range slices.Sorted(maps.Keys(releaseCatalog)) {
+					entry := releaseCatalog[version]
+					if existing, conflicting, ok := catalog.putEntry(arch, distro, release, version, entry, false); !ok {
+						conflicts = append(conflicts, Conflict{
+							Arch: arch, Distro: distro, Release: release, Version: version, Format: formatOf(existing),
+							SHA256: existing.SHA256, ConflictingSHA256: conflicting.SHA256, Source: source,
+						})
+					}
+				}
+			}
+		}
+	}
+	return conflicts
+}
+
+// formatOf returns the format of an archive, or nothing for DefaultFormat
+func formatOf(archive BTFVariant) string {
+	if archive.Format == DefaultFormat {
+		return ""
+	}
+	return archive.Format
+}
+
+// MergeHashDir merges the hash files of hashDir into the catalog, like Update,
+// but returns the conflicts instead of failing on the first one
+func (catalog *BTFCatalog) MergeHashDir(ctx context.Context, hashDir string) ([]Conflict, error) {
+	var conflicts []Conflict
+	err := walkHashes(ctx, os.DirFS(hashDir), func(entryPath string, entry BTFEntry) error {
+		parts := strings.Split(entryPath, "/")
+		if len(parts) != 4 {
+			// ignore files that don't match the layout
+			return nil
+		}
+		arch, distro, release, version := parts[0], parts[1], parts[2], parts[3]
+		if existing, conflicting, ok := catalog.putEntry(arch, distro, release, version, entry, false); !ok {
+			conflicts = append(conflicts, Conflict{
+				Arch: arch, Distro: distro, Release: release, Version: version, Format: formatOf(existing),
+				SHA256: existing.SHA256, ConflictingSHA256: conflicting.SHA256, Source: filepath.Join(hashDir, entryPath),
+			})
+		}
+		return nil
+	})
+	return conflicts, err
+}
+
+// MergeFiles merges catalog files and hash directories into a new catalog, in
+// order, so the first source wins conflicts
+func MergeFiles(ctx context.Context, sources []string) (*BTFCatalog, []Conflict, error) {
+	merged := &BTFCatalog{SchemaVersion: SchemaVersion}
+	var conflicts []Conflict
+	for _, source := range sources {
+		info, err := os.Stat(source)
+		if err != nil {
+			return nil, nil, err
+		}
+		if info.IsDir() {
+			c, err := merged.MergeHashDir(ctx, source)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: %w", source, err)
+			}
+			conflicts = append(conflicts, c...)
+			continue
+		}
+		other, err := Read(source)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", source, err)
+		}
+		conflicts = append(conflicts, merged.Merge(other, source)...)
+	}
+	return merged, conflicts, nil
+}
@@ -0,0 +1,51 @@
+package catalog
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeFiles(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.json")
+	require.NoError(t, Write(a, &BTFCatalog{Archs: map[string]BTFArchCatalog{
+		"x86_64": {"amzn": {"2": {"v1": {SHA256: testHash1}, "v2": {SHA256: testHash1}}}},
+	}}))
+	b := filepath.Join(dir, "b.json")
+	require.NoError(t, Write(b, &BTFCatalog{Archs: map[string]BTFArchCatalog{
+		"x86_64": {"amzn": {"2": {"v1": {SHA256: testHash1, Size: 10}, "v2": {SHA256: testHash2}}}},
+		"arm64":  {"amzn": {"2": {"v3": {SHA256: testHash2}}}},
+	}}))
+	hashDir := filepath.Join(dir, "hashes")
+	require.NoError(t, WriteEntry(filepath.Join(hashDir, "s390x/rhel/8/v4"), BTFEntry{SHA256: testHash1}))
+	require.NoError(t, WriteEntry(filepath.Join(hashDir, "x86_64/amzn/2/v1"), BTFEntry{SHA256: testHash2}))
+
+	merged, conflicts, err := MergeFiles(t.Context(), []string{a, b, hashDir})
+	require.NoError(t, err)
+	assert.Equal(t, []Conflict{
+		{Arch: "x86_64", Distro: "amzn", Release: "2", Version: "v2", SHA256: testHash1, ConflictingSHA256: testHash2, Source: b},
+		{Arch: "x86_64", Distro: "amzn", Release: "2", Version: "v1", SHA256: testHash1, ConflictingSHA256: testHash2, Source: filepath.Join(hashDir, "x86_64/amzn/2/v1")},
+	}, conflicts)
+	assert.Equal(t, BTFEntry{SHA256: testHash1, Size: 10}, merged.Archs["x86_64"]["amzn"]["2"]["v1"])
+	assert.Equal(t, testHash1, merged.GetHash("x86_64", "amzn", "2", "v2"))
+	assert.Equal(t, testHash2, merged.GetHash("arm64", "amzn", "2", "v3"))
+	assert.Equal(t, testHash1, merged.GetHash("s390x", "rhel", "8", "v4"))
+
+	_, _, err = MergeFiles(t.Context(), []string{filepath.Join(dir, "missing.json")})
+	assert.Error(t, err)
+
+	// Write leaves no temporary files behind
+	out := filepath.Join(dir, "out", "catalog.json")
+	require.NoError(t, os.MkdirAll(filepath.Dir(out), 0755))
+	require.NoError(t, Write(out, merged))
+	entries, err := os.ReadDir(filepath.Dir(out))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	info, err := entries[0].Info()
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0644), info.Mode().Perm())
+}
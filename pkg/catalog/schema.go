@@ -0,0 +1,117 @@
+package catalog
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// SchemaVersion is the version of the catalog format written by this version
+// of btfhub. Catalogs without a schema_version are version 1.
+const SchemaVersion = 3
+
+// migration upgrades a catalog document by one schema version, in place
+type migration func(doc map[string]json.RawMessage) error
+
+// migrations[i] upgrades a document from version i+1 to version i+2
+var migrations = []migration{
+	// 1 -> 2: schema_version is added, the rest of the format is unchanged
+	func(map[string]json.RawMessage) error { return nil },
+	// 2 -> 3: architectures other than x86_64 and arm64 are allowed, which
+	// version 2 readers would drop when rewriting the catalog
+	func(map[string]json.RawMessage) error { return nil },
+}
+
+// Parse decodes a catalog, upgrading it to the latest schema version. It
+// returns the schema version of data, and an error for unknown versions.
+func Parse(data []byte) (*BTFCatalog, int, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, 0, err
+	}
+	if doc == nil {
+		return nil, 0, fmt.Errorf("catalog is not a JSON object")
+	}
+
+	version := 1
+	if raw, ok := doc["schema_version"]; ok {
+		if err := json.Unmarshal(raw, &version); err != nil {
+			return nil, 0, fmt.Errorf("schema_version: %s", err)
+		}
+	}
+	if version < 1 || version > SchemaVersion {
+		return nil, version, fmt.Errorf("unsupported schema version %d, this btfhub supports versions 1 to %d", version, SchemaVersion)
+	}
+
+	for v := version; v < SchemaVersion; v++ {
+		if err := migrations[v-1](doc); err != nil {
+			return nil, version, fmt.Errorf("migrate schema version %d to %d: %s", v, v+1, err)
+		}
+	}
+	doc["schema_version"] = json.RawMessage(fmt.Sprint(SchemaVersion))
+
+	migrated, err := json.Marshal(doc)
+	if err != nil {
+		return nil, version, err
+	}
+	catalog := &BTFCatalog{}
+	if err := json.Unmarshal(migrated, catalog); err != nil {
+		return nil, version, err
+	}
+	return catalog, version, nil
+}
+
+// Write writes the catalog to a file in the latest schema version. The file
+// is replaced atomically, so readers never see a partial catalog.
+func Write(catalogPath string, catalog *BTFCatalog) error {
+	catalog.SchemaVersion = SchemaVersion
+	catalogData, err := json.MarshalIndent(catalog, "", "    ")
+	if err != nil {
+		return fmt.Errorf("marshal catalog: %s", err)
+	}
+	if err := writeFileAtomic(catalogPath, catalogData); err != nil {
+		return fmt.Errorf("write catalog json: %s", err)
+	}
+	return nil
+}
+
+// writeFileAtomic writes data to a temporary file next to path, and renames
+// it to path
+func writeFileAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Chmod(0644); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// Migrate rewrites a catalog file in the latest schema version. It returns
+// the schema version the file had.
+func Migrate(catalogPath string) (int, error) {
+	data, err := os.ReadFile(catalogPath)
+	if err != nil {
+		return 0, fmt.Errorf("read catalog json: %s", err)
+	}
+	catalog, version, err := Parse(data)
+	if err != nil {
+		return version, fmt.Errorf("%s: %s", catalogPath, err)
+	}
+	return version, Write(catalogPath, catalog)
+}
@@ -0,0 +1,52 @@
+package catalog
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSchemaVersion(t *testing.T) {
+	v1 := `{"x86_64": {"amzn": {"2": {"4.14.355-276.639.amzn2.x86_64": {"sha256": "` + testHash1 + `"}}}}, "arm64": {}}`
+	catalog, version, err := Parse([]byte(v1))
+	require.NoError(t, err)
+	assert.Equal(t, 1, version)
+	assert.Equal(t, SchemaVersion, catalog.SchemaVersion)
+	assert.Equal(t, testHash1, catalog.GetHash("x86_64", "amzn", "2", "4.14.355-276.639.amzn2.x86_64"))
+
+	catalog, version, err = Parse([]byte(`{"schema_version": 2, "x86_64": {}, "arm64": {}}`))
+	require.NoError(t, err)
+	assert.Equal(t, 2, version)
+	assert.Equal(t, SchemaVersion, catalog.SchemaVersion)
+
+	for _, data := range []string{
+		`{"schema_version": 4, "x86_64": {}}`,
+		`{"schema_version": 0}`,
+		`{"schema_version": "2"}`,
+		`[]`,
+		`null`,
+	} {
+		_, _, err := Parse([]byte(data))
+		assert.Error(t, err, data)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	catalogPath := filepath.Join(t.TempDir(), "catalog.json")
+	v1 := `{"x86_64": {"amzn": {"2": {"4.14.355-276.639.amzn2.x86_64": {"sha256": "` + testHash1 + `"}}}}, "arm64": {}}`
+	require.NoError(t, os.WriteFile(catalogPath, []byte(v1), 0644))
+
+	version, err := Migrate(catalogPath)
+	require.NoError(t, err)
+	assert.Equal(t, 1, version)
+	data, err := os.ReadFile(catalogPath)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"schema_version": 3`)
+
+	version, err = Migrate(catalogPath)
+	require.NoError(t, err)
+	assert.Equal(t, SchemaVersion, version)
+}
@@ -0,0 +1,210 @@
+package catalog
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// SignatureAlgorithm is the only supported signature algorithm
+const SignatureAlgorithm = "ed25519"
+
+// Signature is a detached signature of a catalog by one signer
+type Signature struct {
+	KeyID     string    `json:"key_id"`
+	Algorithm string    `json:"algorithm"`
+	SignedAt  time.Time `json:"signed_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	// Signature is the ed25519 signature of the signed payload, see
+	// signedPayload
+	Signature []byte `json:"signature"`
+}
+
+// SignatureFile is the content of a detached signature file, with a
+// signature per signer
+type SignatureFile struct {
+	Signatures []Signature `json:"signatures"`
+}
+
+// signedPayload is what is actually signed, so the key ID and expiry cannot
+// be changed without invalidating the signature
+type signedPayload struct {
+	CatalogSHA256 string    `json:"catalog_sha256"`
+	KeyID         string    `json:"key_id"`
+	SignedAt      time.Time `json:"signed_at"`
+	ExpiresAt     time.Time `json:"expires_at"`
+}
+
+// Canonical returns the canonical JSON encoding of the catalog which is
+// signed: compact, in the latest schema version, with keys in a fixed order.
+// It does not depend on the formatting of the file the catalog was read from.
+func Canonical(catalog *BTFCatalog) ([]byte, error) {
+	c := *catalog
+	c.SchemaVersion = SchemaVersion
+	return json.Marshal(c)
+}
+
+// KeyID returns the ID of a public key, which is the start of its SHA256 hash
+func KeyID(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:8])
+}
+
+func payload(catalog *BTFCatalog, keyID string, signedAt, expiresAt time.Time) ([]byte, error) {
+	data, err := Canonical(catalog)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	return json.Marshal(signedPayload{
+		CatalogSHA256: hex.EncodeToString(sum[:]),
+		KeyID:         keyID,
+		SignedAt:      signedAt.UTC(),
+		ExpiresAt:     expiresAt.UTC(),
+	})
+}
+
+// Sign signs the catalog with key. The signature is valid until expiresAt.
+func Sign(catalog *BTFCatalog, key ed25519.PrivateKey, signedAt, expiresAt time.Time) (Signature, error) {
+	if !expiresAt.After(signedAt) {
+		return Signature{}, fmt.Errorf("expiry %s is not after %s", expiresAt, signedAt)
+	}
+	sig := Signature{
+		KeyID:     KeyID(key.Public().(ed25519.PublicKey)),
+		Algorithm: SignatureAlgorithm,
+		SignedAt:  signedAt.UTC().Truncate(time.Second),
+		ExpiresAt: expiresAt.UTC().Truncate(time.Second),
+	}
+	msg, err := payload(catalog, sig.KeyID, sig.SignedAt, sig.ExpiresAt)
+	if err != nil {
+		return Signature{}, err
+	}
+	sig.Signature = ed25519.Sign(key, msg)
+	return sig, nil
+}
+
+// Add adds sig to the file, replacing the signature of the same key
+func (f *SignatureFile) Add(sig Signature) {
+	for i, s := range f.Signatures {
+		if s.KeyID == sig.KeyID {
+			f.Signatures[i] = sig
+			return
+		}
+	}
+	f.Signatures = append(f.Signatures, sig)
+}
+
+// Verify checks that at least threshold trusted keys have valid signatures of
+// the catalog which have not expired at now. Signatures of other keys are
+// ignored, and an invalid signature of a trusted key is an error, as the
+// catalog or the signature was modified.
+func (f *SignatureFile) Verify(catalog *BTFCatalog, trusted []ed25519.PublicKey, threshold int, now time.Time) error {
+	if threshold < 1 {
+		return fmt.Errorf("threshold must be at least 1")
+	}
+	keys := map[string]ed25519.PublicKey{}
+	for _, k := range trusted {
+		keys[KeyID(k)] = k
+	}
+
+	var errs []error
+	valid := map[string]bool{}
+	for _, sig := range f.Signatures {
+		key, ok := keys[sig.KeyID]
+		if !ok {
+			continue
+		}
+		if sig.Algorithm != SignatureAlgorithm {
+			errs = append(errs, fmt.Errorf("key %s: unsupported algorithm %q", sig.KeyID, sig.Algorithm))
+			continue
+		}
+		msg, err := payload(catalog, sig.KeyID, sig.SignedAt, sig.ExpiresAt)
+		if err != nil {
+			return err
+		}
+		if !ed25519.Verify(key, msg, sig.Signature) {
+			return fmt.Errorf("key %s: invalid signature", sig.KeyID)
+		}
+		if !now.Before(sig.ExpiresAt) {
+			errs = append(errs, fmt.Errorf("key %s: signature expired at %s", sig.KeyID, sig.ExpiresAt.Format(time.RFC3339)))
+			continue
+		}
+		valid[sig.KeyID] = true
+	}
+	if len(valid) < threshold {
+		errs = append([]error{fmt.Errorf("%d valid signatures of trusted keys, %d required", len(valid), threshold)}, errs...)
+		return errors.Join(errs...)
+	}
+	return nil
+}
+
+// ReadSignatures reads a signature file. A missing file has no signatures.
+func ReadSignatures(path string) (*SignatureFile, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &SignatureFile{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	f := &SignatureFile{}
+	if err := json.Unmarshal(data, f); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return f, nil
+}
+
+// WriteSignatures writes a signature file atomically
+func WriteSignatures(path string, f *SignatureFile) error {
+	data, err := json.MarshalIndent(f, "", "    ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// GenerateKey returns a new private key and its public key, both base64
+// encoded as read by ParsePrivateKey and ParsePublicKey
+func GenerateKey() (private string, public string, err error) {
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	return base64.StdEncoding.EncodeToString(key.Seed()), base64.StdEncoding.EncodeToString(pub), nil
+}
+
+// ParsePrivateKey parses a base64 encoded ed25519 seed or private key
+func ParsePrivateKey(data string) (ed25519.PrivateKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(data))
+	if err != nil {
+		return nil, fmt.Errorf("private key: %w", err)
+	}
+	switch len(raw) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(raw), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(raw), nil
+	default:
+		return nil, fmt.Errorf("private key: invalid length %d", len(raw))
+	}
+}
+
+// ParsePublicKey parses a base64 encoded ed25519 public key
+func ParsePublicKey(data string) (ed25519.PublicKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(data))
+	if err != nil {
+		return nil, fmt.Errorf("public key: %w", err)
+	}
+	if len(raw) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("public key: invalid length %d", len(raw))
+	}
+	return ed25519.PublicKey(raw), nil
+}
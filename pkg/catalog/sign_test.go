@@ -0,0 +1,72 @@
+package catalog
+
+import (
+	"crypto/ed25519"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignVerify(t *testing.T) {
+	testCatalog := func() *BTFCatalog {
+		return &BTFCatalog{Archs: map[string]BTFArchCatalog{
+			"x86_64": {"amzn": {"2": {"v1": {SHA256: testHash1}}}},
+		}}
+	}
+	priv1, pub1, err := GenerateKey()
+	require.NoError(t, err)
+	key1, err := ParsePrivateKey(priv1)
+	require.NoError(t, err)
+	trusted1, err := ParsePublicKey(pub1)
+	require.NoError(t, err)
+	priv2, pub2, err := GenerateKey()
+	require.NoError(t, err)
+	key2, err := ParsePrivateKey(priv2)
+	require.NoError(t, err)
+	trusted2, err := ParsePublicKey(pub2)
+	require.NoError(t, err)
+
+	now := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	expires := now.Add(24 * time.Hour)
+	sig1, err := Sign(testCatalog(), key1, now, expires)
+	require.NoError(t, err)
+	assert.Equal(t, KeyID(trusted1), sig1.KeyID)
+	sig2, err := Sign(testCatalog(), key2, now, expires)
+	require.NoError(t, err)
+
+	// round trip through a file
+	sigPath := filepath.Join(t.TempDir(), "catalog.json.sig")
+	f, err := ReadSignatures(sigPath)
+	require.NoError(t, err)
+	f.Add(sig1)
+	f.Add(sig2)
+	f.Add(sig1)
+	require.NoError(t, WriteSignatures(sigPath, f))
+	f, err = ReadSignatures(sigPath)
+	require.NoError(t, err)
+	require.Len(t, f.Signatures, 2)
+
+	assert.NoError(t, f.Verify(testCatalog(), []ed25519.PublicKey{trusted1}, 1, now))
+	assert.NoError(t, f.Verify(testCatalog(), []ed25519.PublicKey{trusted1, trusted2}, 2, now))
+	assert.Error(t, f.Verify(testCatalog(), []ed25519.PublicKey{trusted1}, 2, now), "threshold")
+	assert.Error(t, f.Verify(testCatalog(), []ed25519.PublicKey{trusted1}, 1, expires), "expired")
+
+	assert.Error(t, (&SignatureFile{Signatures: []Signature{sig2}}).Verify(testCatalog(), []ed25519.PublicKey{trusted1}, 1, now), "untrusted")
+
+	modified := testCatalog()
+	modified.Archs["x86_64"]["amzn"]["2"]["v1"] = BTFEntry{SHA256: testHash2}
+	assert.Error(t, f.Verify(modified, []ed25519.PublicKey{trusted1}, 1, now), "modified catalog")
+
+	tampered := *f
+	tampered.Signatures = []Signature{sig1}
+	tampered.Signatures[0].ExpiresAt = expires.Add(time.Hour)
+	assert.Error(t, tampered.Verify(testCatalog(), []ed25519.PublicKey{trusted1}, 1, now), "modified expiry")
+
+	_, err = Sign(testCatalog(), key1, now, now)
+	assert.Error(t, err)
+	_, err = ParsePublicKey(priv1 + "AA==")
+	assert.Error(t, err)
+}
@@ -1,20 +1,86 @@
 package catalog
 
 import (
+	"bytes"
 	"context"
-	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"io/fs"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 )
 
 // BTFCatalog is the entire catalog
 type BTFCatalog struct {
-	X64   BTFArchCatalog `json:"x86_64"`
-	Arm64 BTFArchCatalog `json:"arm64"`
+	// SchemaVersion is the version of the catalog format, see Parse
+	SchemaVersion int
+
+	// Archs is keyed by architecture, such as x86_64 or s390x. It is
+	// flattened into the top level JSON object, see MarshalJSON.
+	Archs map[string]BTFArchCatalog
+}
+
+// legacyArchs are always written first and in this order, as they were the
+// only architectures before schema version 3
+var legacyArchs = []string{"x86_64", "arm64"}
+
+// MarshalJSON writes the schema version and the architectures as keys of the
+// same object, with the legacy architectures first and the others sorted
+func (catalog BTFCatalog) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `{"schema_version":%d`, catalog.SchemaVersion)
+	archs := slices.DeleteFunc(slices.Sorted(maps.Keys(catalog.Archs)), func(arch string) bool {
+		return slices.Contains(legacyArchs, arch)
+	})
+	for _, arch := range append(slices.Clone(legacyArchs), archs...) {
+		key, err := json.Marshal(arch)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(catalog.Archs[arch])
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteByte(',')
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// UnmarshalJSON reads every key other than schema_version as an architecture
+func (catalog *BTFCatalog) UnmarshalJSON(data []byte) error {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	*catalog = BTFCatalog{}
+	for key, raw := range doc {
+		if key == "schema_version" {
+			if err := json.Unmarshal(raw, &catalog.SchemaVersion); err != nil {
+				return fmt.Errorf("schema_version: %w", err)
+			}
+			continue
+		}
+		var archCatalog BTFArchCatalog
+		if err := json.Unmarshal(raw, &archCatalog); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		if archCatalog == nil {
+			continue
+		}
+		if catalog.Archs == nil {
+			catalog.Archs = map[string]BTFArchCatalog{}
+		}
+		catalog.Archs[key] = archCatalog
+	}
+	return nil
 }
 
 // BTFArchCatalog is keyed by distro name
@@ -26,25 +92,65 @@ type BTFDistroCatalog map[string]BTFReleaseCatalog
 // BTFReleaseCatalog is keyed by kernel version
 type BTFReleaseCatalog map[string]BTFEntry
 
-// BTFEntry is a single entry in the catalog
+// BTFEntry is a single entry in the catalog. Only SHA256 is set for entries
+// added before the other fields existed.
 type BTFEntry struct {
 	SHA256 string `json:"sha256"`
+	// Size is the size of the compressed archive
+	Size int64 `json:"size,omitempty"`
+	// UncompressedSize is the size of the BTF in the archive
+	UncompressedSize int64 `json:"uncompressed_size,omitempty"`
+	// Key is the key of the archive in the object store, which is a blob
+	// shared by the kernel versions with the same BTF in the
+	// content-addressed layout, see BlobKey
+	Key string `json:"key,omitempty"`
+	// BTFSHA256 is the hash of the BTF in the archive
+	BTFSHA256 string `json:"btf_sha256,omitempty"`
+	// GeneratedAt is when the BTF was generated
+	GeneratedAt time.Time `json:"generated_at,omitzero"`
+	// SourcePackage and SourceURL are the kernel package the BTF was
+	// generated from
+	SourcePackage string `json:"source_package,omitempty"`
+	SourceURL     string `json:"source_url,omitempty"`
+	// PaholeVersion is the version of pahole which generated the BTF
+	PaholeVersion string `json:"pahole_version,omitempty"`
+	// Merger is the tool and version which merged the BTF of kernel modules,
+	// such as bpftool v7.4.0, or btfhub and its version if they were merged
+	// natively. It is not set without kernel modules.
+	Merger string `json:"merger,omitempty"`
+	// HasModules is set if the BTF of kernel modules is included
+	HasModules bool `json:"has_modules,omitempty"`
+	// Format is the format of the archive, DefaultFormat if not set
+	Format string `json:"format,omitempty"`
+	// Variants are the archives of the BTF in other formats
+	Variants []BTFVariant `json:"variants,omitempty"`
 }
 
-// Read reads a BTFCatalog from the file
+// BTFVariant is an archive of the BTF of an entry in another format
+type BTFVariant struct {
+	Format string `json:"format"`
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size,omitempty"`
+	Key    string `json:"key,omitempty"`
+}
+
+// Read reads a BTFCatalog from the file, upgrading it to the latest schema
+// version
 func Read(catalogPath string) (*BTFCatalog, error) {
-	catalog := &BTFCatalog{}
 	catalogData, err := os.ReadFile(catalogPath)
 	if err != nil {
 		return nil, fmt.Errorf("read catalog json: %s", err)
 	}
-	if err := json.Unmarshal(catalogData, catalog); err != nil {
+	catalog, _, err := Parse(catalogData)
+	if err != nil {
 		return nil, fmt.Errorf("unmarshal catalog json: %s", err)
 	}
 	return catalog, nil
 }
 
-func Update(ctx context.Context, hashDir string, catalogJSONPath string) error {
+// Update adds the hashes in hashDir to the catalog JSON file. Hashes which
+// differ from an existing entry are an error, unless replace is set.
+func Update(ctx context.Context, hashDir string, catalogJSONPath string, replace bool) error {
 	if hashDir == "" {
 		return fmt.Errorf("--hash-dir must be set")
 	}
@@ -61,24 +167,23 @@ func Update(ctx context.Context, hashDir string, catalogJSONPath string) error {
 		return err
 	}
 
-	err = updateCatalog(ctx, os.DirFS(hashDir), catalog)
+	err = updateCatalog(ctx, os.DirFS(hashDir), catalog, replace)
 	if err != nil {
 		return fmt.Errorf("update catalog: %s", err)
 	}
 
-	catalogData, err := json.MarshalIndent(catalog, "", "    ")
-	if err != nil {
-		return fmt.Errorf("marshal catalog: %s", err)
-	}
-	if err := os.WriteFile(catalogJSONPath, catalogData, 0644); err != nil {
-		return fmt.Errorf("write catalog json: %s", err)
-	}
-	return nil
+	return Write(catalogJSONPath, catalog)
 }
 
-const sha256HexLen = sha256.Size * 2
+func updateCatalog(ctx context.Context, hashFS fs.FS, catalog *BTFCatalog, replace bool) error {
+	return walkHashes(ctx, hashFS, func(entryPath string, entry BTFEntry) error {
+		return catalog.addEntry(entryPath, entry, replace)
+	})
+}
 
-func updateCatalog(ctx context.Context, hashFS fs.FS, catalog *BTFCatalog) error {
+// walkHashes calls fn with the path and entry of each valid hash file in
+// hashFS
+func walkHashes(ctx context.Context, hashFS fs.FS, fn func(entryPath string, entry BTFEntry) error) error {
 	// walk hash directory and collect hashes
 	return fs.WalkDir(hashFS, ".", func(walkPath string, info fs.DirEntry, walkErr error) error {
 		if cerr := ctx.Err(); cerr != nil {
@@ -95,14 +200,21 @@ func updateCatalog(ctx context.Context, hashFS fs.FS, catalog *BTFCatalog) error
 		if err != nil {
 			return fmt.Errorf("read file %s: %w", walkPath, err)
 		}
-		if len(data) != sha256HexLen {
+		entry, ok := ParseEntry(data)
+		if !ok {
 			// ignore files without valid SHA256 hashes
 			return nil
 		}
-		return catalog.addHash(walkPath, string(data))
+		return fn(walkPath, entry)
 	})
 }
 
+// Entry returns the entry of a kernel version, and false if there is none
+func (catalog *BTFCatalog) Entry(arch, distro, release, version string) (BTFEntry, bool) {
+	entry, ok := catalog.Archs[arch][distro][release][version]
+	return entry, ok
+}
+
 func (catalog *BTFCatalog) GetHash(arch, distro, release, version string) string {
 	releaseCatalog := catalog.getReleaseCatalog(arch, distro, release)
 	if releaseCatalog == nil {
@@ -111,48 +223,58 @@ func (catalog *BTFCatalog) GetHash(arch, distro, release, version string) string
 	return releaseCatalog[version].SHA256
 }
 
-func (catalog *BTFCatalog) addHash(entryPath string, hash string) error {
+func (catalog *BTFCatalog) addEntry(entryPath string, entry BTFEntry, replace bool) error {
 	parts := strings.Split(entryPath, string(filepath.Separator))
 	if len(parts) != 4 {
 		// ignore files that don't match the layout
 		return nil
 	}
 
-	arch, distro, release, version := parts[0], parts[1], parts[2], parts[3]
-	releaseCatalog := catalog.getReleaseCatalog(arch, distro, release)
-	if releaseCatalog == nil {
-		return nil
-	}
-	// add new entry, or compare hashes if entry already exists
-	if v, ok := releaseCatalog[version]; ok {
-		if v.SHA256 != hash {
-			return fmt.Errorf("hash mismatch for %s (expected %s, got %s)", entryPath, hash, v.SHA256)
-		}
-	} else {
-		releaseCatalog[version] = BTFEntry{
-			SHA256: hash,
+	if existing, conflicting, ok := catalog.putEntry(parts[0], parts[1], parts[2], parts[3], entry, replace); !ok {
+		if existing.Format != DefaultFormat {
+			entryPath += " (" + existing.Format + ")"
 		}
+		return fmt.Errorf("hash mismatch for %s (expected %s, got %s)", entryPath, conflicting.SHA256, existing.SHA256)
 	}
 	return nil
 }
 
+// putEntry adds an entry to the catalog, merging it into an existing entry
+// whose archives in the same formats have the same hashes. Archives in new
+// formats are added as variants, and the existing archive keeps its format.
+// If an archive of the existing entry has a different hash, it is replaced
+// if replace is set, keeping the provenance the new entry does not set, such
+// as for archives repacked by check -fix. Otherwise the conflicting archives
+// of the existing and of the new entry are returned with false.
+func (catalog *BTFCatalog) putEntry(arch, distro, release, version string, entry BTFEntry, replace bool) (BTFVariant, BTFVariant, bool) {
+	releaseCatalog := catalog.getReleaseCatalog(arch, distro, release)
+	// add new entry, or compare hashes if entry already exists
+	v, ok := releaseCatalog[version]
+	if !ok {
+		releaseCatalog[version] = entry
+		return BTFVariant{}, BTFVariant{}, true
+	}
+	existing, conflicting, conflict := v.Mismatch(entry)
+	switch {
+	case !conflict:
+		releaseCatalog[version] = v.merge(entry)
+	case replace:
+		releaseCatalog[version] = v.replace(entry)
+	default:
+		return existing, conflicting, false
+	}
+	return BTFVariant{}, BTFVariant{}, true
+}
+
 func (catalog *BTFCatalog) getReleaseCatalog(arch, distro, release string) BTFReleaseCatalog {
 	// access entry in catalog, creating new maps as necessary
-	var archCatalog BTFArchCatalog
-	switch arch {
-	case "x86_64":
-		if catalog.X64 == nil {
-			catalog.X64 = BTFArchCatalog{}
-		}
-		archCatalog = catalog.X64
-	case "arm64":
-		if catalog.Arm64 == nil {
-			catalog.Arm64 = BTFArchCatalog{}
-		}
-		archCatalog = catalog.Arm64
-	default:
-		// ignore files that don't match the layout
-		return nil
+	if catalog.Archs == nil {
+		catalog.Archs = map[string]BTFArchCatalog{}
+	}
+	archCatalog, ok := catalog.Archs[arch]
+	if !ok {
+		archCatalog = BTFArchCatalog{}
+		catalog.Archs[arch] = archCatalog
 	}
 	distroCatalog, ok := archCatalog[distro]
 	if !ok {
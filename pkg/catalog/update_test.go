@@ -1,10 +1,13 @@
 package catalog
 
 import (
+	"encoding/json"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"testing/fstest"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -18,102 +21,185 @@ const (
 func TestWalkNoHashes(t *testing.T) {
 	catalog := &BTFCatalog{}
 	hashFS := fstest.MapFS{}
-	err := updateCatalog(t.Context(), hashFS, catalog)
+	err := updateCatalog(t.Context(), hashFS, catalog, false)
 	require.NoError(t, err)
-	assert.Empty(t, catalog.X64)
-	assert.Empty(t, catalog.Arm64)
+	assert.Empty(t, catalog.Archs)
 }
 
 func TestWalkHashConflict(t *testing.T) {
 	catalog := &BTFCatalog{
-		X64: map[string]BTFDistroCatalog{"amzn": {"2": BTFReleaseCatalog{"4.14.355-276.639.amzn2.x86_64": BTFEntry{SHA256: testHash1}}}},
+		Archs: map[string]BTFArchCatalog{"x86_64": {"amzn": {"2": BTFReleaseCatalog{"4.14.355-276.639.amzn2.x86_64": BTFEntry{SHA256: testHash1}}}}},
 	}
 	hashFS := fstest.MapFS{
 		"x86_64/amzn/2/4.14.355-276.639.amzn2.x86_64": &fstest.MapFile{Data: []byte(testHash2)},
 	}
-	err := updateCatalog(t.Context(), hashFS, catalog)
+	err := updateCatalog(t.Context(), hashFS, catalog, false)
 	require.Error(t, err)
 }
 
+func TestWalkReplaceHash(t *testing.T) {
+	catalog := &BTFCatalog{
+		Archs: map[string]BTFArchCatalog{"x86_64": {"amzn": {"2": BTFReleaseCatalog{"4.14.355-276.639.amzn2.x86_64": BTFEntry{SHA256: testHash1}}}}},
+	}
+	hashFS := fstest.MapFS{
+		"x86_64/amzn/2/4.14.355-276.639.amzn2.x86_64": &fstest.MapFile{Data: []byte(testHash2)},
+	}
+	err := updateCatalog(t.Context(), hashFS, catalog, true)
+	require.NoError(t, err)
+	assert.Equal(t, testHash2, catalog.Archs["x86_64"]["amzn"]["2"]["4.14.355-276.639.amzn2.x86_64"].SHA256)
+}
+
+func TestWalkReplaceKeepsProvenance(t *testing.T) {
+	generatedAt := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	existing := BTFEntry{
+		SHA256:        testHash1,
+		Size:          100,
+		BTFSHA256:     testHash2,
+		GeneratedAt:   generatedAt,
+		SourcePackage: "kernel-debuginfo",
+		SourceURL:     "https://example.com/kernel-debuginfo.rpm",
+		PaholeVersion: "v1.27",
+		Merger:        "bpftool v7.4.0",
+		HasModules:    true,
+		Variants:      []BTFVariant{{Format: "tar.zst", SHA256: testHash1}},
+	}
+	catalog := &BTFCatalog{
+		Archs: map[string]BTFArchCatalog{"x86_64": {"amzn": {"2": BTFReleaseCatalog{"v": existing}}}},
+	}
+	// hash file written by check -fix, with only the repacked archive
+	hashFS := fstest.MapFS{
+		"x86_64/amzn/2/v": &fstest.MapFile{Data: []byte(`{"sha256":"` + testHash2 + `","size":90,"key":"amzn/2/x86_64/v.btf.tar.xz"}`)},
+	}
+	require.NoError(t, updateCatalog(t.Context(), hashFS, catalog, true))
+
+	expected := existing
+	expected.SHA256, expected.Size, expected.Key = testHash2, 90, "amzn/2/x86_64/v.btf.tar.xz"
+	assert.Equal(t, expected, catalog.Archs["x86_64"]["amzn"]["2"]["v"])
+}
+
+func TestWalkFormats(t *testing.T) {
+	testHash3 := strings.Repeat("3", 64)
+	xzCatalog := func() *BTFCatalog {
+		return &BTFCatalog{
+			Archs: map[string]BTFArchCatalog{"x86_64": {"amzn": {"2": BTFReleaseCatalog{"k1": BTFEntry{SHA256: testHash1, Size: 10}}}}},
+		}
+	}
+	zst := BTFVariant{Format: "tar.zst", SHA256: testHash2, Size: 8}
+
+	// a zst-only hash file adds a variant, and keeps the xz archive
+	catalog := xzCatalog()
+	hashFS := fstest.MapFS{
+		"x86_64/amzn/2/k1": &fstest.MapFile{Data: []byte(`{"sha256":"` + testHash2 + `","size":8,"format":"tar.zst"}`)},
+	}
+	require.NoError(t, updateCatalog(t.Context(), hashFS, catalog, false))
+	assert.Equal(t, BTFEntry{SHA256: testHash1, Size: 10, Variants: []BTFVariant{zst}}, catalog.Archs["x86_64"]["amzn"]["2"]["k1"])
+
+	// a hash file with both formats, whose xz archive is the same
+	catalog = xzCatalog()
+	hashFS = fstest.MapFS{
+		"x86_64/amzn/2/k1": &fstest.MapFile{Data: []byte(`{"sha256":"` + testHash1 + `","size":10,"variants":[{"format":"tar.zst","sha256":"` + testHash2 + `","size":8}]}`)},
+	}
+	require.NoError(t, updateCatalog(t.Context(), hashFS, catalog, false))
+	assert.Equal(t, BTFEntry{SHA256: testHash1, Size: 10, Variants: []BTFVariant{zst}}, catalog.Archs["x86_64"]["amzn"]["2"]["k1"])
+
+	// archives in the same format are compared, whichever is the archive of
+	// the entry
+	hashFS = fstest.MapFS{
+		"x86_64/amzn/2/k1": &fstest.MapFile{Data: []byte(`{"sha256":"` + testHash3 + `","format":"tar.zst","variants":[{"format":"tar.xz","sha256":"` + testHash1 + `"}]}`)},
+	}
+	err := updateCatalog(t.Context(), hashFS, catalog, false)
+	assert.EqualError(t, err, "hash mismatch for x86_64/amzn/2/k1 (tar.zst) (expected "+testHash3+", got "+testHash2+")")
+
+	// replacing keeps the archive of the entry in its format
+	require.NoError(t, updateCatalog(t.Context(), hashFS, catalog, true))
+	assert.Equal(t, BTFEntry{SHA256: testHash1, Size: 10, Variants: []BTFVariant{{Format: "tar.zst", SHA256: testHash3}}}, catalog.Archs["x86_64"]["amzn"]["2"]["k1"])
+
+	hashFS = fstest.MapFS{
+		"x86_64/amzn/2/k1": &fstest.MapFile{Data: []byte(`{"sha256":"` + testHash2 + `","variants":[{"format":"tar.zst","sha256":"` + testHash3 + `"}]}`)},
+	}
+	err = updateCatalog(t.Context(), hashFS, xzCatalog(), false)
+	assert.EqualError(t, err, "hash mismatch for x86_64/amzn/2/k1 (expected "+testHash2+", got "+testHash1+")")
+}
+
 func TestWalkAddEntry(t *testing.T) {
 	catalog := &BTFCatalog{
-		X64: map[string]BTFDistroCatalog{"amzn": {"2": BTFReleaseCatalog{"4.14.355-276.639.amzn2.x86_64": BTFEntry{SHA256: testHash1}}}},
+		Archs: map[string]BTFArchCatalog{"x86_64": {"amzn": {"2": BTFReleaseCatalog{"4.14.355-276.639.amzn2.x86_64": BTFEntry{SHA256: testHash1}}}}},
 	}
 	hashFS := fstest.MapFS{
 		"x86_64/amzn/2/4.14.355-277.647.amzn2.x86_64": &fstest.MapFile{Data: []byte(testHash2)},
 	}
-	err := updateCatalog(t.Context(), hashFS, catalog)
+	err := updateCatalog(t.Context(), hashFS, catalog, false)
 	require.NoError(t, err)
 
-	entry, ok := catalog.X64["amzn"]["2"]["4.14.355-277.647.amzn2.x86_64"]
+	entry, ok := catalog.Archs["x86_64"]["amzn"]["2"]["4.14.355-277.647.amzn2.x86_64"]
 	require.True(t, ok, "new entry should exist")
 	assert.Equal(t, entry.SHA256, testHash2)
 
-	entry, ok = catalog.X64["amzn"]["2"]["4.14.355-276.639.amzn2.x86_64"]
+	entry, ok = catalog.Archs["x86_64"]["amzn"]["2"]["4.14.355-276.639.amzn2.x86_64"]
 	require.True(t, ok, "old entry should exist")
 	assert.Equal(t, entry.SHA256, testHash1)
 }
 
 func TestWalkNewDistro(t *testing.T) {
 	catalog := &BTFCatalog{
-		X64: map[string]BTFDistroCatalog{"amzn": {"2": BTFReleaseCatalog{"4.14.355-276.639.amzn2.x86_64": BTFEntry{SHA256: testHash1}}}},
+		Archs: map[string]BTFArchCatalog{"x86_64": {"amzn": {"2": BTFReleaseCatalog{"4.14.355-276.639.amzn2.x86_64": BTFEntry{SHA256: testHash1}}}}},
 	}
 	hashFS := fstest.MapFS{
 		"x86_64/ubuntu/20.04/5.4.0-1097-aws": &fstest.MapFile{Data: []byte(testHash2)},
 	}
-	err := updateCatalog(t.Context(), hashFS, catalog)
+	err := updateCatalog(t.Context(), hashFS, catalog, false)
 	require.NoError(t, err)
 
-	entry, ok := catalog.X64["ubuntu"]["20.04"]["5.4.0-1097-aws"]
+	entry, ok := catalog.Archs["x86_64"]["ubuntu"]["20.04"]["5.4.0-1097-aws"]
 	require.True(t, ok, "new entry should exist")
 	assert.Equal(t, entry.SHA256, testHash2)
 
-	entry, ok = catalog.X64["amzn"]["2"]["4.14.355-276.639.amzn2.x86_64"]
+	entry, ok = catalog.Archs["x86_64"]["amzn"]["2"]["4.14.355-276.639.amzn2.x86_64"]
 	require.True(t, ok, "old entry should exist")
 	assert.Equal(t, entry.SHA256, testHash1)
 }
 
 func TestWalkNewRelease(t *testing.T) {
 	catalog := &BTFCatalog{
-		X64: map[string]BTFDistroCatalog{"amzn": {"2": BTFReleaseCatalog{"4.14.355-276.639.amzn2.x86_64": BTFEntry{SHA256: testHash1}}}},
+		Archs: map[string]BTFArchCatalog{"x86_64": {"amzn": {"2": BTFReleaseCatalog{"4.14.355-276.639.amzn2.x86_64": BTFEntry{SHA256: testHash1}}}}},
 	}
 	hashFS := fstest.MapFS{
 		"x86_64/amzn/2018/4.14.355-196.647.amzn1.x86_64": &fstest.MapFile{Data: []byte(testHash2)},
 	}
-	err := updateCatalog(t.Context(), hashFS, catalog)
+	err := updateCatalog(t.Context(), hashFS, catalog, false)
 	require.NoError(t, err)
 
-	entry, ok := catalog.X64["amzn"]["2018"]["4.14.355-196.647.amzn1.x86_64"]
+	entry, ok := catalog.Archs["x86_64"]["amzn"]["2018"]["4.14.355-196.647.amzn1.x86_64"]
 	require.True(t, ok, "new entry should exist")
 	assert.Equal(t, entry.SHA256, testHash2)
 
-	entry, ok = catalog.X64["amzn"]["2"]["4.14.355-276.639.amzn2.x86_64"]
+	entry, ok = catalog.Archs["x86_64"]["amzn"]["2"]["4.14.355-276.639.amzn2.x86_64"]
 	require.True(t, ok, "old entry should exist")
 	assert.Equal(t, entry.SHA256, testHash1)
 }
 
 func TestWalkNewArch(t *testing.T) {
 	catalog := &BTFCatalog{
-		X64: map[string]BTFDistroCatalog{"amzn": {"2": BTFReleaseCatalog{"4.14.355-276.639.amzn2.x86_64": BTFEntry{SHA256: testHash1}}}},
+		Archs: map[string]BTFArchCatalog{"x86_64": {"amzn": {"2": BTFReleaseCatalog{"4.14.355-276.639.amzn2.x86_64": BTFEntry{SHA256: testHash1}}}}},
 	}
 	hashFS := fstest.MapFS{
 		"arm64/amzn/2/4.14.355-277.647.amzn2.aarch64": &fstest.MapFile{Data: []byte(testHash2)},
 	}
-	err := updateCatalog(t.Context(), hashFS, catalog)
+	err := updateCatalog(t.Context(), hashFS, catalog, false)
 	require.NoError(t, err)
 
-	entry, ok := catalog.Arm64["amzn"]["2"]["4.14.355-277.647.amzn2.aarch64"]
+	entry, ok := catalog.Archs["arm64"]["amzn"]["2"]["4.14.355-277.647.amzn2.aarch64"]
 	require.True(t, ok, "new entry should exist")
 	assert.Equal(t, entry.SHA256, testHash2)
 
-	entry, ok = catalog.X64["amzn"]["2"]["4.14.355-276.639.amzn2.x86_64"]
+	entry, ok = catalog.Archs["x86_64"]["amzn"]["2"]["4.14.355-276.639.amzn2.x86_64"]
 	require.True(t, ok, "old entry should exist")
 	assert.Equal(t, entry.SHA256, testHash1)
 }
 
 func TestWalkIgnoreFiles(t *testing.T) {
 	catalog := &BTFCatalog{
-		X64: map[string]BTFDistroCatalog{"amzn": {"2": BTFReleaseCatalog{"4.14.355-276.639.amzn2.x86_64": BTFEntry{SHA256: testHash1}}}},
+		Archs: map[string]BTFArchCatalog{"x86_64": {"amzn": {"2": BTFReleaseCatalog{"4.14.355-276.639.amzn2.x86_64": BTFEntry{SHA256: testHash1}}}}},
 	}
 	hashFS := fstest.MapFS{
 		"x86_64/amzn/2018/4.14.355-196.647.amzn1.x86_64": &fstest.MapFile{Data: []byte(testHash2)},
@@ -122,22 +208,23 @@ func TestWalkIgnoreFiles(t *testing.T) {
 		"x86_64/amzn/no_release_dir": &fstest.MapFile{},
 		"x86_64/amzn/2018/badhash":   &fstest.MapFile{Data: []byte("asdf")},
 	}
-	err := updateCatalog(t.Context(), hashFS, catalog)
+	err := updateCatalog(t.Context(), hashFS, catalog, false)
 	require.NoError(t, err)
 
-	entry, ok := catalog.X64["amzn"]["2018"]["4.14.355-196.647.amzn1.x86_64"]
+	entry, ok := catalog.Archs["x86_64"]["amzn"]["2018"]["4.14.355-196.647.amzn1.x86_64"]
 	require.True(t, ok, "new entry should exist")
 	assert.Equal(t, entry.SHA256, testHash2)
 
-	entry, ok = catalog.X64["amzn"]["2"]["4.14.355-276.639.amzn2.x86_64"]
+	entry, ok = catalog.Archs["x86_64"]["amzn"]["2"]["4.14.355-276.639.amzn2.x86_64"]
 	require.True(t, ok, "old entry should exist")
 	assert.Equal(t, entry.SHA256, testHash1)
 
-	_, ok = catalog.X64["amzn"]["2018"]["badhash"]
+	_, ok = catalog.Archs["x86_64"]["amzn"]["2018"]["badhash"]
 	assert.False(t, ok, "badhash entry should not exist")
 }
 
 var testIndentContent = []byte(`{
+    "schema_version": 3,
     "x86_64": {
         "amzn": {
             "2": {
@@ -173,7 +260,7 @@ func TestJSONIndent(t *testing.T) {
 	err = os.WriteFile(hashFilePath, []byte("3d9ada50ed6b72ea53c52b7655d9ce4a0dba76a012f3430c416dfc51c5dff6bb"), 0644)
 	require.NoError(t, err)
 
-	err = Update(t.Context(), hashDir, catalogPath)
+	err = Update(t.Context(), hashDir, catalogPath, false)
 	require.NoError(t, err)
 	newStat, err := os.Stat(catalogPath)
 	require.NoError(t, err)
@@ -183,3 +270,101 @@ func TestJSONIndent(t *testing.T) {
 	require.Equal(t, testIndentContent, newCatalogData)
 	require.NotEqual(t, oldStat.ModTime(), newStat.ModTime())
 }
+
+func TestWalkEntryFile(t *testing.T) {
+	catalog := &BTFCatalog{
+		Archs: map[string]BTFArchCatalog{"x86_64": {"amzn": {"2": BTFReleaseCatalog{"4.14.355-276.639.amzn2.x86_64": BTFEntry{SHA256: testHash1}}}}},
+	}
+	generated := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	entry := BTFEntry{
+		SHA256:           testHash1,
+		Size:             1024,
+		UncompressedSize: 4096,
+		Key:              "amzn/2/x86_64/4.14.355-276.639.amzn2.x86_64.btf.tar.xz",
+		GeneratedAt:      generated,
+		SourcePackage:    "kernel-debuginfo-4.14.355-276.639.amzn2.x86_64",
+		PaholeVersion:    "v1.27",
+		Merger:           "bpftool v7.4.0",
+		HasModules:       true,
+	}
+	hashDir := t.TempDir()
+	require.NoError(t, WriteEntry(filepath.Join(hashDir, "x86_64/amzn/2/4.14.355-276.639.amzn2.x86_64"), entry))
+	newEntry := entry
+	newEntry.SHA256 = testHash2
+	newEntry.Key = "amzn/2/x86_64/4.14.355-277.647.amzn2.x86_64.btf.tar.xz"
+	require.NoError(t, WriteEntry(filepath.Join(hashDir, "x86_64/amzn/2/4.14.355-277.647.amzn2.x86_64"), newEntry))
+
+	err := updateCatalog(t.Context(), os.DirFS(hashDir), catalog, false)
+	require.NoError(t, err)
+	// an existing entry with the same hash gets the new fields
+	assert.Equal(t, entry, catalog.Archs["x86_64"]["amzn"]["2"]["4.14.355-276.639.amzn2.x86_64"])
+	assert.Equal(t, newEntry, catalog.Archs["x86_64"]["amzn"]["2"]["4.14.355-277.647.amzn2.x86_64"])
+
+	data, err := json.Marshal(BTFEntry{SHA256: testHash1})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"sha256":"`+testHash1+`"}`, string(data), "unset fields must be omitted")
+}
+
+func TestParseEntry(t *testing.T) {
+	entry, ok := ParseEntry([]byte(testHash1))
+	require.True(t, ok)
+	assert.Equal(t, BTFEntry{SHA256: testHash1}, entry)
+	entry, ok = ParseEntry([]byte(`{"sha256":"` + testHash2 + `","size":10}`))
+	require.True(t, ok)
+	assert.Equal(t, BTFEntry{SHA256: testHash2, Size: 10}, entry)
+
+	for _, data := range []string{"", "asdf", `{"size":10}`, `{"sha256":"` + testHash1, strings.Repeat("z", 64)} {
+		_, ok := ParseEntry([]byte(data))
+		assert.False(t, ok, data)
+	}
+}
+
+func TestOtherArchs(t *testing.T) {
+	catalog := &BTFCatalog{}
+	hashFS := fstest.MapFS{
+		"s390x/rhel/8/4.18.0-553.el8_10.s390x":     &fstest.MapFile{Data: []byte(testHash1)},
+		"ppc64le/rhel/8/4.18.0-553.el8_10.ppc64le": &fstest.MapFile{Data: []byte(testHash2)},
+	}
+	require.NoError(t, updateCatalog(t.Context(), hashFS, catalog, false))
+	assert.Equal(t, testHash1, catalog.GetHash("s390x", "rhel", "8", "4.18.0-553.el8_10.s390x"))
+	assert.Equal(t, testHash2, catalog.GetHash("ppc64le", "rhel", "8", "4.18.0-553.el8_10.ppc64le"))
+
+	// x86_64 and arm64 are kept for readers which expect them, and other
+	// architectures follow in order
+	catalog.SchemaVersion = SchemaVersion
+	data, err := json.Marshal(catalog)
+	require.NoError(t, err)
+	assert.Equal(t, `{"schema_version":3,"x86_64":null,"arm64":null,`+
+		`"ppc64le":{"rhel":{"8":{"4.18.0-553.el8_10.ppc64le":{"sha256":"`+testHash2+`"}}}},`+
+		`"s390x":{"rhel":{"8":{"4.18.0-553.el8_10.s390x":{"sha256":"`+testHash1+`"}}}}}`, string(data))
+
+	parsed, _, err := Parse(data)
+	require.NoError(t, err)
+	assert.Equal(t, catalog, parsed)
+}
+
+func TestVariants(t *testing.T) {
+	entry := BTFEntry{SHA256: testHash1, Key: "amzn/2/x86_64/v.btf.tar.xz"}
+	zst := BTFVariant{Format: "tar.zst", SHA256: testHash2, Size: 10, Key: "amzn/2/x86_64/v.btf.tar.zst"}
+	entry.SetArchive(zst)
+	entry.SetArchive(zst)
+	assert.Equal(t, []BTFVariant{zst}, entry.Variants)
+	entry.SetArchive(BTFVariant{Format: DefaultFormat, SHA256: testHash2, Size: 20, Key: entry.Key})
+	assert.Equal(t, testHash2, entry.SHA256)
+	assert.Equal(t, []BTFVariant{
+		{Format: DefaultFormat, SHA256: testHash2, Size: 20, Key: entry.Key},
+		zst,
+	}, entry.Archives())
+
+	// hash files with variants add them to existing entries
+	catalog := &BTFCatalog{}
+	_, _, ok := catalog.putEntry("x86_64", "amzn", "2", "v", BTFEntry{SHA256: testHash2}, false)
+	require.True(t, ok)
+	_, _, ok = catalog.putEntry("x86_64", "amzn", "2", "v", entry, false)
+	require.True(t, ok)
+	assert.Equal(t, entry.Variants, catalog.Archs["x86_64"]["amzn"]["2"]["v"].Variants)
+
+	data, err := json.Marshal(BTFEntry{SHA256: testHash1, Format: "tar.zst", Variants: []BTFVariant{{Format: "tar.xz", SHA256: testHash2}}})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"sha256":"`+testHash1+`","format":"tar.zst","variants":[{"format":"tar.xz","sha256":"`+testHash2+`"}]}`, string(data))
+}
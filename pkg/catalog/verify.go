@@ -0,0 +1,135 @@
+package catalog
+
+import (
+	"maps"
+	"slices"
+	"strings"
+)
+
+// DriftKind is a kind of disagreement between the archive, the catalog and S3
+type DriftKind string
+
+const (
+	// DriftMismatch is an archived file whose hash differs from the catalog
+	DriftMismatch DriftKind = "mismatch"
+	// DriftMissingFile is a catalog entry without an archived file
+	DriftMissingFile DriftKind = "missing-file"
+	// DriftUncataloged is an archived file without a catalog entry
+	DriftUncataloged DriftKind = "uncataloged"
+	// DriftMissingS3 is an archived file which is not in S3
+	DriftMissingS3 DriftKind = "missing-s3"
+	// DriftS3Only is an S3 object without an archived file
+	DriftS3Only DriftKind = "s3-only"
+)
+
+// Drift is a single disagreement for a kernel version
+type Drift struct {
+	Kind    DriftKind `json:"kind"`
+	Arch    string    `json:"arch"`
+	Distro  string    `json:"distro"`
+	Release string    `json:"release"`
+	Version string    `json:"version"`
+	Detail  string    `json:"detail,omitempty"`
+}
+
+// Entries returns the catalog entries of a release, or nil if there are none
+func (catalog *BTFCatalog) Entries(arch, distro, release string) BTFReleaseCatalog {
+	return catalog.Archs[arch][distro][release]
+}
+
+// Compare compares the hashes of the archived files of a release, keyed by
+// kernel version, with the catalog entries. If s3Versions is not nil, the
+// archived files are also compared with the kernel versions in S3. Drifts
+// are returned sorted by version.
+func Compare(arch, distro, release string, entries BTFReleaseCatalog, hashes map[string]string, s3Versions []string) []Drift {
+	var drifts []Drift
+	add := func(kind DriftKind, version, detail string) {
+		drifts = append(drifts, Drift{Kind: kind, Arch: arch, Distro: distro, Release: release, Version: version, Detail: detail})
+	}
+
+	versions := map[string]struct{}{}
+	for v := range entries {
+		versions[v] = struct{}{}
+	}
+	for v := range hashes {
+		versions[v] = struct{}{}
+	}
+	inS3 := map[string]bool{}
+	for _, v := range s3Versions {
+		inS3[v] = true
+		versions[v] = struct{}{}
+	}
+
+	for _, v := range slices.Sorted(maps.Keys(versions)) {
+		entry, cataloged := entries[v]
+		hash, archived := hashes[v]
+		switch {
+		case archived && cataloged && entry.SHA256 != hash:
+			add(DriftMismatch, v, "catalog "+entry.SHA256+", archive "+hash)
+		case archived && !cataloged:
+			add(DriftUncataloged, v, hash)
+		case !archived && cataloged:
+			add(DriftMissingFile, v, "")
+		}
+		if s3Versions == nil {
+			continue
+		}
+		if archived && !inS3[v] {
+			add(DriftMissingS3, v, "")
+		}
+		if !archived && inS3[v] {
+			add(DriftS3Only, v, "")
+		}
+	}
+	return drifts
+}
+
+// CompareArchives is Compare for archives in several formats, whose hashes
+// are keyed by kernel version and format. The archive in the format of the
+// catalog entry is compared by Compare, and the others with the variants of
+// the entry.
+func CompareArchives(arch, distro, release string, entries BTFReleaseCatalog, archives map[string]map[string]string, s3Versions []string) []Drift {
+	hashes := map[string]string{}
+	var drifts []Drift
+	add := func(kind DriftKind, version, detail string) {
+		drifts = append(drifts, Drift{Kind: kind, Arch: arch, Distro: distro, Release: release, Version: version, Detail: detail})
+	}
+
+	for version, byFormat := range archives {
+		entry, cataloged := entries[version]
+		format := entry.ArchiveFormat()
+		if _, ok := byFormat[format]; !ok && !cataloged {
+			// uncataloged archives are reported once, in any format
+			format = slices.Min(slices.Collect(maps.Keys(byFormat)))
+		}
+		if hash, ok := byFormat[format]; ok {
+			hashes[version] = hash
+		}
+		if !cataloged {
+			continue
+		}
+
+		variants := map[string]string{}
+		for _, v := range entry.Variants {
+			variants[v.Format] = v.SHA256
+			hash, ok := byFormat[v.Format]
+			switch {
+			case !ok:
+				add(DriftMissingFile, version, v.Format)
+			case hash != v.SHA256:
+				add(DriftMismatch, version, v.Format+": catalog "+v.SHA256+", archive "+hash)
+			}
+		}
+		for _, f := range slices.Sorted(maps.Keys(byFormat)) {
+			if _, ok := variants[f]; !ok && f != format {
+				add(DriftUncataloged, version, f+": "+byFormat[f])
+			}
+		}
+	}
+
+	drifts = append(Compare(arch, distro, release, entries, hashes, s3Versions), drifts...)
+	slices.SortStableFunc(drifts, func(a, b Drift) int {
+		return strings.Compare(a.Version, b.Version)
+	})
+	return drifts
+}
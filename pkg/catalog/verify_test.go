@@ -0,0 +1,79 @@
+package catalog
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompare(t *testing.T) {
+	entries := BTFReleaseCatalog{
+		"1-ok":       {SHA256: testHash1},
+		"2-mismatch": {SHA256: testHash1},
+		"3-missing":  {SHA256: testHash1},
+	}
+	hashes := map[string]string{
+		"1-ok":          testHash1,
+		"2-mismatch":    testHash2,
+		"4-uncataloged": testHash2,
+	}
+
+	drifts := Compare("x86_64", "amzn", "2", entries, hashes, nil)
+	var kinds []DriftKind
+	for _, d := range drifts {
+		kinds = append(kinds, d.Kind)
+		assert.Equal(t, "amzn", d.Distro)
+	}
+	assert.Equal(t, []DriftKind{DriftMismatch, DriftMissingFile, DriftUncataloged}, kinds)
+	assert.Equal(t, "2-mismatch", drifts[0].Version)
+
+	drifts = Compare("x86_64", "amzn", "2", entries, hashes, []string{"1-ok", "2-mismatch", "5-s3"})
+	kinds = nil
+	for _, d := range drifts {
+		kinds = append(kinds, d.Kind)
+	}
+	assert.Equal(t, []DriftKind{DriftMismatch, DriftMissingFile, DriftUncataloged, DriftMissingS3, DriftS3Only}, kinds)
+
+	assert.Empty(t, Compare("x86_64", "amzn", "2", BTFReleaseCatalog{"1-ok": {SHA256: testHash1}}, map[string]string{"1-ok": testHash1}, []string{"1-ok"}))
+}
+
+func TestCompareArchives(t *testing.T) {
+	zst := func(hash string) []BTFVariant {
+		return []BTFVariant{{Format: "tar.zst", SHA256: hash}}
+	}
+	entries := BTFReleaseCatalog{
+		"1-ok":       {SHA256: testHash1, Variants: zst(testHash2)},
+		"2-mismatch": {SHA256: testHash1, Variants: zst(testHash1)},
+		"3-missing":  {SHA256: testHash1, Variants: zst(testHash2)},
+		"4-zst":      {SHA256: testHash2, Format: "tar.zst"},
+	}
+	archives := map[string]map[string]string{
+		"1-ok":          {"tar.xz": testHash1, "tar.zst": testHash2},
+		"2-mismatch":    {"tar.xz": testHash1, "tar.zst": testHash2},
+		"3-missing":     {"tar.xz": testHash1},
+		"4-zst":         {"tar.xz": testHash1, "tar.zst": testHash2},
+		"5-uncataloged": {"tar.zst": testHash2},
+	}
+
+	drifts := CompareArchives("x86_64", "amzn", "2", entries, archives, nil)
+	var got []string
+	for _, d := range drifts {
+		got = append(got, d.Version+" "+string(d.Kind)+" "+d.Detail)
+	}
+	assert.Equal(t, []string{
+		"2-mismatch mismatch tar.zst: catalog " + testHash1 + ", archive " + testHash2,
+		"3-missing missing-file tar.zst",
+		"4-zst uncataloged tar.xz: " + testHash1,
+		"5-uncataloged uncataloged " + testHash2,
+	}, got)
+}
+
+func TestEntries(t *testing.T) {
+	catalog := &BTFCatalog{
+		Archs: map[string]BTFArchCatalog{"x86_64": {"amzn": {"2": BTFReleaseCatalog{"v": BTFEntry{SHA256: testHash1}}}}},
+	}
+	assert.Len(t, catalog.Entries("x86_64", "amzn", "2"), 1)
+	assert.Nil(t, catalog.Entries("arm64", "amzn", "2"))
+	assert.Nil(t, catalog.Entries("x86_64", "ubuntu", "2"))
+	assert.NotContains(t, catalog.Archs, "arm64", "lookup must not create entries")
+}
@@ -0,0 +1,340 @@
+package config
+
+import (
+	"bytes"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed distros.yaml
+var defaultConfig []byte
+
+// Config describes the distributions, releases and architectures to process
+type Config struct {
+	// DefaultDistros are processed when no distribution is selected
+	DefaultDistros []string `yaml:"default_distros"`
+	// Distros is keyed by distro name, as used in the archive and catalog
+	Distros map[string]*Distro `yaml:"distros"`
+	// Retry has the retry policies of failed packages, by failure class
+	Retry RetryPolicies `yaml:"retry"`
+}
+
+// RetryPolicies has a retry policy for each class of package failure
+type RetryPolicies struct {
+	Download  RetryPolicy `yaml:"download"`
+	NoVmlinux RetryPolicy `yaml:"no_vmlinux"`
+	Pahole    RetryPolicy `yaml:"pahole"`
+	Merge     RetryPolicy `yaml:"merge"`
+	Other     RetryPolicy `yaml:"other"`
+}
+
+// RetryPolicy decides when a failed package is processed again. The zero
+// value never retries.
+type RetryPolicy struct {
+	// RetryAfter is the minimum time since the last attempt
+	RetryAfter time.Duration `yaml:"retry_after"`
+	// MaxAttempts is the number of attempts after which to give up
+	MaxAttempts int `yaml:"max_attempts"`
+}
+
+// For returns the retry policy of a failure class
+func (p RetryPolicies) For(class string) RetryPolicy {
+	switch class {
+	case "download":
+		return p.Download
+	case "no_vmlinux":
+		return p.NoVmlinux
+	case "pahole":
+		return p.Pahole
+	case "merge":
+		return p.Merge
+	}
+	return p.Other
+}
+
+// Retry reports whether a package which failed attempts times, most recently
+// at lastAttempt, should be processed again at now
+func (p RetryPolicy) Retry(attempts int, lastAttempt time.Time, now time.Time) bool {
+	return attempts < p.MaxAttempts && now.Sub(lastAttempt) >= p.RetryAfter
+}
+
+// Distro is the configuration for a single distribution
+type Distro struct {
+	// Name is the distro name, set from the key in Config.Distros
+	Name string `yaml:"-"`
+	// Type selects the repository implementation, defaults to Name
+	Type string `yaml:"type"`
+	// Archs maps btfhub architecture names to distro architecture names
+	Archs map[string]string `yaml:"archs"`
+	// MinVersion is the oldest kernel version to process
+	MinVersion string `yaml:"min_version"`
+	// Repos are package repositories shared by all releases
+	Repos []string `yaml:"repos"`
+	// Flavors, if set, limits processing to these kernel flavors
+	Flavors []string `yaml:"flavors"`
+	// ExcludedFlavors are kernel flavors that are never processed
+	ExcludedFlavors []string `yaml:"excluded_flavors"`
+	// DefaultReleases are processed when no release is selected, defaults to all releases
+	DefaultReleases []string   `yaml:"default_releases"`
+	Releases        []*Release `yaml:"releases"`
+}
+
+// Release is the configuration for a single release of a distribution
+type Release struct {
+	// Version is the release version, as used in the archive and catalog
+	Version string `yaml:"version"`
+	// Name is the release code name, e.g. focal
+	Name string `yaml:"name"`
+	// Archs, if set, limits the release to a subset of the distro architectures
+	Archs []string `yaml:"archs"`
+	// Repos are package repositories for the release
+	Repos []string `yaml:"repos"`
+	// ArchRepos are package repositories for a specific architecture, overriding Repos
+	ArchRepos map[string][]string `yaml:"arch_repos"`
+	// SnapshotVersions are kernel version patterns to query from snapshot archives
+	SnapshotVersions []string `yaml:"snapshot_versions"`
+
+	distro *Distro
+}
+
+// Default returns the built-in configuration
+func Default() (*Config, error) {
+	return parse(bytes.NewReader(defaultConfig))
+}
+
+// Load reads and validates the configuration from a YAML or JSON file. The
+// built-in configuration is returned if path is empty.
+func Load(path string) (*Config, error) {
+	if path == "" {
+		return Default()
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open config: %s", err)
+	}
+	defer f.Close()
+	cfg, err := parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+func parse(rdr io.Reader) (*Config, error) {
+	cfg := &Config{}
+	dec := yaml.NewDecoder(rdr)
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil {
+		return nil, fmt.Errorf("decode config: %s", err)
+	}
+	for name, d := range cfg.Distros {
+		if d == nil {
+			return nil, fmt.Errorf("distro %s: empty configuration", name)
+		}
+		d.Name = name
+		if d.Type == "" {
+			d.Type = name
+		}
+		for _, r := range d.Releases {
+			if r != nil {
+				r.distro = d
+			}
+		}
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+var placeholderRe = regexp.MustCompile(`\{[^}]*\}`)
+
+var validPlaceholders = []string{"{release}", "{name}", "{arch}"}
+
+// Validate checks the configuration for consistency
+func (c *Config) Validate() error {
+	if len(c.Distros) == 0 {
+		return errors.New("no distros configured")
+	}
+	for _, name := range c.DefaultDistros {
+		if _, ok := c.Distros[name]; !ok {
+			return fmt.Errorf("default distro %s is not configured", name)
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(c.Distros)) {
+		if err := c.Distros[name].validate(); err != nil {
+			return fmt.Errorf("distro %s: %w", name, err)
+		}
+	}
+	for _, p := range []RetryPolicy{c.Retry.Download, c.Retry.NoVmlinux, c.Retry.Pahole, c.Retry.Merge, c.Retry.Other} {
+		if p.RetryAfter < 0 || p.MaxAttempts < 0 {
+			return errors.New("retry: negative retry_after or max_attempts")
+		}
+	}
+	return nil
+}
+
+func (d *Distro) validate() error {
+	if len(d.Archs) == 0 {
+		return errors.New("no archs configured")
+	}
+	for arch, altArch := range d.Archs {
+		if arch == "" || altArch == "" || strings.ContainsRune(arch, '/') {
+			return fmt.Errorf("invalid arch mapping %q: %q", arch, altArch)
+		}
+	}
+	if d.MinVersion != "" && !regexp.MustCompile(`^[0-9]`).MatchString(d.MinVersion) {
+		return fmt.Errorf("invalid min_version %s", d.MinVersion)
+	}
+	if err := validateRepos(d.Repos); err != nil {
+		return err
+	}
+	// ubuntu debug packages are selected by a pattern of their flavors
+	if d.Type == "ubuntu" && (len(d.Flavors) == 0 || slices.Contains(d.Flavors, "")) {
+		return errors.New("ubuntu requires flavors")
+	}
+	if len(d.Releases) == 0 {
+		return errors.New("no releases configured")
+	}
+	seen := map[string]bool{}
+	for _, r := range d.Releases {
+		if r == nil || r.Version == "" {
+			return errors.New("release without version")
+		}
+		if seen[r.Version] {
+			return fmt.Errorf("duplicate release %s", r.Version)
+		}
+		seen[r.Version] = true
+		if err := r.validate(); err != nil {
+			return fmt.Errorf("release %s: %w", r.Version, err)
+		}
+	}
+	for _, v := range d.DefaultReleases {
+		if !seen[v] {
+			return fmt.Errorf("default release %s is not configured", v)
+		}
+	}
+	return nil
+}
+
+func (r *Release) validate() error {
+	for _, arch := range r.Archs {
+		if _, ok := r.distro.Archs[arch]; !ok {
+			return fmt.Errorf("arch %s is not configured for distro", arch)
+		}
+	}
+	if err := validateRepos(r.Repos); err != nil {
+		return err
+	}
+	for arch, repos := range r.ArchRepos {
+		if _, ok := r.distro.Archs[arch]; !ok {
+			return fmt.Errorf("arch_repos: arch %s is not configured for distro", arch)
+		}
+		if err := validateRepos(repos); err != nil {
+			return err
+		}
+	}
+	for _, sv := range r.SnapshotVersions {
+		if _, err := regexp.Compile(sv); err != nil {
+			return fmt.Errorf("snapshot version %s: %s", sv, err)
+		}
+	}
+	return nil
+}
+
+func validateRepos(repos []string) error {
+	for _, repo := range repos {
+		for _, ph := range placeholderRe.FindAllString(repo, -1) {
+			if !slices.Contains(validPlaceholders, ph) {
+				return fmt.Errorf("repo %s: unknown placeholder %s", repo, ph)
+			}
+		}
+	}
+	return nil
+}
+
+// DistroNames returns the sorted names of all configured distros
+func (c *Config) DistroNames() []string {
+	return slices.Sorted(maps.Keys(c.Distros))
+}
+
+// Archs returns the sorted list of architectures supported by any distro
+func (c *Config) Archs() []string {
+	archs := map[string]struct{}{}
+	for _, d := range c.Distros {
+		for arch := range d.Archs {
+			archs[arch] = struct{}{}
+		}
+	}
+	return slices.Sorted(maps.Keys(archs))
+}
+
+// Release returns the release configuration for version, or nil
+func (d *Distro) Release(version string) *Release {
+	for _, r := range d.Releases {
+		if r.Version == version {
+			return r
+		}
+	}
+	return nil
+}
+
+// ReleaseVersions returns the versions of all configured releases
+func (d *Distro) ReleaseVersions() []string {
+	var versions []string
+	for _, r := range d.Releases {
+		versions = append(versions, r.Version)
+	}
+	return versions
+}
+
+// DefaultReleaseVersions returns the versions processed when no release is selected
+func (d *Distro) DefaultReleaseVersions() []string {
+	if len(d.DefaultReleases) > 0 {
+		return d.DefaultReleases
+	}
+	return d.ReleaseVersions()
+}
+
+// AllowsFlavor reports whether the kernel flavor should be processed
+func (d *Distro) AllowsFlavor(flavor string) bool {
+	if slices.Contains(d.ExcludedFlavors, flavor) {
+		return false
+	}
+	return len(d.Flavors) == 0 || slices.Contains(d.Flavors, flavor)
+}
+
+// SupportsArch reports whether packages exist for the release and architecture
+func (r *Release) SupportsArch(arch string) bool {
+	if _, ok := r.distro.Archs[arch]; !ok {
+		return false
+	}
+	return len(r.Archs) == 0 || slices.Contains(r.Archs, arch)
+}
+
+// RepoURLs returns the repositories for the architecture with placeholders expanded
+func (r *Release) RepoURLs(arch string) []string {
+	repos, ok := r.ArchRepos[arch]
+	if !ok {
+		repos = r.Repos
+		if len(repos) == 0 {
+			repos = r.distro.Repos
+		}
+	}
+	rep := strings.NewReplacer("{release}", r.Version, "{name}", r.Name, "{arch}", r.distro.Archs[arch])
+	var urls []string
+	for _, repo := range repos {
+		urls = append(urls, rep.Replace(repo))
+	}
+	return urls
+}
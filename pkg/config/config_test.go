@@ -0,0 +1,106 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultConfig(t *testing.T) {
+	cfg, err := Default()
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"ubuntu", "debian", "fedora", "centos", "ol"}, cfg.DefaultDistros)
+	assert.Equal(t, []string{"arm64", "ppc64le", "s390x", "x86_64"}, cfg.Archs())
+	assert.Equal(t, []string{"9", "10"}, cfg.Distros["debian"].ReleaseVersions())
+	assert.Equal(t, []string{"10"}, cfg.Distros["debian"].DefaultReleaseVersions())
+	assert.Equal(t, "ol", cfg.Distros["ol"].Type)
+
+	fedora := cfg.Distros["fedora"]
+	assert.False(t, fedora.Release("24").SupportsArch("arm64"))
+	assert.True(t, fedora.Release("31").SupportsArch("arm64"))
+	assert.False(t, fedora.Release("31").SupportsArch("s390x"))
+	assert.True(t, cfg.Distros["rhel"].Release("8").SupportsArch("s390x"))
+	assert.Equal(t, []string{
+		"https://archives.fedoraproject.org/pub/archive/fedora/linux/releases/31/Everything/aarch64/debug/tree/Packages/k/",
+		"https://archives.fedoraproject.org/pub/archive/fedora/linux/updates/31/Everything/aarch64/debug/Packages/k/",
+	}, fedora.Release("31").RepoURLs("arm64"))
+
+	assert.Equal(t, RetryPolicy{RetryAfter: time.Hour, MaxAttempts: 10}, cfg.Retry.For("download"))
+	assert.Equal(t, cfg.Retry.Other, cfg.Retry.For("unknown"))
+	assert.False(t, cfg.Retry.For("no_vmlinux").Retry(1, time.Time{}, time.Now()))
+
+	ubuntu := cfg.Distros["ubuntu"]
+	assert.Equal(t, "focal", ubuntu.Release("20.04").Name)
+	assert.Equal(t, []string{"http://ddebs.ubuntu.com"}, ubuntu.Release("20.04").RepoURLs("x86_64"))
+
+	opensuse := cfg.Distros["opensuse-leap"]
+	assert.Equal(t, []string{
+		"https://download.opensuse.org/ports/aarch64/debug/distribution/leap/15.1/repo/oss/",
+	}, opensuse.Release("15.1").RepoURLs("arm64"))
+	assert.False(t, opensuse.AllowsFlavor("rt"))
+	assert.True(t, opensuse.AllowsFlavor("default"))
+	assert.True(t, cfg.Distros["debian"].AllowsFlavor(""))
+	assert.False(t, cfg.Distros["debian"].AllowsFlavor("foo"))
+}
+
+func TestLoadJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	err := os.WriteFile(path, []byte(`{
+		"default_distros": ["fedora"],
+		"distros": {
+			"fedora": {
+				"archs": {"x86_64": "x86_64"},
+				"releases": [{"version": "32", "repos": ["https://example.com/{release}/{arch}/"]}]
+			}
+		}
+	}`), 0644)
+	require.NoError(t, err)
+
+	cfg, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"https://example.com/32/x86_64/"}, cfg.Distros["fedora"].Release("32").RepoURLs("x86_64"))
+	assert.Equal(t, []string{"x86_64"}, cfg.Archs())
+}
+
+func TestRetryPolicy(t *testing.T) {
+	last := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	p := RetryPolicy{RetryAfter: 24 * time.Hour, MaxAttempts: 3}
+	assert.False(t, p.Retry(1, last, last.Add(time.Hour)))
+	assert.True(t, p.Retry(1, last, last.Add(24*time.Hour)))
+	assert.True(t, p.Retry(2, last, last.Add(48*time.Hour)))
+	assert.False(t, p.Retry(3, last, last.Add(48*time.Hour)))
+	assert.False(t, RetryPolicy{}.Retry(0, last, last.Add(48*time.Hour)))
+}
+
+func TestValidation(t *testing.T) {
+	tests := map[string]string{
+		"unknown field":        "distros: {fedora: {archs: {x86_64: x86_64}, mirrors: [], releases: [{version: '32'}]}}",
+		"no distros":           "default_distros: []",
+		"unknown default":      "default_distros: [centos]\ndistros: {fedora: {archs: {x86_64: x86_64}, releases: [{version: '32'}]}}",
+		"no archs":             "distros: {fedora: {releases: [{version: '32'}]}}",
+		"no releases":          "distros: {fedora: {archs: {x86_64: x86_64}}}",
+		"duplicate release":    "distros: {fedora: {archs: {x86_64: x86_64}, releases: [{version: '32'}, {version: '32'}]}}",
+		"unknown release arch": "distros: {fedora: {archs: {x86_64: x86_64}, releases: [{version: '32', archs: [arm64]}]}}",
+		"bad placeholder":      "distros: {fedora: {archs: {x86_64: x86_64}, releases: [{version: '32', repos: ['https://x/{version}']}]}}",
+		"bad default release":  "distros: {fedora: {archs: {x86_64: x86_64}, default_releases: ['31'], releases: [{version: '32'}]}}",
+		"bad min version":      "distros: {fedora: {archs: {x86_64: x86_64}, min_version: abc, releases: [{version: '32'}]}}",
+		"negative retry":       "distros: {fedora: {archs: {x86_64: x86_64}, releases: [{version: '32'}]}}\nretry: {merge: {max_attempts: -1}}",
+		"bad retry duration":   "distros: {fedora: {archs: {x86_64: x86_64}, releases: [{version: '32'}]}}\nretry: {merge: {retry_after: soon}}",
+		"ubuntu no flavors":    "distros: {ubuntu: {archs: {x86_64: amd64}, releases: [{version: '20.04', name: focal}]}}",
+		"ubuntu empty flavor":  "distros: {jammy: {type: ubuntu, archs: {x86_64: amd64}, flavors: [aws, ''], releases: [{version: '22.04', name: jammy}]}}",
+		"bad snapshot regexp":  "distros: {debian: {archs: {x86_64: amd64}, releases: [{version: '10', snapshot_versions: ['(']}]}}",
+	}
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			require.NoError(t, os.WriteFile(path, []byte(data), 0644))
+			_, err := Load(path)
+			assert.Error(t, err)
+		})
+	}
+}
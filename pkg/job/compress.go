@@ -13,7 +13,9 @@ import (
 type BTFCompressionJob struct {
 	SourceDir  string
 	BTFTarPath string
-	ReplyChan  chan any
+	// Format is the format of the archive, tar.xz if not set
+	Format    pkg.ArchiveFormat
+	ReplyChan chan any
 }
 
 // Do implements the Job interface, and is called by the worker. It generates a
@@ -21,10 +23,14 @@ type BTFCompressionJob struct {
 func (job *BTFCompressionJob) Do(ctx context.Context) error {
 	log.Printf("DEBUG: compressing BTF into %s\n", job.BTFTarPath)
 	tarCompressStart := time.Now()
+	format := job.Format
+	if format == "" {
+		format = pkg.FormatXZ
+	}
 	os.Remove(job.BTFTarPath)
-	if err := pkg.TarballBTF(ctx, job.SourceDir, job.BTFTarPath); err != nil {
+	if err := pkg.ArchiveBTF(ctx, job.SourceDir, job.BTFTarPath, format); err != nil {
 		os.Remove(job.BTFTarPath)
-		return fmt.Errorf("ERROR: btf.tar.xz gen: %s", err)
+		return fmt.Errorf("ERROR: btf.%s gen: %s", format, err)
 	}
 
 	log.Printf("DEBUG: finished compressing BTF into %s in %s\n", job.BTFTarPath, time.Since(tarCompressStart))
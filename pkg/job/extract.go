@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/DataDog/btfhub/pkg/pkg"
+	"github.com/DataDog/btfhub/pkg/state"
 )
 
 type KernelExtractionJob struct {
@@ -35,7 +36,7 @@ func (job *KernelExtractionJob) Do(ctx context.Context) error {
 	kernPkgPath, err := job.Pkg.Download(ctx, job.WorkDir, job.Force)
 	if err != nil {
 		os.Remove(kernPkgPath)
-		return err
+		return state.WithStage(state.StageDownload, err)
 	}
 
 	log.Printf("DEBUG: finished downloading %s in %s\n", job.Pkg, time.Since(downloadStart))
@@ -2,15 +2,13 @@ package job
 
 import (
 	"context"
-	"crypto/sha256"
 	"fmt"
-	"io"
 	"log"
 	"os"
-	"path/filepath"
 	"time"
 
 	"github.com/DataDog/btfhub/pkg/catalog"
+	"github.com/DataDog/btfhub/pkg/utils"
 )
 
 type HashJob struct {
@@ -18,38 +16,55 @@ type HashJob struct {
 	DestPath   string
 	ReplyChan  chan any
 
+	// Entry has the provenance of the archive, its hash and size are added
+	// before it is written to DestPath, unless they are already set
+	Entry catalog.BTFEntry
+
 	Catalog                        *catalog.BTFCatalog
 	Arch, Distro, Release, Version string
 }
 
 // Do implements the Job interface, and is called by the worker.
-// It hashs the SourcePath and writes the SHA256 hash to DestPath
+// It hashs the SourcePath and writes the catalog entry, with the SHA256 hash,
+// to DestPath
 func (job *HashJob) Do(_ context.Context) error {
 	log.Printf("DEBUG: hashing %s to %s\n", job.SourcePath, job.DestPath)
 	start := time.Now()
 
-	hash, err := sha256File(job.SourcePath)
-	if err != nil {
-		return fmt.Errorf("sha256 hash: %w", err)
+	// generated archives are hashed once, when they are created
+	hash := job.Entry.SHA256
+	if hash == "" {
+		var err error
+		hash, err = utils.SHA256File(job.SourcePath)
+		if err != nil {
+			return fmt.Errorf("sha256 hash: %w", err)
+		}
 	}
 
+	entry := job.Entry
+	entry.SHA256 = hash
 	if job.Catalog != nil {
-		catalogHash := job.Catalog.GetHash(job.Arch, job.Distro, job.Release, job.Version)
-		if catalogHash != "" {
-			if catalogHash == hash {
+		// archives are compared by format, so new formats are added as variants
+		if existing, ok := job.Catalog.Entry(job.Arch, job.Distro, job.Release, job.Version); ok {
+			if catalogArchive, archive, mismatch := existing.Mismatch(entry); mismatch {
+				return fmt.Errorf("hash mismatch for %s/%s/%s/%s %s (expected %s, got %s)", job.Arch, job.Distro, job.Release, job.Version, archive.Format, archive.SHA256, catalogArchive.SHA256)
+			}
+			if hasArchives(existing, entry) {
 				log.Printf("DEBUG: %s exists in catalog, skipping\n", job.SourcePath)
 				job.ReplyChan <- nil
 				return nil
 			}
-			return fmt.Errorf("hash mismatch for %s/%s/%s/%s (expected %s, got %s)", job.Arch, job.Distro, job.Release, job.Version, hash, catalogHash)
 		}
 	}
 
-	destDir := filepath.Dir(job.DestPath)
-	if err := os.MkdirAll(destDir, 0755); err != nil {
-		return fmt.Errorf("mkdir %s: %w", destDir, err)
+	if entry.Size == 0 {
+		info, err := os.Stat(job.SourcePath)
+		if err != nil {
+			return err
+		}
+		entry.Size = info.Size()
 	}
-	if err := os.WriteFile(job.DestPath, []byte(hash), 0644); err != nil {
+	if err := catalog.WriteEntry(job.DestPath, entry); err != nil {
 		return fmt.Errorf("write hash file: %w", err)
 	}
 
@@ -58,20 +73,17 @@ func (job *HashJob) Do(_ context.Context) error {
 	return nil
 }
 
-func (job *HashJob) Reply() chan any {
-	return job.ReplyChan
-}
-
-func sha256File(path string) (string, error) {
-	f, err := os.Open(path)
-	if err != nil {
-		return "", err
+// hasArchives reports whether the catalog entry has the archives of entry in
+// every format
+func hasArchives(catalogEntry, entry catalog.BTFEntry) bool {
+	for _, archive := range entry.Archives() {
+		if _, ok := catalogEntry.Archive(archive.Format); !ok {
+			return false
+		}
 	}
-	defer f.Close()
+	return true
+}
 
-	h := sha256.New()
-	if _, err := io.Copy(h, f); err != nil {
-		return "", err
-	}
-	return fmt.Sprintf("%x", h.Sum(nil)), nil
+func (job *HashJob) Reply() chan any {
+	return job.ReplyChan
 }
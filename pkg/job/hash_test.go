@@ -0,0 +1,55 @@
+package job
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/DataDog/btfhub/pkg/catalog"
+)
+
+func TestHashFormats(t *testing.T) {
+	xzHash, zstHash := strings.Repeat("1", 64), strings.Repeat("2", 64)
+	cat := &catalog.BTFCatalog{Archs: map[string]catalog.BTFArchCatalog{
+		"x86_64": {"amzn": {"2": catalog.BTFReleaseCatalog{"k1": catalog.BTFEntry{SHA256: xzHash}}}},
+	}}
+	source := filepath.Join(t.TempDir(), "k1.btf.tar.zst")
+	require.NoError(t, os.WriteFile(source, []byte{1}, 0644))
+	hash := func(entry catalog.BTFEntry) (string, error) {
+		job := &HashJob{
+			SourcePath: source,
+			DestPath:   filepath.Join(t.TempDir(), "k1"),
+			ReplyChan:  make(chan any, 1),
+			Entry:      entry,
+			Catalog:    cat,
+			Arch:       "x86_64", Distro: "amzn", Release: "2", Version: "k1",
+		}
+		if err := job.Do(t.Context()); err != nil {
+			return "", err
+		}
+		data, err := os.ReadFile(job.DestPath)
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return string(data), err
+	}
+
+	// a zst archive of an xz entry is written, to be added as a variant
+	data, err := hash(catalog.BTFEntry{SHA256: zstHash, Format: "tar.zst"})
+	require.NoError(t, err)
+	entry, ok := catalog.ParseEntry([]byte(data))
+	require.True(t, ok)
+	assert.Equal(t, catalog.BTFEntry{SHA256: zstHash, Size: 1, Format: "tar.zst"}, entry)
+
+	// archives which are all in the catalog are skipped
+	data, err = hash(catalog.BTFEntry{SHA256: xzHash})
+	require.NoError(t, err)
+	assert.Empty(t, data)
+
+	_, err = hash(catalog.BTFEntry{SHA256: zstHash, Format: "tar.zst", Variants: []catalog.BTFVariant{{Format: "tar.xz", SHA256: zstHash}}})
+	assert.ErrorContains(t, err, "hash mismatch for x86_64/amzn/2/k1 tar.xz")
+}
@@ -4,24 +4,51 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"os"
+	"path/filepath"
 	"time"
 
+	"github.com/DataDog/btfhub/pkg/btf"
 	"github.com/DataDog/btfhub/pkg/utils"
 )
 
+// Merger is the tool which merges the BTF of vmlinux and of kernel modules
+type Merger string
+
+const (
+	// MergerBpftool merges with bpftool btf merge, which generated the
+	// published archives
+	MergerBpftool Merger = "bpftool"
+	// MergerGo merges with the btf package, without bpftool. Its output has
+	// the same types, but is not byte-identical, see btf.Merge.
+	MergerGo Merger = "go"
+)
+
+// ParseMerger parses the name of a merger
+func ParseMerger(s string) (Merger, error) {
+	switch m := Merger(s); m {
+	case MergerBpftool, MergerGo:
+		return m, nil
+	}
+	return "", fmt.Errorf("invalid merger %s (bpftool,go)", s)
+}
+
 type BTFMergeJob struct {
 	SourceDir string
 	BTFPath   string
+	// Merger defaults to MergerBpftool
+	Merger    Merger
 	ReplyChan chan any
 }
 
-// Do implements the Job interface, and is called by the worker. It generates a
-// BTF file from an object file with a .BTF section.
+// Do implements the Job interface, and is called by the worker. It merges the
+// vmlinux BTF and the split BTF of the kernel modules in SourceDir into a
+// single BTF file.
 func (job *BTFMergeJob) Do(ctx context.Context) error {
 	log.Printf("DEBUG: merging BTF from %s\n", job.SourceDir)
 	start := time.Now()
 
-	if err := utils.RunCMD(ctx, job.SourceDir, "/bin/bash", "-O", "extglob", "-c", fmt.Sprintf(`bpftool -B vmlinux btf merge %s !(vmlinux)`, job.BTFPath)); err != nil {
+	if err := mergeBTF(ctx, job.Merger, job.SourceDir, job.BTFPath); err != nil {
 		return fmt.Errorf("merge %s: %s", job.SourceDir, err)
 	}
 
@@ -33,3 +60,37 @@ func (job *BTFMergeJob) Do(ctx context.Context) error {
 func (job *BTFMergeJob) Reply() chan any {
 	return job.ReplyChan
 }
+
+// mergeBTF merges the base BTF in dir/vmlinux with every other file in dir,
+// in filename order
+func mergeBTF(ctx context.Context, merger Merger, dir string, out string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	var modules []string
+	for _, e := range entries {
+		if e.IsDir() || e.Name() == "vmlinux" {
+			continue
+		}
+		modules = append(modules, e.Name())
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if merger == MergerGo {
+		paths := make([]string, len(modules))
+		for i, m := range modules {
+			paths[i] = filepath.Join(dir, m)
+		}
+		merged, err := btf.MergeFiles(filepath.Join(dir, "vmlinux"), paths)
+		if err != nil {
+			return err
+		}
+		return merged.WriteFile(out)
+	}
+	// the files are passed as arguments, without a shell, so that their
+	// names need no quoting
+	args := append([]string{"-B", "vmlinux", "btf", "merge", out}, modules...)
+	return utils.RunCMD(ctx, dir, "bpftool", args...)
+}
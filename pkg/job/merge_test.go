@@ -0,0 +1,53 @@
+package job
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/DataDog/btfhub/pkg/btf"
+)
+
+// writeMergeDir writes base BTF to dir/vmlinux, and the split BTF of a module
+// whose name needs quoting in a shell
+func writeMergeDir(t *testing.T) string {
+	dir := t.TempDir()
+	base := btf.NewSpec(nil)
+	intID := base.Add(&btf.Type{Kind: btf.KindInt, Name: "int", SizeType: 4, Extra: 32})
+	require.NoError(t, base.WriteFile(filepath.Join(dir, "vmlinux")))
+	base, err := btf.LoadFile(filepath.Join(dir, "vmlinux"), nil)
+	require.NoError(t, err)
+	mod := btf.NewSpec(base)
+	mod.Add(&btf.Type{Kind: btf.KindVar, Name: "mod_var", SizeType: uint32(intID), Extra: 1})
+	require.NoError(t, mod.WriteFile(filepath.Join(dir, "mod $(x) !(y).ko")))
+	return dir
+}
+
+func TestMergeBTF(t *testing.T) {
+	for _, merger := range []Merger{MergerGo, MergerBpftool} {
+		t.Run(string(merger), func(t *testing.T) {
+			if _, err := exec.LookPath("bpftool"); merger == MergerBpftool && err != nil {
+				t.Skip("bpftool is not installed")
+			}
+			dir := writeMergeDir(t)
+			out := filepath.Join(t.TempDir(), "merged.btf")
+			require.NoError(t, mergeBTF(context.Background(), merger, dir, out))
+			merged, err := btf.LoadFile(out, nil)
+			require.NoError(t, err)
+			require.Equal(t, 2, merged.NumTypes())
+			typ, err := merged.TypeByID(2)
+			require.NoError(t, err)
+			assert.Equal(t, "mod_var", typ.Name)
+		})
+	}
+
+	_, err := ParseMerger("pahole")
+	assert.Error(t, err)
+	merger, err := ParseMerger("go")
+	require.NoError(t, err)
+	assert.Equal(t, MergerGo, merger)
+}
@@ -0,0 +1,71 @@
+package job
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/DataDog/btfhub/pkg/store"
+	"github.com/DataDog/btfhub/pkg/utils"
+)
+
+type UploadJob struct {
+	SourcePath string
+	Store      store.ObjectStore
+	Key        string
+	ReplyChan  chan any
+
+	// Distro and Version are stored as object attributes, with the hash of
+	// the file
+	Distro  string
+	Version string
+
+	// SkipExisting does not upload the file if the key exists, for
+	// content-addressed blobs
+	SkipExisting bool
+}
+
+// Do implements the Job interface, and is called by the worker.
+// It uploads the specified file to the provided object store and key.
+func (job *UploadJob) Do(ctx context.Context) error {
+	url := job.Store.URL(job.Key)
+	log.Printf("DEBUG: uploading %s to %s\n", job.SourcePath, url)
+	start := time.Now()
+
+	if job.SkipExisting {
+		exists, err := job.Store.Exists(ctx, job.Key)
+		if err != nil {
+			return fmt.Errorf("exists %s: %s", url, err)
+		}
+		if exists {
+			log.Printf("DEBUG: %s exists, skipping upload of %s\n", url, job.SourcePath)
+			job.ReplyChan <- nil
+			return nil
+		}
+	}
+
+	hash, err := utils.SHA256File(job.SourcePath)
+	if err != nil {
+		return fmt.Errorf("sha256 hash: %s", err)
+	}
+	file, err := os.Open(job.SourcePath)
+	if err != nil {
+		return fmt.Errorf("open %s: %s", job.SourcePath, err)
+	}
+	defer file.Close()
+
+	err = job.Store.Upload(ctx, job.Key, file, store.ArchiveAttributes(job.Distro, job.Version, hash))
+	if err != nil {
+		return fmt.Errorf("upload %s: %s", url, err)
+	}
+
+	log.Printf("DEBUG: finished uploading from %s to %s in %s\n", job.SourcePath, url, time.Since(start))
+	job.ReplyChan <- nil
+	return nil
+}
+
+func (job *UploadJob) Reply() chan any {
+	return job.ReplyChan
+}
@@ -2,10 +2,64 @@ package job
 
 import (
 	"context"
+	"os/exec"
+	"runtime/debug"
+	"strings"
+	"sync"
 
 	"github.com/DataDog/btfhub/pkg/utils"
 )
 
+// PaholeVersion returns the version of pahole, such as v1.27
+var PaholeVersion = sync.OnceValues(func() (string, error) {
+	out, err := exec.Command("pahole", "--version").Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+})
+
+// BpftoolVersion returns the version of bpftool, such as v7.4.0
+var BpftoolVersion = sync.OnceValues(func() (string, error) {
+	out, err := exec.Command("bpftool", "--version").Output()
+	if err != nil {
+		return "", err
+	}
+	// the first line is the version, followed by the libbpf version and
+	// features
+	line, _, _ := strings.Cut(string(out), "\n")
+	return strings.TrimPrefix(strings.TrimSpace(line), "bpftool "), nil
+})
+
+// BtfhubVersion returns the module version of this binary, and its VCS
+// revision if it was built from a repository
+func BtfhubVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	version := info.Main.Version
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" {
+			version += " " + setting.Value
+		}
+	}
+	return version
+}
+
+// MergerVersion returns the name and version of a merger, such as
+// bpftool v7.4.0
+func MergerVersion(merger Merger) (string, error) {
+	if merger == MergerGo {
+		return "btfhub " + BtfhubVersion(), nil
+	}
+	version, err := BpftoolVersion()
+	if err != nil {
+		return "", err
+	}
+	return "bpftool " + version, nil
+}
+
 // GenerateBTF generates a BTF file from a vmlinux file
 func GenerateBTF(ctx context.Context, debugFile string, baseFile string, out string) error {
 	var args []string
@@ -0,0 +1,108 @@
+package job
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/DataDog/btfhub/pkg/btf"
+)
+
+// MinKernelTypes is the minimum number of types expected in kernel BTF. Even
+// small kernel configurations have tens of thousands of types, so anything
+// below this is a truncated or broken BTF.
+const MinKernelTypes = 1000
+
+// CoreKernelTypes are structs that must be defined in kernel BTF
+var CoreKernelTypes = []string{"task_struct", "sk_buff", "pt_regs"}
+
+type BTFValidationJob struct {
+	// BTFPath is the BTF to validate, including the kernel modules BTF if any
+	BTFPath string
+	// ModuleDir, if set, has the vmlinux BTF and the split BTF of the kernel
+	// modules, which must resolve against it
+	ModuleDir string
+	ReplyChan chan any
+}
+
+// Do implements the Job interface, and is called by the worker. It checks that
+// a generated BTF is complete enough to be published.
+func (job *BTFValidationJob) Do(ctx context.Context) error {
+	log.Printf("DEBUG: validating BTF %s\n", job.BTFPath)
+	start := time.Now()
+
+	if err := ValidateKernelBTF(job.BTFPath); err != nil {
+		return fmt.Errorf("validate %s: %w", filepath.Base(job.BTFPath), err)
+	}
+	if job.ModuleDir != "" {
+		if err := validateModuleBTF(ctx, job.ModuleDir); err != nil {
+			return fmt.Errorf("validate modules: %w", err)
+		}
+	}
+
+	log.Printf("DEBUG: finished validating BTF %s in %s\n", job.BTFPath, time.Since(start))
+	job.ReplyChan <- nil
+	return nil
+}
+
+func (job *BTFValidationJob) Reply() chan any {
+	return job.ReplyChan
+}
+
+// ValidateKernelBTF checks that a standalone kernel BTF file parses, has a
+// minimum number of types, that all type references resolve, and that the
+// core kernel types are defined.
+func ValidateKernelBTF(path string) error {
+	spec, err := btf.LoadFile(path, nil)
+	if err != nil {
+		return err
+	}
+	if n := spec.NumTypes(); n < MinKernelTypes {
+		return fmt.Errorf("only %d types, expected at least %d", n, MinKernelTypes)
+	}
+	if err := spec.CheckRefs(); err != nil {
+		return err
+	}
+	for _, name := range CoreKernelTypes {
+		_, t, err := spec.TypeByName(name, btf.KindStruct)
+		if err != nil {
+			return err
+		}
+		if len(t.Members) == 0 {
+			return fmt.Errorf("struct %s has no members", name)
+		}
+	}
+	return nil
+}
+
+// validateModuleBTF checks that the split BTF of every kernel module in dir
+// resolves against the vmlinux BTF in dir
+func validateModuleBTF(ctx context.Context, dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	base, err := btf.LoadFile(filepath.Join(dir, "vmlinux"), nil)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.IsDir() || e.Name() == "vmlinux" {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		mod, err := btf.LoadFile(filepath.Join(dir, e.Name()), base)
+		if err != nil {
+			return err
+		}
+		if err := mod.CheckRefs(); err != nil {
+			return fmt.Errorf("%s: %w", e.Name(), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package job
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/DataDog/btfhub/pkg/btf"
+)
+
+func writeKernelBTF(t *testing.T, numTypes int, structs ...string) string {
+	spec := btf.NewSpec(nil)
+	intID := spec.Add(&btf.Type{Kind: btf.KindInt, Name: "int", SizeType: 4, Extra: 32})
+	for _, name := range structs {
+		spec.Add(&btf.Type{Kind: btf.KindStruct, Name: name, SizeType: 4, Members: []btf.Member{{Name: "a", Type: intID}}})
+	}
+	for spec.NumTypes() < numTypes {
+		spec.Add(&btf.Type{Kind: btf.KindPtr, SizeType: uint32(intID)})
+	}
+	path := filepath.Join(t.TempDir(), "vmlinux")
+	require.NoError(t, spec.WriteFile(path))
+	return path
+}
+
+func TestValidateKernelBTF(t *testing.T) {
+	assert.NoError(t, ValidateKernelBTF(writeKernelBTF(t, MinKernelTypes, CoreKernelTypes...)))
+	assert.ErrorContains(t, ValidateKernelBTF(writeKernelBTF(t, 10, CoreKernelTypes...)), "only 10 types")
+	assert.ErrorContains(t, ValidateKernelBTF(writeKernelBTF(t, MinKernelTypes, "task_struct", "pt_regs")), "sk_buff not found")
+	assert.Error(t, ValidateKernelBTF(filepath.Join(t.TempDir(), "missing")))
+}
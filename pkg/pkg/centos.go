@@ -35,6 +35,15 @@ func (pkg *CentOSPackage) String() string {
 	return pkg.Name
 }
 
+func (pkg *CentOSPackage) Info() Info {
+	return Info{
+		Name:        pkg.Name,
+		Version:     pkg.KernelVersion.String(),
+		URL:         pkg.URL,
+		BTFFilename: BTFTarballName(pkg),
+	}
+}
+
 func (pkg *CentOSPackage) Download(ctx context.Context, dir string, force bool) (string, error) {
 	localFile := fmt.Sprintf("%s.rpm", pkg.NameOfFile)
 	rpmpath := filepath.Join(dir, localFile)
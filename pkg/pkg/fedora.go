@@ -34,6 +34,15 @@ func (pkg *FedoraPackage) String() string {
 	return pkg.Name
 }
 
+func (pkg *FedoraPackage) Info() Info {
+	return Info{
+		Name:        pkg.Name,
+		Version:     pkg.KernelVersion.String(),
+		URL:         pkg.URL,
+		BTFFilename: BTFTarballName(pkg),
+	}
+}
+
 func (pkg *FedoraPackage) ExtractKernel(ctx context.Context, pkgpath string, extractDir string, kernelModules bool) (string, []string, error) {
 	return utils.ExtractVmlinuxFromRPM(ctx, pkgpath, extractDir, kernelModules, nil)
 }
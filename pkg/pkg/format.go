@@ -0,0 +1,227 @@
+package pkg
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/DataDog/zstd"
+	fastxz "github.com/therootcompany/xz"
+	"github.com/ulikunitz/xz"
+)
+
+// ArchiveFormat is the format of a BTF archive, which is also the extension
+// of its file name after .btf
+type ArchiveFormat string
+
+const (
+	FormatXZ   ArchiveFormat = "tar.xz"
+	FormatZstd ArchiveFormat = "tar.zst"
+)
+
+// Formats are the supported archive formats
+var Formats = []ArchiveFormat{FormatXZ, FormatZstd}
+
+// zstdLevel is the compression level of zstd archives, which favors the size
+// of the archives over the time to compress them
+const zstdLevel = 19
+
+// Suffix returns the suffix of the file names of archives in the format
+func (f ArchiveFormat) Suffix() string {
+	return ".btf." + string(f)
+}
+
+// ParseFormats parses a comma separated list of formats, by name or by
+// extension, or "both" for all of them. The first format is the primary one.
+func ParseFormats(s string) ([]ArchiveFormat, error) {
+	if s == "both" {
+		return slices.Clone(Formats), nil
+	}
+	var formats []ArchiveFormat
+	for _, name := range strings.Split(s, ",") {
+		var f ArchiveFormat
+		switch name {
+		case "xz", string(FormatXZ):
+			f = FormatXZ
+		case "zst", "zstd", string(FormatZstd):
+			f = FormatZstd
+		default:
+			return nil, fmt.Errorf("unknown archive format %q (xz,zst,both)", name)
+		}
+		if !slices.Contains(formats, f) {
+			formats = append(formats, f)
+		}
+	}
+	return formats, nil
+}
+
+// FormatOf returns the format of an archive from its file name
+func FormatOf(name string) (ArchiveFormat, bool) {
+	for _, f := range Formats {
+		if strings.HasSuffix(name, f.Suffix()) {
+			return f, true
+		}
+	}
+	return "", false
+}
+
+// TrimFormat returns the kernel version of an archive file name, and its
+// format
+func TrimFormat(name string) (string, ArchiveFormat, bool) {
+	f, ok := FormatOf(name)
+	if !ok {
+		return name, "", false
+	}
+	return strings.TrimSuffix(name, f.Suffix()), f, true
+}
+
+// BTFArchiveName returns the file name of the BTF archive of a package in a
+// format
+func BTFArchiveName(p Package, f ArchiveFormat) string {
+	return p.BTFFilename() + f.Suffix()
+}
+
+// xzConfig is the configuration of the xz encoder. It is set explicitly, as
+// the archives must not change with the defaults of the encoder.
+var xzConfig = xz.WriterConfig{
+	DictCap:   8 << 20,
+	BufSize:   4096,
+	BlockSize: math.MaxInt64,
+	CheckSum:  xz.CRC64,
+}
+
+// ArchiveBTF creates an archive of the files of btfDir in the format. The
+// archive is byte-reproducible: files are sorted by name, owned by root, read
+// only and dated from the epoch, and the encoders are Go modules pinned by
+// go.mod, rather than the tar, xz and zstd tools of the host.
+func ArchiveBTF(ctx context.Context, btfDir string, out string, format ArchiveFormat) error {
+	files, err := btfDirFiles(btfDir)
+	if err != nil {
+		return err
+	}
+	outFile, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer outFile.Close()
+
+	var cw io.WriteCloser
+	switch format {
+	case FormatXZ:
+		cw, err = xzConfig.NewWriter(outFile)
+		if err != nil {
+			return fmt.Errorf("xz: %w", err)
+		}
+	case FormatZstd:
+		cw = zstd.NewWriterLevel(outFile, zstdLevel)
+	default:
+		return fmt.Errorf("unknown archive format %q", format)
+	}
+	if err := writeTar(ctx, btfDir, files, cw); err != nil {
+		_ = cw.Close()
+		return err
+	}
+	if err := cw.Close(); err != nil {
+		return fmt.Errorf("%s: %w", format, err)
+	}
+	return outFile.Close()
+}
+
+// writeTar writes a tar stream of files in dir to w, with normalized headers
+func writeTar(ctx context.Context, dir string, files []string, w io.Writer) error {
+	tw := tar.NewWriter(w)
+	for _, name := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := writeTarFile(tw, filepath.Join(dir, name), name); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+func writeTarFile(tw *tar.Writer, path string, name string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	// BTF directories are flat
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file", path)
+	}
+	hdr := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     info.Size(),
+		Mode:     0444,
+		Uname:    "root",
+		Gname:    "root",
+		ModTime:  time.Unix(0, 0),
+		Format:   tar.FormatGNU,
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("tar header %s: %w", name, err)
+	}
+	if _, err := io.Copy(tw, f); err != nil {
+		return fmt.Errorf("tar %s: %w", name, err)
+	}
+	return nil
+}
+
+// openArchive returns a reader of the tar stream of an archive in a format
+func openArchive(path string, format ArchiveFormat) (io.Reader, io.Closer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch format {
+	case FormatZstd:
+		zr := zstd.NewReader(f)
+		return zr, closers{zr, f}, nil
+	case FormatXZ:
+		xr, err := fastxz.NewReader(f, 0)
+		if err != nil {
+			_ = f.Close()
+			return nil, nil, err
+		}
+		return xr, f, nil
+	default:
+		_ = f.Close()
+		return nil, nil, fmt.Errorf("unknown archive format %q", format)
+	}
+}
+
+// NewArchiveReader returns a tar reader of an archive in a format. The closer
+// must be closed once the archive is read.
+func NewArchiveReader(path string, format ArchiveFormat) (*tar.Reader, io.Closer, error) {
+	r, c, err := openArchive(path, format)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tar.NewReader(r), c, nil
+}
+
+type closers []io.Closer
+
+func (cs closers) Close() error {
+	var err error
+	for _, c := range cs {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
@@ -0,0 +1,100 @@
+package pkg
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseFormats(t *testing.T) {
+	for s, expected := range map[string][]ArchiveFormat{
+		"xz":            {FormatXZ},
+		"zst":           {FormatZstd},
+		"both":          {FormatXZ, FormatZstd},
+		"zst,xz":        {FormatZstd, FormatXZ},
+		"tar.zst,zstd":  {FormatZstd},
+		"tar.xz,tar.xz": {FormatXZ},
+	} {
+		formats, err := ParseFormats(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(formats, expected) {
+			t.Errorf("%s: got %v, expected %v", s, formats, expected)
+		}
+	}
+	if _, err := ParseFormats("gz"); err == nil {
+		t.Errorf("unknown format must fail")
+	}
+
+	version, format, ok := TrimFormat("5.0.1-100.x86_64.btf.tar.zst")
+	if !ok || version != "5.0.1-100.x86_64" || format != FormatZstd {
+		t.Errorf("TrimFormat: got %s %s %t", version, format, ok)
+	}
+	if _, _, ok := TrimFormat("5.0.1-100.x86_64.btf.ptr"); ok {
+		t.Errorf("TrimFormat must not accept pointer files")
+	}
+}
+
+func TestArchiveZstd(t *testing.T) {
+	outdir := t.TempDir()
+	var archives [][]byte
+	for i, perm := range []os.FileMode{0666, 0444} {
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, filename), []byte{1, 2, 3}, perm); err != nil {
+			t.Fatal(err)
+		}
+		out := filepath.Join(outdir, filepath.Base(dir)+".btf.tar.zst")
+		if err := ArchiveBTF(context.Background(), dir, out, FormatZstd); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		archives = append(archives, data)
+
+		tr, c, err := NewArchiveReader(out, FormatZstd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hdr, err := tr.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Name != filename || hdr.Mode != 0444 || hdr.Uid != 0 || hdr.ModTime.Unix() != 0 {
+			t.Errorf("%d: BTF file is not normalized: %+v", i, hdr)
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(content, []byte{1, 2, 3}) {
+			t.Errorf("%d: BTF file content is %v", i, content)
+		}
+		_ = c.Close()
+	}
+	if !reflect.DeepEqual(archives[0], archives[1]) {
+		t.Errorf("zstd archives are not identical")
+	}
+
+	// repacking keeps the format
+	src := filepath.Join(outdir, "src.btf.tar.zst")
+	if err := os.WriteFile(src, archives[0], 0644); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(outdir, "out.repack")
+	if err := RepackTarball(context.Background(), src, out); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(data, archives[0]) {
+		t.Errorf("repacked zstd archive is not identical")
+	}
+}
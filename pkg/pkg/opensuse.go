@@ -36,6 +36,16 @@ func (pkg *OpenSUSEPackage) String() string {
 	return pkg.Name
 }
 
+func (pkg *OpenSUSEPackage) Info() Info {
+	return Info{
+		Name:        pkg.Name,
+		Version:     pkg.KernelVersion.String(),
+		Flavor:      pkg.Flavor,
+		URL:         pkg.URL,
+		BTFFilename: BTFTarballName(pkg),
+	}
+}
+
 func (pkg *OpenSUSEPackage) ExtractKernel(ctx context.Context, pkgpath string, extractDir string, kernelModules bool) (string, []string, error) {
 	// vmlinux at: /usr/lib/debug/boot/vmlinux-<ver>-<type>.debug
 	return utils.ExtractVmlinuxFromRPM(ctx, pkgpath, extractDir, kernelModules, nil)
@@ -3,7 +3,6 @@ package pkg
 import (
 	"context"
 	"fmt"
-	"os"
 	"path/filepath"
 
 	"github.com/DataDog/btfhub/pkg/kernel"
@@ -15,36 +14,37 @@ type Package interface {
 	Filename() string
 	BTFFilename() string
 	Version() kernel.Version
+	Info() Info
 	Download(ctx context.Context, dir string, force bool) (string, error)
 	ExtractKernel(ctx context.Context, pkgpath string, extractDir string, kernelModules bool) (string, []string, error)
 }
 
-func PackageBTFExists(p Package, workDir string) bool {
-	fp := filepath.Join(workDir, fmt.Sprintf("%s.btf.tar.xz", p.BTFFilename()))
-	return utils.Exists(fp)
-}
-
-func PackageFailed(p Package, workDir string) bool {
-	fp := filepath.Join(workDir, fmt.Sprintf("%s.failed", p.BTFFilename()))
-	return utils.Exists(fp)
+// Info describes a kernel package, for reporting purposes
+type Info struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Flavor  string `json:"flavor"`
+	// URL is empty for packages downloaded with a package manager
+	URL string `json:"url"`
+	// Size is zero when the package size is unknown
+	Size        uint64 `json:"size"`
+	BTFFilename string `json:"btf_filename"`
 }
 
-func hasBTFPath(p Package, workDir string) string {
-	return filepath.Join(workDir, fmt.Sprintf("%s.hasbtf", p.BTFFilename()))
+// BTFTarballName returns the filename of the BTF archive for the package
+func BTFTarballName(p Package) string {
+	return fmt.Sprintf("%s.btf.tar.xz", p.BTFFilename())
 }
 
-func MarkPackageHasBTF(p Package, workDir string) error {
-	fp := hasBTFPath(p, workDir)
-	f, err := os.Create(fp)
-	if err != nil {
-		return fmt.Errorf("mark hasbtf %s: %s", fp, err)
-	}
-	f.Close()
-	return nil
+// BTFPointerName is the name of the pointer file of a package in the
+// content-addressed layout, which has its catalog entry with the key of the
+// blob of its BTF
+func BTFPointerName(p Package) string {
+	return fmt.Sprintf("%s.btf.ptr", p.BTFFilename())
 }
 
-func PackageKernelHasBTF(p Package, workDir string) bool {
-	fp := hasBTFPath(p, workDir)
+func PackageBTFExists(p Package, workDir string) bool {
+	fp := filepath.Join(workDir, BTFTarballName(p))
 	return utils.Exists(fp)
 }
 
@@ -34,6 +34,14 @@ func (pkg *RHELPackage) String() string {
 	return pkg.Name
 }
 
+func (pkg *RHELPackage) Info() Info {
+	return Info{
+		Name:        pkg.Name,
+		Version:     pkg.KernelVersion.String(),
+		BTFFilename: BTFTarballName(pkg),
+	}
+}
+
 func (pkg *RHELPackage) ExtractKernel(ctx context.Context, pkgpath string, extractDir string, kernelModules bool) (string, []string, error) {
 	return utils.ExtractVmlinuxFromRPM(ctx, pkgpath, extractDir, kernelModules, nil)
 }
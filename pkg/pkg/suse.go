@@ -37,6 +37,15 @@ func (pkg *SUSEPackage) String() string {
 	return fmt.Sprintf("%s-%s.%s", pkg.Name, pkg.KernelVersion.String(), pkg.Architecture)
 }
 
+func (pkg *SUSEPackage) Info() Info {
+	return Info{
+		Name:        pkg.Name,
+		Version:     pkg.KernelVersion.String(),
+		Flavor:      pkg.Flavor,
+		BTFFilename: BTFTarballName(pkg),
+	}
+}
+
 func (pkg *SUSEPackage) ExtractKernel(ctx context.Context, pkgpath string, extractDir string, kernelModules bool) (string, []string, error) {
 	// vmlinux at: /usr/lib/debug/boot/vmlinux-<ver>-<type>.debug
 	return utils.ExtractVmlinuxFromRPM(ctx, pkgpath, extractDir, kernelModules, nil)
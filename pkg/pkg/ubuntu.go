@@ -8,6 +8,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -52,6 +53,21 @@ func (pkg *UbuntuPackage) String() string {
 	return fmt.Sprintf("%s %s", pkg.Name, pkg.Architecture)
 }
 
+func (pkg *UbuntuPackage) Info() Info {
+	size := pkg.Size
+	if size == math.MaxUint64 { // unknown size from launchpad
+		size = 0
+	}
+	return Info{
+		Name:        pkg.Name,
+		Version:     pkg.KernelVersion.String(),
+		Flavor:      pkg.Flavor,
+		URL:         pkg.URL,
+		Size:        size,
+		BTFFilename: BTFTarballName(pkg),
+	}
+}
+
 // Download downloads the package to the specified directory and returns the
 // path to the downloaded file.
 func (pkg *UbuntuPackage) Download(ctx context.Context, dir string, force bool) (
@@ -148,7 +164,7 @@ func (pkg *UbuntuPackage) ExtractKernel(ctx context.Context, pkgPath string, ext
 	}
 
 	if vmlinuxPath == "" {
-		return "", nil, fmt.Errorf("%s file not found in ddeb", debpath)
+		return "", nil, fmt.Errorf("%s: %w in ddeb", debpath, utils.ErrVmlinuxNotFound)
 	}
 	return vmlinuxPath, paths, nil
 }
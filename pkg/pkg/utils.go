@@ -1,13 +1,17 @@
 package pkg
 
 import (
+	"archive/tar"
 	"bufio"
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"fmt"
 	"io"
+	"maps"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"slices"
 	"strconv"
 	"strings"
@@ -16,30 +20,105 @@ import (
 	"github.com/DataDog/btfhub/pkg/utils"
 )
 
+// TarballBTF creates a .tar.xz archive of the files of btfDir, see ArchiveBTF
 func TarballBTF(ctx context.Context, btfDir string, out string) error {
-	// Use external tool for performance reasons
+	return ArchiveBTF(ctx, btfDir, out, FormatXZ)
+}
+
+// btfDirFiles returns the sorted names of the files to archive in btfDir
+func btfDirFiles(btfDir string) ([]string, error) {
 	f, err := os.Open(btfDir)
 	if err != nil {
-		return fmt.Errorf("open %s: %w", btfDir, err)
+		return nil, fmt.Errorf("open %s: %w", btfDir, err)
 	}
 	defer f.Close()
 	files, err := f.Readdirnames(-1)
 	if err != nil {
-		return fmt.Errorf("readdirnames: %w", err)
+		return nil, fmt.Errorf("readdirnames: %w", err)
 	}
 	slices.Sort(files)
+	return files, nil
+}
+
+// RepackTarball rewrites a BTF tarball with the normalization of TarballBTF,
+// and checks that the files in the new tarball are identical to the original.
+// The format of the tarballs is the one of the file name of src.
+func RepackTarball(ctx context.Context, src string, out string) error {
+	format, ok := FormatOf(src)
+	if !ok {
+		return fmt.Errorf("unknown archive format of %s", src)
+	}
+	tmpDir, err := os.MkdirTemp("", "btfhub-repack-*")
+	if err != nil {
+		return fmt.Errorf("create temp dir: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	srcHashes, err := ArchiveFiles(src, format, tmpDir)
+	if err != nil {
+		return fmt.Errorf("extract %s: %w", src, err)
+	}
+	if err := ArchiveBTF(ctx, tmpDir, out, format); err != nil {
+		return err
+	}
+	outHashes, err := ArchiveFiles(out, format, "")
+	if err != nil {
+		return fmt.Errorf("read %s: %w", out, err)
+	}
+	if !maps.Equal(srcHashes, outHashes) {
+		return fmt.Errorf("repacked files of %s do not match the original", src)
+	}
+	return nil
+}
 
-	args := []string{"-cvJ",
-		"--sort=name",
-		"--owner=root:0",
-		"--group=root:0",
-		"--mode=a=r",
-		"--mtime=@0",
-		"-f",
-		out,
-	}
-	args = append(args, files...)
-	return utils.RunCMD(ctx, btfDir, "tar", args...)
+// ArchiveFiles returns the SHA256 hashes of the regular files in a tarball,
+// keyed by name. If extractDir is set, the files are also extracted to it.
+func ArchiveFiles(path string, format ArchiveFormat, extractDir string) (map[string]string, error) {
+	tr, c, err := NewArchiveReader(path, format)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	hashes := map[string]string{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		// BTF tarballs are flat, refuse anything else
+		if filepath.Base(hdr.Name) != hdr.Name || hdr.Name == ".." {
+			return nil, fmt.Errorf("unexpected file name %s", hdr.Name)
+		}
+
+		h := sha256.New()
+		w := io.Writer(h)
+		var out *os.File
+		if extractDir != "" {
+			out, err = os.Create(filepath.Join(extractDir, hdr.Name))
+			if err != nil {
+				return nil, err
+			}
+			w = io.MultiWriter(h, out)
+		}
+		_, err = io.Copy(w, tr)
+		if out != nil {
+			if cerr := out.Close(); err == nil {
+				err = cerr
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		hashes[hdr.Name] = fmt.Sprintf("%x", h.Sum(nil))
+	}
+	return hashes, nil
 }
 
 //
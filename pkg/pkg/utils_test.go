@@ -3,13 +3,17 @@ package pkg
 import (
 	"archive/tar"
 	"context"
+	"fmt"
 	"io"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"reflect"
 	"testing"
 
 	fastxz "github.com/therootcompany/xz"
+
+	"github.com/DataDog/btfhub/pkg/utils"
 )
 
 const filename = "test.btf"
@@ -98,4 +102,68 @@ func TestTarballIdempotent(t *testing.T) {
 			t.Errorf("BTF file group is not GID 0. gid=%d", hdr.Gid)
 		}
 	}
+
+	// archives do not depend on the host tools, so their hashes are stable
+	// across runs and machines, and only change with the encoders in go.mod
+	for format, expected := range tarballSHA256 {
+		for i := range 2 {
+			out := filepath.Join(outdir, fmt.Sprintf("stable%d%s", i, format.Suffix()))
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, filename), []byte{1}, 0600); err != nil {
+				t.Fatal(err)
+			}
+			if err := ArchiveBTF(context.Background(), dir, out, format); err != nil {
+				t.Fatal(err)
+			}
+			hash, err := utils.SHA256File(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hash != expected {
+				t.Errorf("%s archive hash is not stable. hash=%s expected=%s", format, hash, expected)
+			}
+		}
+	}
+}
+
+// tarballSHA256 are the hashes of the archives of a test.btf file with a
+// single byte 1
+var tarballSHA256 = map[ArchiveFormat]string{
+	FormatXZ:   "007847eddb74464dd232891cc88fa43aa256283c3d1d1b6a0ad7d8ffeb2984fb",
+	FormatZstd: "2f4ae616399eb36a361de031363106d4992c6d4d3097803094840e6cbd598156",
+}
+
+func TestRepackTarball(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, filename), []byte{1, 2, 3}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	src := filepath.Join(t.TempDir(), "src.btf.tar.xz")
+	cmd := exec.Command("tar", "-cJf", src, filename)
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("tar: %s\n%s", err, out)
+	}
+
+	out := filepath.Join(t.TempDir(), "out.btf.tar.xz")
+	if err := RepackTarball(context.Background(), src, out); err != nil {
+		t.Fatal(err)
+	}
+
+	// repacked tarball must match a tarball generated from the same files
+	expected := filepath.Join(t.TempDir(), "expected.btf.tar.xz")
+	if err := TarballBTF(context.Background(), dir, expected); err != nil {
+		t.Fatal(err)
+	}
+	data1, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data2, err := os.ReadFile(expected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(data1, data2) {
+		t.Errorf("repacked tarball is not normalized")
+	}
 }
@@ -0,0 +1,38 @@
+package repo
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/DataDog/btfhub/pkg/kernel"
+	"github.com/DataDog/btfhub/pkg/pkg"
+)
+
+const testRepoqueryOutput = `Loaded plugins: priorities, update-motd
+kernel-debuginfo-0:4.14.355-276.639.amzn2.x86_64
+kernel-debuginfo-0:4.14.355-277.647.amzn2.x86_64
+kernel-debuginfo-0:4.14.355-277.647.amzn2.x86_64
+kernel-debuginfo-common-x86_64-0:4.14.355-277.647.amzn2.x86_64
+kernel-debuginfo-0:3.10.0-862.el7.x86_64
+`
+
+func TestParseRepoqueryPackages(t *testing.T) {
+	pkgs, err := parseRepoqueryPackages(strings.NewReader(testRepoqueryOutput), kernel.NewKernelVersion("4.0"))
+	require.NoError(t, err)
+	require.Len(t, pkgs, 2)
+
+	var names []string
+	for _, p := range pkgs {
+		names = append(names, p.BTFFilename())
+		assert.Equal(t, "x86_64", p.(*pkg.RHELPackage).Architecture)
+	}
+	assert.ElementsMatch(t, []string{"4.14.355-276.639.amzn2.x86_64", "4.14.355-277.647.amzn2.x86_64"}, names)
+
+	info := pkgs[0].Info()
+	assert.Equal(t, info.Name, "kernel-debuginfo-"+pkgs[0].BTFFilename())
+	assert.Equal(t, info.BTFFilename, pkgs[0].BTFFilename()+".btf.tar.xz")
+	assert.Empty(t, info.URL)
+}
@@ -7,50 +7,43 @@ import (
 	"sort"
 	"strings"
 
+	"github.com/DataDog/btfhub/pkg/config"
 	"github.com/DataDog/btfhub/pkg/kernel"
 	"github.com/DataDog/btfhub/pkg/pkg"
 	"github.com/DataDog/btfhub/pkg/utils"
 )
 
 type CentosRepo struct {
-	archs      map[string]string
-	repos      map[string]string
+	distro     *config.Distro
 	minVersion kernel.Version
 }
 
-func NewCentOSRepo() Repository {
+func NewCentOSRepo(distro *config.Distro) Repository {
 	return &CentosRepo{
-		archs: map[string]string{
-			"x86_64": "x86_64",
-			"arm64":  "aarch64",
-		},
-		repos: map[string]string{
-			"7": "http://linuxsoft.cern.ch/centos-debuginfo/7/%s/",
-			"8": "http://mirror.facebook.net/centos-debuginfo/8/%s/Packages/",
-		},
-		minVersion: kernel.NewKernelVersion("3.10.0-957"),
+		distro:     distro,
+		minVersion: kernel.NewKernelVersion(distro.MinVersion),
 	}
 }
 
 func (d *CentosRepo) GetKernelPackages(
 	ctx context.Context,
-	workDir string,
 	release string,
 	arch string,
 	opts RepoOptions,
-	chans *JobChannels,
-) error {
+) (map[string][]pkg.Package, error) {
 	var pkgs []pkg.Package
 
-	altArch := d.archs[arch]
+	altArch := d.distro.Archs[arch]
 
 	// Pick all the links that match the kernel-debuginfo pattern
 
-	repoURL := fmt.Sprintf(d.repos[release], altArch)
-
-	links, err := utils.GetLinks(ctx, repoURL)
-	if err != nil {
-		return fmt.Errorf("ERROR: list packages: %s", err)
+	var links []string
+	for _, repoURL := range d.distro.Release(release).RepoURLs(arch) {
+		rlinks, err := utils.GetLinks(ctx, repoURL)
+		if err != nil {
+			return nil, fmt.Errorf("ERROR: list packages: %s", err)
+		}
+		links = append(links, rlinks...)
 	}
 
 	kre := regexp.MustCompile(fmt.Sprintf(`kernel-debuginfo-([-1-9].*\.%s)\.rpm`, altArch))
@@ -70,7 +63,7 @@ func (d *CentosRepo) GetKernelPackages(
 				KernelVersion: kernel.NewKernelVersion(match[1]),
 			}
 
-			if p.Version().Less(d.minVersion) {
+			if !d.minVersion.IsZero() && p.Version().Less(d.minVersion) {
 				continue
 			}
 
@@ -80,5 +73,5 @@ func (d *CentosRepo) GetKernelPackages(
 
 	sort.Sort(pkg.ByVersion(pkgs)) // so kernels can be skipped if previous has BTF already
 
-	return processPackages(ctx, workDir, pkgs, opts, chans)
+	return map[string][]pkg.Package{"": pkgs}, nil
 }
@@ -10,100 +10,62 @@ import (
 	"net/http"
 	"net/url"
 	"regexp"
-	"slices"
 	"sort"
 	"strings"
 
 	"github.com/cenkalti/backoff/v5"
 
+	"github.com/DataDog/btfhub/pkg/config"
 	"github.com/DataDog/btfhub/pkg/kernel"
 	"github.com/DataDog/btfhub/pkg/pkg"
 	"github.com/DataDog/btfhub/pkg/utils"
 )
 
 type DebianRepo struct {
-	archs            map[string]string
-	repos            map[string][]string
-	snapshotVersions map[string][]string
-	releaseNames     map[string]string
+	distro *config.Distro
 }
 
-var archiveRepos = []string{
-	// prefer snapshot over apt
-	//"http://archive.debian.org/debian/dists/%s/main/binary-%s/Packages.gz",
-	//"http://archive.debian.org/debian-security/dists/%s/updates/main/binary-%s/Packages.gz",
-}
-
-var oldRepos = []string{
-	// prefer snapshot over apt
-	//"http://ftp.debian.org/debian/dists/%s/main/binary-%s/Packages.gz",
-	//"http://ftp.debian.org/debian/dists/%s-updates/main/binary-%s/Packages.gz",
-	//"http://security.debian.org/debian-security/dists/%s/updates/main/binary-%s/Packages.gz",
-}
-
-func NewDebianRepo() Repository {
-	return &DebianRepo{
-		archs: map[string]string{
-			"x86_64": "amd64",
-			"arm64":  "arm64",
-		},
-		repos: map[string][]string{
-			"9":  archiveRepos,
-			"10": oldRepos,
-		},
-		snapshotVersions: map[string][]string{
-			"9":  {`4\.9\.0`, `4\.19\.0-0\.bpo.\d+`},
-			"10": {`4\.19\.0-\d+`},
-		},
-		releaseNames: map[string]string{
-			"9":  "stretch",
-			"10": "buster",
-		},
-	}
+func NewDebianRepo(distro *config.Distro) Repository {
+	return &DebianRepo{distro: distro}
 }
 
 const debianSnapshotURL = "http://snapshot.debian.org"
 
 // GetKernelPackages downloads Packages.xz from the main, updates and security,
 // from the official repos and parses the list of kernel packages to download.
-// It then filters out kernel packages that we already have or failed to
-// download. It then processes the list of kernel packages: they will be
-// downloaded and then the btf files will be extracted from them.
+// It then adds the debug kernel packages found in the snapshot archive.
 func (d *DebianRepo) GetKernelPackages(
 	ctx context.Context,
-	workDir string,
 	release string,
 	arch string,
 	opts RepoOptions,
-	chans *JobChannels,
-) error {
-	altArch := d.archs[arch]
-	releaseName := d.releaseNames[release]
+) (map[string][]pkg.Package, error) {
+	altArch := d.distro.Archs[arch]
+	rel := d.distro.Release(release)
+	releaseName := rel.Name
 
 	var pkgs []pkg.Package
 
-	for _, r := range d.repos[release] {
+	for _, repo := range rel.RepoURLs(arch) {
 		rawPkgs := &bytes.Buffer{}
 
 		// Get Packages.xz from main, updates and security
 
-		repo := fmt.Sprintf(r, releaseName, altArch) // ..debian/dists/%s/%s/main.../Packages.gz
-
 		if err := utils.Download(ctx, repo, rawPkgs); err != nil {
-			return fmt.Errorf("download package list %s: %s", repo, err)
+			return nil, fmt.Errorf("download package list %s: %s", repo, err)
 		}
 
 		// Get the list of kernel packages to download from those repos
 		repoURL, err := url.Parse(repo)
 		if err != nil {
-			return fmt.Errorf("repo url parse: %s", err)
+			return nil, fmt.Errorf("repo url parse: %s", err)
 		}
 
 		// Get the list of kernel packages to download from debug repo
 		repoURL.Path = strings.Split(repoURL.Path, "/dists")[0]
 		kernelDbgPkgs, err := pkg.ParseAPTPackages(rawPkgs, repoURL.String(), release, releaseName)
 		if err != nil {
-			return fmt.Errorf("parsing package list: %s", err)
+			return nil, fmt.Errorf("parsing package list: %s", err)
 		}
 
 		// Filter out packages that aren't debug kernel packages
@@ -119,13 +81,12 @@ func (d *DebianRepo) GetKernelPackages(
 		}
 	}
 
-	if len(d.snapshotVersions[release]) > 0 {
+	if len(rel.SnapshotVersions) > 0 {
 		allLinks, err := utils.GetLinks(ctx, debianSnapshotURL+"/binary/?cat=l")
 		if err != nil {
-			return fmt.Errorf("parsing snapshot links: %s", err)
+			return nil, fmt.Errorf("parsing snapshot links: %s", err)
 		}
-		allowedFlavors := []string{"", "cloud", "rt"}
-		for _, sn := range d.snapshotVersions[release] {
+		for _, sn := range rel.SnapshotVersions {
 			re := regexp.MustCompile(fmt.Sprintf(`linux-image-(%s)(-[^-]+)?-%s-dbg`, sn, altArch))
 			for _, l := range allLinks {
 				parts := strings.Split(l, "/")
@@ -138,7 +99,7 @@ func (d *DebianRepo) GetKernelPackages(
 				if len(match) == 3 {
 					flavor = strings.TrimPrefix(match[2], "-")
 				}
-				if !slices.Contains(allowedFlavors, flavor) {
+				if !d.distro.AllowsFlavor(flavor) {
 					continue
 				}
 
@@ -154,7 +115,7 @@ func (d *DebianRepo) GetKernelPackages(
 
 				binpkg, err := retryQueryJsonAPI[snapshotBinaryPackage](ctx, fmt.Sprintf(debianSnapshotURL+"/mr/binary/%s/", name), nil)
 				if err != nil {
-					return fmt.Errorf("snapshot package API error for %s: %s", name, err)
+					return nil, fmt.Errorf("snapshot package API error for %s: %s", name, err)
 				}
 				if len(binpkg.Result) == 0 {
 					continue
@@ -162,7 +123,7 @@ func (d *DebianRepo) GetKernelPackages(
 
 				verInfo, err := retryQueryJsonAPI[snapshotBinaryVersionInfo](ctx, fmt.Sprintf(debianSnapshotURL+"/mr/binary/%s/%s/binfiles?fileinfo=1", name, binpkg.Result[0].BinaryVersion), nil)
 				if err != nil {
-					return fmt.Errorf("snapshot version API error for %s: %s", name, err)
+					return nil, fmt.Errorf("snapshot version API error for %s: %s", name, err)
 				}
 				for _, info := range verInfo.FileInfo {
 					if len(info) == 0 {
@@ -187,7 +148,7 @@ func (d *DebianRepo) GetKernelPackages(
 
 	sort.Sort(pkg.ByVersion(pkgs)) // so kernels can be skipped if previous has BTF already
 
-	return processPackages(ctx, workDir, pkgs, opts, chans)
+	return map[string][]pkg.Package{"": pkgs}, nil
 }
 
 type snapshotBinaryPackageVersion struct {
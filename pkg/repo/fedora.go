@@ -8,82 +8,31 @@ import (
 	"sort"
 	"strings"
 
+	"github.com/DataDog/btfhub/pkg/config"
 	"github.com/DataDog/btfhub/pkg/kernel"
 	"github.com/DataDog/btfhub/pkg/pkg"
 	"github.com/DataDog/btfhub/pkg/utils"
 )
 
 type FedoraRepo struct {
-	archs map[string]string
-	repos map[string][]string
+	distro *config.Distro
 }
 
-var olderRepoOrganization = []string{
-	"https://archives.fedoraproject.org/pub/archive/fedora/linux/releases/%s/Everything/%s/debug/tree/Packages/k/",
-	"https://archives.fedoraproject.org/pub/archive/fedora/linux/updates/%s/%s/debug/k/",
-}
-
-var oldRepoOrganization = []string{
-	"https://archives.fedoraproject.org/pub/archive/fedora/linux/releases/%s/Everything/%s/debug/tree/Packages/k/",
-	"https://archives.fedoraproject.org/pub/archive/fedora/linux/updates/%s/%s/debug/Packages/k/",
-}
-
-var repoOrganization = []string{
-	"https://archives.fedoraproject.org/pub/archive/fedora/linux/releases/%s/Everything/%s/debug/tree/Packages/k/",
-	"https://archives.fedoraproject.org/pub/archive/fedora/linux/updates/%s/Everything/%s/debug/Packages/k/",
-}
-
-func NewFedoraRepo() Repository {
-	return &FedoraRepo{
-		archs: map[string]string{
-			"x86_64": "x86_64",
-			"arm64":  "aarch64",
-		},
-		repos: map[string][]string{
-			"24": olderRepoOrganization, // amd64
-			"25": oldRepoOrganization,   // amd64
-			"26": oldRepoOrganization,   // amd64
-			"27": oldRepoOrganization,   // amd64
-			"28": repoOrganization,      // amd64, arm64
-			"29": repoOrganization,      // amd64, arm64
-			"30": repoOrganization,      // amd64, arm64
-			"31": repoOrganization,      // amd64, arm64
-			// "32": repoOrganization,
-			// "33": repoOrganization,
-			// "34": repoOrganization,
-			// "35": repoOrganization,
-			// "36": repoOrganization,
-			// ...
-		},
-	}
+func NewFedoraRepo(distro *config.Distro) Repository {
+	return &FedoraRepo{distro: distro}
 }
 
 func (d *FedoraRepo) GetKernelPackages(
 	ctx context.Context,
-	workDir string,
 	release string,
 	arch string,
 	opts RepoOptions,
-	chans *JobChannels,
-) error {
-
-	if release == "24" || release == "25" || release == "26" || release == "27" {
-		if arch == "arm64" {
-			log.Printf("INFO: Fedora %s does not have arm64 packages\n", release)
-			return nil
-		}
-	}
-
+) (map[string][]pkg.Package, error) {
 	var pkgs []pkg.Package
 	var links []string
-	var repos []string
-
-	altArch := d.archs[arch]
 
-	for _, r := range d.repos[release] {
-		repoURL := fmt.Sprintf(r, release, altArch)
-		repos = append(repos, repoURL)
-	}
+	altArch := d.distro.Archs[arch]
+	repos := d.distro.Release(release).RepoURLs(arch)
 
 	// Pick all the links from multiple repositories
 
@@ -121,5 +70,5 @@ func (d *FedoraRepo) GetKernelPackages(
 
 	sort.Sort(pkg.ByVersion(pkgs)) // so kernels can be skipped if previous has BTF already
 
-	return processPackages(ctx, workDir, pkgs, opts, chans)
+	return map[string][]pkg.Package{"": pkgs}, nil
 }
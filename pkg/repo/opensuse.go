@@ -6,86 +6,38 @@ import (
 	"log"
 	"net/url"
 	"regexp"
-	"slices"
 	"sort"
 	"strings"
 
-	"golang.org/x/sync/errgroup"
-
+	"github.com/DataDog/btfhub/pkg/config"
 	"github.com/DataDog/btfhub/pkg/kernel"
 	"github.com/DataDog/btfhub/pkg/pkg"
 	"github.com/DataDog/btfhub/pkg/utils"
 )
 
 type openSUSERepo struct {
-	archs       map[string]string
-	repoAliases map[string]string
-	repos       map[string]map[string][]string
-}
-
-var oldOpenSUSERepos = map[string][]string{
-	"x86_64": {
-		"https://download.opensuse.org/debug/distribution/leap/%s/repo/oss/",
-		"https://download.opensuse.org/debug/update/leap/%s/oss/",
-	},
-	"aarch64": {
-		"https://download.opensuse.org/ports/aarch64/debug/distribution/leap/%s/repo/oss/",
-	},
+	distro *config.Distro
 }
 
-var newOpenSUSERepos = map[string][]string{
-	"x86_64": {
-		"https://download.opensuse.org/debug/distribution/leap/%s/repo/oss/",
-		"https://download.opensuse.org/debug/update/leap/%s/oss/",
-		"https://download.opensuse.org/debug/update/leap/%s/sle/",
-	},
-	"aarch64": {
-		"https://download.opensuse.org/debug/distribution/leap/%s/repo/oss/",
-		"https://download.opensuse.org/debug/update/leap/%s/oss/",
-		"https://download.opensuse.org/debug/update/leap/%s/sle/",
-		"https://download.opensuse.org/ports/aarch64/debug/distribution/leap/%s/repo/oss/",
-	},
+func NewOpenSUSERepo(distro *config.Distro) Repository {
+	return &openSUSERepo{distro: distro}
 }
 
-var ignoredOpenSUSEFlavors = []string{"debug", "vanilla", "preempt", "rt", "rt_debug"}
-
-func NewOpenSUSERepo() Repository {
-	return &openSUSERepo{
-		archs: map[string]string{
-			"x86_64": "x86_64",
-			"arm64":  "aarch64",
-		},
-		repoAliases: map[string]string{},
-		repos: map[string]map[string][]string{
-			"15.0": oldOpenSUSERepos,
-			"15.1": oldOpenSUSERepos,
-			"15.2": {
-				"x86_64": {
-					"https://download.opensuse.org/debug/distribution/leap/%s/repo/oss/",
-					"https://download.opensuse.org/debug/update/leap/%s/oss/",
-				},
-				"aarch64": {
-					"https://download.opensuse.org/ports/aarch64/debug/distribution/leap/%s/repo/oss/",
-					"https://download.opensuse.org/debug/update/leap/%s/oss/",
-				},
-			},
-			"15.3": newOpenSUSERepos,
-		},
-	}
-}
-
-func (d *openSUSERepo) GetKernelPackages(ctx context.Context, workDir string, release string, arch string, opts RepoOptions, chans *JobChannels) error {
-	altArch := d.archs[arch]
-	repoURLs := d.repos[release][altArch]
+func (d *openSUSERepo) GetKernelPackages(
+	ctx context.Context,
+	release string,
+	arch string,
+	opts RepoOptions,
+) (map[string][]pkg.Package, error) {
+	altArch := d.distro.Archs[arch]
 
 	var links []string
-	for _, repoURLFormat := range repoURLs {
-		repoURL := fmt.Sprintf(repoURLFormat, release)
+	for _, repoURL := range d.distro.Release(release).RepoURLs(arch) {
 		// get repo directory and find primary index URL
 		repoDirectoryURL, _ := url.JoinPath(repoURL, "repodata/repomd.xml")
 		repolinks, err := utils.GetRelativeLinks(ctx, repoDirectoryURL, repoURL)
 		if err != nil {
-			return fmt.Errorf("ERROR: list repodata files: %s", err)
+			return nil, fmt.Errorf("ERROR: list repodata files: %s", err)
 		}
 		var primaryURL string
 		for _, l := range repolinks {
@@ -95,13 +47,13 @@ func (d *openSUSERepo) GetKernelPackages(ctx context.Context, workDir string, re
 			}
 		}
 		if primaryURL == "" {
-			return fmt.Errorf("unable to find primary repodata in %s", repoDirectoryURL)
+			return nil, fmt.Errorf("unable to find primary repodata in %s", repoDirectoryURL)
 		}
 
 		// get package links from primary index URL
 		rlinks, err := utils.GetRelativeLinks(ctx, primaryURL, repoURL)
 		if err != nil {
-			return fmt.Errorf("ERROR: list packages: %s", err)
+			return nil, fmt.Errorf("ERROR: list packages: %s", err)
 		}
 		links = append(links, rlinks...)
 	}
@@ -116,7 +68,7 @@ func (d *openSUSERepo) GetKernelPackages(ctx context.Context, workDir string, re
 		}
 		name := strings.TrimPrefix(strings.TrimSuffix(match[0], ".rpm"), "/")
 		flavor, ver := match[1], match[2]
-		if slices.Contains(ignoredOpenSUSEFlavors, flavor) {
+		if !d.distro.AllowsFlavor(flavor) {
 			continue
 		}
 
@@ -147,16 +99,5 @@ func (d *openSUSERepo) GetKernelPackages(ctx context.Context, workDir string, re
 		log.Printf("DEBUG: %s %s flavor %d kernels\n", arch, kt, len(ks))
 	}
 
-	g, ctx := errgroup.WithContext(ctx)
-	for kt, ks := range pkgsByKernelType {
-		ckt := kt
-		cks := ks
-		g.Go(func() error {
-			log.Printf("DEBUG: start kernel type %s %s (%d pkgs)\n", ckt, arch, len(cks))
-			err := processPackages(ctx, workDir, cks, opts, chans)
-			log.Printf("DEBUG: end kernel type %s %s\n", ckt, arch)
-			return err
-		})
-	}
-	return g.Wait()
+	return pkgsByKernelType, nil
 }
@@ -7,50 +7,43 @@ import (
 	"sort"
 	"strings"
 
+	"github.com/DataDog/btfhub/pkg/config"
 	"github.com/DataDog/btfhub/pkg/kernel"
 	"github.com/DataDog/btfhub/pkg/pkg"
 	"github.com/DataDog/btfhub/pkg/utils"
 )
 
 type oracleRepo struct {
-	archs      map[string]string
-	repos      map[string]string
+	distro     *config.Distro
 	minVersion kernel.Version
 }
 
-func NewOracleRepo() Repository {
+func NewOracleRepo(distro *config.Distro) Repository {
 	return &oracleRepo{
-		archs: map[string]string{
-			"arm64":  "aarch64",
-			"x86_64": "x86_64",
-		},
-		repos: map[string]string{
-			"7": "https://oss.oracle.com/ol7/debuginfo/",
-			"8": "https://oss.oracle.com/ol8/debuginfo/",
-		},
-		minVersion: kernel.NewKernelVersion("3.10.0-957"),
+		distro:     distro,
+		minVersion: kernel.NewKernelVersion(distro.MinVersion),
 	}
 }
 
 func (d *oracleRepo) GetKernelPackages(
 	ctx context.Context,
-	workDir string,
 	release string,
 	arch string,
 	opts RepoOptions,
-	chans *JobChannels,
-) error {
+) (map[string][]pkg.Package, error) {
 	var pkgs []pkg.Package
 
-	altArch := d.archs[arch]
+	altArch := d.distro.Archs[arch]
 
 	// Pick all the links that match the kernel-debuginfo pattern
 
-	repoURL := d.repos[release]
-
-	links, err := utils.GetLinks(ctx, repoURL)
-	if err != nil {
-		return fmt.Errorf("ERROR: list packages: %s", err)
+	var links []string
+	for _, repoURL := range d.distro.Release(release).RepoURLs(arch) {
+		rlinks, err := utils.GetLinks(ctx, repoURL)
+		if err != nil {
+			return nil, fmt.Errorf("ERROR: list packages: %s", err)
+		}
+		links = append(links, rlinks...)
 	}
 
 	kre := regexp.MustCompile(fmt.Sprintf(`kernel(?:-uek)?-debuginfo-([0-9].*\.%s)\.rpm`, altArch))
@@ -69,7 +62,7 @@ func (d *oracleRepo) GetKernelPackages(
 				KernelVersion: kernel.NewKernelVersion(match[1]),
 				IgnoredFiles:  []string{"ctf"},
 			}
-			if p.Version().Less(d.minVersion) {
+			if !d.minVersion.IsZero() && p.Version().Less(d.minVersion) {
 				continue
 			}
 
@@ -79,5 +72,5 @@ func (d *oracleRepo) GetKernelPackages(
 
 	sort.Sort(pkg.ByVersion(pkgs)) // so kernels can be skipped if previous has BTF already
 
-	return processPackages(ctx, workDir, pkgs, opts, chans)
+	return map[string][]pkg.Package{"": pkgs}, nil
 }
@@ -0,0 +1,213 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/DataDog/btfhub/pkg/catalog"
+	"github.com/DataDog/btfhub/pkg/pkg"
+	"github.com/DataDog/btfhub/pkg/state"
+	"github.com/DataDog/btfhub/pkg/utils"
+)
+
+// Action is what processing a kernel package would do
+type Action string
+
+const (
+	// ActionSkipArchived skips a package whose BTF is already in the archive
+	ActionSkipArchived Action = "skip-archived"
+	// ActionSkipHasBTF skips a package whose kernel has embedded BTF
+	ActionSkipHasBTF Action = "skip-hasbtf"
+	// ActionSkipFailed skips a package which previously failed
+	ActionSkipFailed Action = "skip-failed"
+	// ActionGenerate generates, uploads and hashes the BTF
+	ActionGenerate Action = "generate"
+	// ActionUpload uploads and hashes an archived BTF which is missing in S3
+	ActionUpload Action = "upload"
+	// ActionHash only hashes an archived BTF
+	ActionHash Action = "hash"
+	// ActionConvert archives an archived BTF in the formats it is missing,
+	// then uploads and hashes it
+	ActionConvert Action = "convert"
+)
+
+// PackagePlan is the planned action for a single kernel package
+type PackagePlan struct {
+	Distro  string `json:"distro"`
+	Release string `json:"release"`
+	Arch    string `json:"arch"`
+	pkg.Info
+	Action Action `json:"action"`
+	Reason string `json:"reason"`
+}
+
+// PlanPackages returns the action that ProcessPackages would take for each
+// package, without making any changes. Packages are returned in flavor and
+// version order.
+func PlanPackages(
+	ctx context.Context,
+	workDir string,
+	pkgsByFlavor map[string][]pkg.Package,
+	opts RepoOptions,
+) ([]PackagePlan, error) {
+	if opts.State == nil {
+		st, err := state.Open(workDir)
+		if err != nil {
+			return nil, err
+		}
+		opts.State = st
+	}
+
+	var plans []PackagePlan
+	for _, flavor := range slices.Sorted(maps.Keys(pkgsByFlavor)) {
+		var hasBTF pkg.Package
+		for _, p := range pkgsByFlavor[flavor] {
+			pp := PackagePlan{
+				Distro:  opts.Distro,
+				Release: opts.Release,
+				Arch:    opts.Arch,
+				Info:    p.Info(),
+			}
+			if hasBTF != nil {
+				// mirror processOrderedPackages, which stops at the first kernel with BTF
+				pp.Action = ActionSkipHasBTF
+				pp.Reason = fmt.Sprintf("earlier kernel %s has BTF", hasBTF.BTFFilename())
+				plans = append(plans, pp)
+				continue
+			}
+
+			action, reason, err := planPackage(ctx, p, workDir, opts)
+			if err != nil {
+				return nil, fmt.Errorf("plan %s: %w", p, err)
+			}
+			pp.Action, pp.Reason = action, reason
+			if action == ActionSkipHasBTF && opts.Ordered {
+				hasBTF = p
+			}
+			plans = append(plans, pp)
+		}
+	}
+	return plans, nil
+}
+
+// planPackage decides what processPackage should do with a package
+func planPackage(ctx context.Context, p pkg.Package, workDir string, opts RepoOptions) (Action, string, error) {
+	rec, ok := opts.State.Get(p.BTFFilename())
+	if ok && rec.Status == state.StatusHasBTF {
+		return ActionSkipHasBTF, "kernel has .BTF section", nil
+	}
+
+	retry := ""
+	if ok && rec.Status == state.StatusFailed && !opts.Force {
+		switch {
+		case opts.RetryFailed:
+			retry = "retry forced after " + failureReason(rec)
+		case opts.Retry.For(string(rec.Class)).Retry(rec.Attempts, rec.LastAttempt, time.Now()):
+			retry = "retry after " + failureReason(rec)
+		default:
+			return ActionSkipFailed, failureReason(rec), nil
+		}
+	}
+
+	fileExists := false
+	btfTarName := pkg.BTFArchiveName(p, opts.formats()[0])
+	key := path.Join(opts.StorePrefix, btfTarName)
+	if !opts.Force {
+		var ptr catalog.BTFEntry
+		blob := false
+		fileExists = utils.Exists(filepath.Join(workDir, btfTarName))
+		if !fileExists {
+			// content-addressed archives have a pointer to their blob
+			var err error
+			ptr, blob, err = readPointer(p, workDir)
+			if err != nil {
+				return "", "", err
+			}
+			if blob {
+				fileExists = true
+				key = ptr.Key
+			}
+		}
+		if fileExists {
+			if missing := missingFormats(p, workDir, ptr, blob, opts); len(missing) > 0 {
+				return ActionConvert, fmt.Sprintf("missing %s archive", strings.Join(missing, ", ")), nil
+			}
+		}
+		if fileExists && opts.Store == nil {
+			return ActionSkipArchived, "exists in archive", nil
+		}
+	}
+
+	if !fileExists {
+		if opts.Force {
+			return ActionGenerate, "forced", nil
+		}
+		if retry != "" {
+			return ActionGenerate, retry, nil
+		}
+		return ActionGenerate, "missing in archive", nil
+	}
+
+	// if the BTF file exists, check if it exists in the object store
+	exists, err := opts.Store.Exists(ctx, key)
+	if err != nil {
+		return "", "", err
+	}
+	if !exists {
+		return ActionUpload, "missing in store", nil
+	}
+	if opts.HashDir != "" {
+		return ActionHash, "exists in archive and store", nil
+	}
+	return ActionSkipArchived, "exists in archive and store", nil
+}
+
+// missingFormats returns the formats of opts which an archived package has no
+// archive in, from its pointer file if it is a blob
+func missingFormats(p pkg.Package, workDir string, ptr catalog.BTFEntry, blob bool, opts RepoOptions) []string {
+	var missing []string
+	for _, f := range opts.formats() {
+		if blob {
+			if _, ok := ptr.Archive(string(f)); !ok {
+				missing = append(missing, string(f))
+			}
+		} else if !utils.Exists(filepath.Join(workDir, pkg.BTFArchiveName(p, f))) {
+			missing = append(missing, string(f))
+		}
+	}
+	return missing
+}
+
+// readPointer reads the pointer file of a package in the content-addressed
+// layout, and returns false if there is none
+func readPointer(p pkg.Package, workDir string) (catalog.BTFEntry, bool, error) {
+	ptrPath := filepath.Join(workDir, pkg.BTFPointerName(p))
+	data, err := os.ReadFile(ptrPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return catalog.BTFEntry{}, false, nil
+	}
+	if err != nil {
+		return catalog.BTFEntry{}, false, err
+	}
+	entry, ok := catalog.ParseEntry(data)
+	if !ok || entry.Key == "" {
+		return catalog.BTFEntry{}, false, fmt.Errorf("invalid pointer file %s", ptrPath)
+	}
+	return entry, true, nil
+}
+
+func failureReason(rec state.Record) string {
+	stage := rec.Stage
+	if stage == "" {
+		stage = "unknown"
+	}
+	return fmt.Sprintf("%s failure in %s stage at %s after %d attempts: %s", rec.Class, stage, rec.LastAttempt.Format(time.RFC3339), rec.Attempts, rec.Error)
+}
@@ -0,0 +1,212 @@
+package repo
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/DataDog/btfhub/pkg/catalog"
+	"github.com/DataDog/btfhub/pkg/config"
+	"github.com/DataDog/btfhub/pkg/job"
+	"github.com/DataDog/btfhub/pkg/kernel"
+	"github.com/DataDog/btfhub/pkg/pkg"
+	"github.com/DataDog/btfhub/pkg/store"
+)
+
+func testPackage(version string) pkg.Package {
+	name := "kernel-debuginfo-" + version + ".x86_64"
+	return &pkg.FedoraPackage{
+		Name:          name,
+		Architecture:  "x86_64",
+		KernelVersion: kernel.NewKernelVersion(version),
+		NameOfFile:    version + ".x86_64",
+	}
+}
+
+func TestPlanPackages(t *testing.T) {
+	workDir := t.TempDir()
+	touch := func(name string) {
+		require.NoError(t, os.WriteFile(filepath.Join(workDir, name), nil, 0644))
+	}
+	touch("5.0.1-100.x86_64.btf.tar.xz")
+	touch("5.0.2-100.x86_64.failed")
+	touch("5.0.4-100.x86_64.hasbtf")
+
+	pkgs := map[string][]pkg.Package{"": {
+		testPackage("5.0.1-100"),
+		testPackage("5.0.2-100"),
+		testPackage("5.0.3-100"),
+		testPackage("5.0.4-100"),
+		testPackage("5.0.5-100"),
+	}}
+
+	plans, err := PlanPackages(context.Background(), workDir, pkgs, RepoOptions{Ordered: true, Distro: "fedora", Release: "31", Arch: "x86_64"})
+	require.NoError(t, err)
+	require.Len(t, plans, 5)
+
+	var actions []Action
+	for _, p := range plans {
+		actions = append(actions, p.Action)
+		assert.Equal(t, "fedora", p.Distro)
+	}
+	assert.Equal(t, []Action{ActionSkipArchived, ActionSkipFailed, ActionGenerate, ActionSkipHasBTF, ActionSkipHasBTF}, actions)
+	assert.Equal(t, "earlier kernel 5.0.4-100.x86_64 has BTF", plans[4].Reason)
+
+	plans, err = PlanPackages(context.Background(), workDir, pkgs, RepoOptions{Force: true})
+	require.NoError(t, err)
+	assert.Equal(t, ActionGenerate, plans[0].Action)
+	assert.Equal(t, ActionGenerate, plans[1].Action)
+	assert.Equal(t, ActionSkipHasBTF, plans[3].Action)
+	assert.Equal(t, ActionGenerate, plans[4].Action)
+
+	opts := RepoOptions{Retry: config.RetryPolicies{Other: config.RetryPolicy{MaxAttempts: 2}}}
+	plans, err = PlanPackages(context.Background(), workDir, pkgs, opts)
+	require.NoError(t, err)
+	assert.Equal(t, ActionGenerate, plans[1].Action)
+	assert.Contains(t, plans[1].Reason, "retry after other failure")
+
+	opts = RepoOptions{RetryFailed: true}
+	plans, err = PlanPackages(context.Background(), workDir, pkgs, opts)
+	require.NoError(t, err)
+	assert.Equal(t, ActionGenerate, plans[1].Action)
+	assert.Contains(t, plans[1].Reason, "retry forced")
+
+	// archived BTF is uploaded if it is missing in the object store
+	st, err := store.NewFile(t.TempDir(), store.Options{})
+	require.NoError(t, err)
+	opts = RepoOptions{Store: st, StorePrefix: "fedora/31/x86_64"}
+	plans, err = PlanPackages(context.Background(), workDir, pkgs, opts)
+	require.NoError(t, err)
+	assert.Equal(t, ActionUpload, plans[0].Action)
+	require.NoError(t, st.Upload(context.Background(), "fedora/31/x86_64/5.0.1-100.x86_64.btf.tar.xz", strings.NewReader(""), nil))
+	plans, err = PlanPackages(context.Background(), workDir, pkgs, opts)
+	require.NoError(t, err)
+	assert.Equal(t, ActionSkipArchived, plans[0].Action)
+}
+
+func TestPlanPointers(t *testing.T) {
+	workDir := t.TempDir()
+	btfHash := strings.Repeat("ab", 32)
+	key := catalog.BlobKey(btfHash, catalog.DefaultFormat)
+	assert.Equal(t, "blobs/sha256/ab/"+btfHash+".btf.tar.xz", key)
+	ptr := catalog.BTFEntry{SHA256: strings.Repeat("cd", 32), Key: key, BTFSHA256: btfHash}
+	require.NoError(t, catalog.WriteEntry(filepath.Join(workDir, "5.0.1-100.x86_64.btf.ptr"), ptr))
+	require.NoError(t, catalog.WriteEntry(filepath.Join(workDir, "5.0.2-100.x86_64.btf.ptr"), ptr))
+	require.NoError(t, os.WriteFile(filepath.Join(workDir, "5.0.3-100.x86_64.btf.ptr"), []byte("{}"), 0644))
+	pkgs := map[string][]pkg.Package{"": {testPackage("5.0.1-100"), testPackage("5.0.2-100")}}
+
+	plans, err := PlanPackages(context.Background(), workDir, pkgs, RepoOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, ActionSkipArchived, plans[0].Action)
+	assert.Equal(t, ActionSkipArchived, plans[1].Action)
+
+	// versions with the same BTF share the blob in the object store
+	st, err := store.NewFile(t.TempDir(), store.Options{})
+	require.NoError(t, err)
+	opts := RepoOptions{Store: st, StorePrefix: "fedora/31/x86_64"}
+	plans, err = PlanPackages(context.Background(), workDir, pkgs, opts)
+	require.NoError(t, err)
+	assert.Equal(t, ActionUpload, plans[0].Action)
+	require.NoError(t, st.Upload(context.Background(), key, strings.NewReader(""), nil))
+	plans, err = PlanPackages(context.Background(), workDir, pkgs, opts)
+	require.NoError(t, err)
+	assert.Equal(t, ActionSkipArchived, plans[0].Action)
+	assert.Equal(t, ActionSkipArchived, plans[1].Action)
+
+	_, err = PlanPackages(context.Background(), workDir, map[string][]pkg.Package{"": {testPackage("5.0.3-100")}}, RepoOptions{})
+	assert.Error(t, err, "invalid pointer file")
+}
+
+func TestPlanFormats(t *testing.T) {
+	workDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(workDir, "5.0.1-100.x86_64.btf.tar.xz"), nil, 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(workDir, "5.0.1-100.x86_64.btf.tar.zst"), []byte{1}, 0644))
+	pkgs := map[string][]pkg.Package{"": {testPackage("5.0.1-100")}}
+
+	// the archive of the catalog entry is in the first format
+	plans, err := PlanPackages(context.Background(), workDir, pkgs, RepoOptions{Formats: []pkg.ArchiveFormat{pkg.FormatZstd}})
+	require.NoError(t, err)
+	assert.Equal(t, ActionSkipArchived, plans[0].Action)
+	require.NoError(t, os.Remove(filepath.Join(workDir, "5.0.1-100.x86_64.btf.tar.zst")))
+	plans, err = PlanPackages(context.Background(), workDir, pkgs, RepoOptions{Formats: []pkg.ArchiveFormat{pkg.FormatZstd}})
+	require.NoError(t, err)
+	assert.Equal(t, ActionGenerate, plans[0].Action)
+
+	// variants are hashed from the archive directory
+	require.NoError(t, os.WriteFile(filepath.Join(workDir, "5.0.1-100.x86_64.btf.tar.zst"), []byte{1}, 0644))
+	opts := RepoOptions{Formats: []pkg.ArchiveFormat{pkg.FormatXZ, pkg.FormatZstd}, StorePrefix: "fedora/31/x86_64"}
+	variants, err := archiveVariants(testPackage("5.0.1-100"), workDir, opts)
+	require.NoError(t, err)
+	assert.Equal(t, []catalog.BTFVariant{{
+		Format: "tar.zst",
+		SHA256: "4bf5122f344554c53bde2ebb8cd2b7e3d1600ad631c385a5d7cce23c7785459a",
+		Size:   1,
+		Key:    "fedora/31/x86_64/5.0.1-100.x86_64.btf.tar.zst",
+	}}, variants)
+}
+
+func TestConvertFormats(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	btfChan := make(chan job.Job)
+	go func() { _ = job.StartWorker(ctx, btfChan, nil) }()
+	chans := &JobChannels{BTF: btfChan}
+
+	btfDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(btfDir, "5.0.1-100.x86_64.btf"), []byte{1}, 0644))
+	archiveDir := t.TempDir()
+	workDir := filepath.Join(archiveDir, "fedora", "31", "x86_64")
+	require.NoError(t, os.MkdirAll(workDir, 0775))
+	xzPath := filepath.Join(workDir, "5.0.1-100.x86_64.btf.tar.xz")
+	require.NoError(t, pkg.ArchiveBTF(ctx, btfDir, xzPath, pkg.FormatXZ))
+	p := testPackage("5.0.1-100")
+	pkgs := map[string][]pkg.Package{"": {p}}
+
+	// archived packages are archived in the formats they are missing
+	opts := RepoOptions{Formats: []pkg.ArchiveFormat{pkg.FormatXZ, pkg.FormatZstd}, StorePrefix: "fedora/31/x86_64", ArchiveDir: archiveDir, HashDir: t.TempDir()}
+	plans, err := PlanPackages(ctx, workDir, pkgs, opts)
+	require.NoError(t, err)
+	assert.Equal(t, ActionConvert, plans[0].Action)
+	assert.Equal(t, "missing tar.zst archive", plans[0].Reason)
+	require.NoError(t, runPackage(ctx, p, workDir, ActionConvert, opts, chans))
+	files, err := pkg.ArchiveFiles(filepath.Join(workDir, "5.0.1-100.x86_64.btf.tar.zst"), pkg.FormatZstd, "")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"5.0.1-100.x86_64.btf": "4bf5122f344554c53bde2ebb8cd2b7e3d1600ad631c385a5d7cce23c7785459a"}, files)
+	data, err := os.ReadFile(filepath.Join(opts.HashDir, "5.0.1-100.x86_64"))
+	require.NoError(t, err)
+	entry, ok := catalog.ParseEntry(data)
+	require.True(t, ok)
+	require.Len(t, entry.Variants, 1)
+	assert.Equal(t, "fedora/31/x86_64/5.0.1-100.x86_64.btf.tar.zst", entry.Variants[0].Key)
+	plans, err = PlanPackages(ctx, workDir, pkgs, opts)
+	require.NoError(t, err)
+	assert.Equal(t, ActionSkipArchived, plans[0].Action)
+
+	// blobs are converted, and added to the pointer
+	btfHash := strings.Repeat("ab", 32)
+	key := catalog.BlobKey(btfHash, catalog.DefaultFormat)
+	require.NoError(t, os.MkdirAll(filepath.Dir(opts.blobPath(key)), 0775))
+	require.NoError(t, os.Rename(xzPath, opts.blobPath(key)))
+	require.NoError(t, os.Remove(filepath.Join(workDir, "5.0.1-100.x86_64.btf.tar.zst")))
+	ptrPath := filepath.Join(workDir, "5.0.1-100.x86_64.btf.ptr")
+	require.NoError(t, catalog.WriteEntry(ptrPath, catalog.BTFEntry{SHA256: strings.Repeat("cd", 32), Key: key, BTFSHA256: btfHash}))
+	plans, err = PlanPackages(ctx, workDir, pkgs, opts)
+	require.NoError(t, err)
+	assert.Equal(t, ActionConvert, plans[0].Action)
+	require.NoError(t, runPackage(ctx, p, workDir, ActionConvert, opts, chans))
+	zstKey := catalog.BlobKey(btfHash, "tar.zst")
+	assert.FileExists(t, opts.blobPath(zstKey))
+	ptr, ok, err := readPointer(p, workDir)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Len(t, ptr.Variants, 1)
+	assert.Equal(t, zstKey, ptr.Variants[0].Key)
+	plans, err = PlanPackages(ctx, workDir, pkgs, opts)
+	require.NoError(t, err)
+	assert.Equal(t, ActionSkipArchived, plans[0].Action)
+}
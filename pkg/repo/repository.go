@@ -2,10 +2,15 @@ package repo
 
 import (
 	"context"
+	"path/filepath"
 	"regexp"
 
 	"github.com/DataDog/btfhub/pkg/catalog"
+	"github.com/DataDog/btfhub/pkg/config"
 	"github.com/DataDog/btfhub/pkg/job"
+	"github.com/DataDog/btfhub/pkg/pkg"
+	"github.com/DataDog/btfhub/pkg/state"
+	"github.com/DataDog/btfhub/pkg/store"
 )
 
 type RepoOptions struct {
@@ -22,10 +27,56 @@ type RepoOptions struct {
 	Release string
 	Distro  string
 
-	// S3Bucket is the AWS S3 bucket where uploaded BTFs should be stored
-	S3Bucket string
-	// S3Prefix is the key prefix used when uploading BTFs
-	S3Prefix string
+	// Store is the object store where BTFs are uploaded, if set
+	Store store.ObjectStore
+	// StorePrefix is the key prefix used when uploading BTFs
+	StorePrefix string
+
+	// ContentAddressed stores an archive per distinct BTF, as a blob keyed by
+	// the hash of the BTF, and a pointer file per kernel version, see
+	// catalog.BlobKey
+	ContentAddressed bool
+	// ArchiveDir is the archive directory, where blobs are stored
+	ArchiveDir string
+	// Formats are the formats of the archives of each BTF, tar.xz if not
+	// set. The first one is the archive of the catalog entry, and the others
+	// are its variants.
+	Formats []pkg.ArchiveFormat
+	// Merger merges the BTF of vmlinux and of kernel modules, bpftool if not
+	// set
+	Merger job.Merger
+
+	// Retry has the retry policies of failed packages
+	Retry config.RetryPolicies
+	// RetryFailed retries failed packages regardless of the retry policies
+	RetryFailed bool
+
+	// State is the package state ledger of the archive directory, opened
+	// from the archive directory if not set
+	State *state.Store
+}
+
+// blobPath returns the path of a blob in the archive directory
+func (opts RepoOptions) blobPath(key string) string {
+	return filepath.Join(opts.ArchiveDir, filepath.FromSlash(key))
+}
+
+// formats returns the formats of the archives, the first one being the
+// archive of the catalog entry
+func (opts RepoOptions) formats() []pkg.ArchiveFormat {
+	if len(opts.Formats) == 0 {
+		return []pkg.ArchiveFormat{pkg.FormatXZ}
+	}
+	return opts.Formats
+}
+
+// entryFormat returns the format of catalog entries, which is not set for the
+// default format
+func (opts RepoOptions) entryFormat() string {
+	if f := opts.formats()[0]; f != pkg.FormatXZ {
+		return string(f)
+	}
+	return ""
 }
 
 type JobChannels struct {
@@ -34,12 +85,13 @@ type JobChannels struct {
 }
 
 type Repository interface {
+	// GetKernelPackages discovers the kernel packages of a release and arch.
+	// Packages are keyed by kernel flavor and sorted by version, so that
+	// later kernels of a flavor can be skipped once BTF is detected.
 	GetKernelPackages(
 		ctx context.Context,
-		workDir string,
 		release string,
 		arch string,
 		opts RepoOptions,
-		chans *JobChannels,
-	) error
+	) (map[string][]pkg.Package, error)
 }
@@ -0,0 +1,284 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+
+	"github.com/DataDog/btfhub/pkg/btf"
+	"github.com/DataDog/btfhub/pkg/catalog"
+	"github.com/DataDog/btfhub/pkg/job"
+	"github.com/DataDog/btfhub/pkg/pkg"
+	"github.com/DataDog/btfhub/pkg/state"
+)
+
+// Stage is a stage of the generation of BTF archives, whose output may
+// diverge from the published archives when they are reproduced
+type Stage string
+
+const (
+	// StageExtraction is a different kernel package, or different kernel
+	// modules extracted from it
+	StageExtraction Stage = "extraction"
+	// StagePahole is different BTF generated by pahole from the same kernel
+	StagePahole Stage = "pahole"
+	// StageMerge is the same BTF generated by pahole, merged differently
+	StageMerge Stage = "merge"
+	// StageCompression is the same BTF in different archives
+	StageCompression Stage = "compression"
+)
+
+// Reproduction is the result of regenerating the BTF archives of a published
+// kernel, to find the first stage whose output diverged
+type Reproduction struct {
+	// Stage is empty if the archives are identical
+	Stage  Stage  `json:"stage,omitempty"`
+	Detail string `json:"detail,omitempty"`
+	// Published is the catalog entry, and Reproduced is the entry of the
+	// regenerated archives, whose keys are their paths in the scratch
+	// directory
+	Published  catalog.BTFEntry `json:"published"`
+	Reproduced catalog.BTFEntry `json:"reproduced"`
+}
+
+// Reproduce regenerates the BTF of a package in dir, with archives in the
+// formats of the published catalog entry, and compares them with the
+// published archives, which are read from the archive directory if their
+// BTF differs. The BTF of each stage is kept in dir.
+func Reproduce(ctx context.Context, p pkg.Package, dir string, published catalog.BTFEntry, opts RepoOptions, chans *JobChannels) (Reproduction, error) {
+	r := Reproduction{Published: published}
+	if err := os.MkdirAll(dir, 0775); err != nil {
+		return r, err
+	}
+	b, err := buildBTF(ctx, p, opts, chans, dir)
+	if err != nil {
+		return r, err
+	}
+	r.Reproduced, err = newEntry(p, b, opts)
+	if err != nil {
+		return r, err
+	}
+	r.Reproduced.Format = published.Format
+
+	// the BTF of blobs is named after its hash, see generateBTFFile
+	if published.BTFSHA256 != "" && published.Key == catalog.BlobKey(published.BTFSHA256, published.ArchiveFormat()) {
+		btfPath := filepath.Join(b.mergeDir, r.Reproduced.BTFSHA256+".btf")
+		if err := os.Rename(b.path, btfPath); err != nil {
+			return r, fmt.Errorf("rename: %s", err)
+		}
+		if b.vmlinux == b.path {
+			b.vmlinux = btfPath
+		}
+		b.path = btfPath
+	}
+	for _, archive := range published.Archives() {
+		f := pkg.ArchiveFormat(archive.Format)
+		archivePath := filepath.Join(dir, pkg.BTFArchiveName(p, f))
+		compressJob := &job.BTFCompressionJob{
+			SourceDir:  b.mergeDir,
+			BTFTarPath: archivePath,
+			Format:     f,
+			ReplyChan:  make(chan any),
+		}
+		if err := job.SubmitAndWait(ctx, compressJob, chans.BTF); err != nil {
+			return r, state.WithStage(state.StageCompress, err)
+		}
+		reproduced, err := hashArchive(archivePath, f, archivePath)
+		if err != nil {
+			return r, err
+		}
+		r.Reproduced.SetArchive(reproduced)
+	}
+
+	r.Stage, r.Detail, err = compareReproduction(published, r.Reproduced, publishedArchives(p, published, opts), b, dir)
+	return r, err
+}
+
+// publishedArchives returns the paths of the published archives of a catalog
+// entry in the archive directory, by format
+func publishedArchives(p pkg.Package, published catalog.BTFEntry, opts RepoOptions) map[string]string {
+	paths := map[string]string{}
+	for _, archive := range published.Archives() {
+		key := archive.Key
+		if key == "" {
+			key = path.Join(opts.StorePrefix, pkg.BTFArchiveName(p, pkg.ArchiveFormat(archive.Format)))
+		}
+		paths[archive.Format] = opts.blobPath(key)
+	}
+	return paths
+}
+
+// compareReproduction returns the first stage whose output diverged between
+// the published and the reproduced archives, and why, or an empty stage if
+// the archives are identical
+func compareReproduction(published, reproduced catalog.BTFEntry, archives map[string]string, b builtBTF, dir string) (Stage, string, error) {
+	publishedHashes := map[string]string{}
+	for _, archive := range published.Archives() {
+		publishedHashes[archive.Format] = archive.SHA256
+	}
+	var differ []string
+	for _, archive := range reproduced.Archives() {
+		if hash, ok := publishedHashes[archive.Format]; ok && hash != archive.SHA256 {
+			differ = append(differ, archive.Format)
+		}
+	}
+	if len(differ) == 0 {
+		return "", "", nil
+	}
+
+	// the hash of the published BTF is in the catalog, unless the entry
+	// predates it, but the BTF itself is only in the archive
+	btfHash := published.BTFSHA256
+	var btfPath string
+	if btfHash != reproduced.BTFSHA256 {
+		var err error
+		btfPath, btfHash, err = extractPublished(archives[differ[0]], pkg.ArchiveFormat(differ[0]), filepath.Join(dir, "published"))
+		if err != nil {
+			return "", "", fmt.Errorf("published archive: %w", err)
+		}
+	}
+	if btfHash == reproduced.BTFSHA256 {
+		return StageCompression, fmt.Sprintf("identical BTF in different %s archives", strings.Join(differ, " and ")), nil
+	}
+
+	if published.SourcePackage != "" && published.SourcePackage != reproduced.SourcePackage {
+		return StageExtraction, fmt.Sprintf("published from package %s", published.SourcePackage), nil
+	}
+	if published.SourceURL != "" && published.SourceURL != reproduced.SourceURL {
+		return StageExtraction, fmt.Sprintf("published from %s", published.SourceURL), nil
+	}
+	// HasModules is not set either for entries which predate provenance
+	if !published.GeneratedAt.IsZero() && published.HasModules != reproduced.HasModules {
+		if published.HasModules {
+			return StageExtraction, "published with kernel module BTF, reproduced without", nil
+		}
+		return StageExtraction, "published without kernel module BTF, reproduced with", nil
+	}
+	return compareBTF(published, reproduced, btfPath, b)
+}
+
+// compareBTF compares the types of the published BTF with the BTF of vmlinux
+// generated by pahole, and with the reproduced BTF
+func compareBTF(published, reproduced catalog.BTFEntry, btfPath string, b builtBTF) (Stage, string, error) {
+	publishedSpec, err := btf.LoadFile(btfPath, nil)
+	if err != nil {
+		return "", "", fmt.Errorf("published BTF: %w", err)
+	}
+	vmlinux, err := btf.LoadFile(b.vmlinux, nil)
+	if err != nil {
+		return "", "", fmt.Errorf("vmlinux BTF: %w", err)
+	}
+	reproducedSpec, err := btf.LoadFile(b.path, nil)
+	if err != nil {
+		return "", "", fmt.Errorf("reproduced BTF: %w", err)
+	}
+	paholeDetail := func(detail string) string {
+		if published.PaholeVersion != "" && published.PaholeVersion != reproduced.PaholeVersion {
+			detail += fmt.Sprintf(", published with pahole %s", published.PaholeVersion)
+		}
+		return detail
+	}
+	mergerDetail := func(detail string) string {
+		if published.Merger != "" && published.Merger != reproduced.Merger {
+			detail += fmt.Sprintf(", published merged by %s", published.Merger)
+		}
+		return detail
+	}
+
+	// merged BTF starts with the types of vmlinux
+	if id := btf.FirstDifference(publishedSpec, vmlinux, vmlinux.NumTypes()); id != 0 {
+		return StagePahole, paholeDetail("vmlinux " + describeType(publishedSpec, reproducedSpec, id)), nil
+	}
+	id := btf.FirstDifference(publishedSpec, reproducedSpec, -1)
+	switch {
+	case id == 0 && b.modules == 0:
+		return StagePahole, paholeDetail("identical types, encoded differently"), nil
+	case id == 0:
+		return StageMerge, mergerDetail("identical types, encoded differently"), nil
+	case publishedSpec.NumTypes() == vmlinux.NumTypes():
+		return StageExtraction, fmt.Sprintf("published BTF has no kernel module types, reproduced BTF has %d", reproducedSpec.NumTypes()-vmlinux.NumTypes()), nil
+	case b.modules == 0:
+		return StageExtraction, fmt.Sprintf("published BTF has %d kernel module types, no kernel modules were extracted", publishedSpec.NumTypes()-vmlinux.NumTypes()), nil
+	case published.PaholeVersion != "" && published.PaholeVersion != reproduced.PaholeVersion:
+		return StagePahole, paholeDetail("kernel module " + describeType(publishedSpec, reproducedSpec, id)), nil
+	default:
+		return StageMerge, mergerDetail("identical vmlinux types, kernel module " + describeType(publishedSpec, reproducedSpec, id)), nil
+	}
+}
+
+// describeType describes a type which differs between the published and the
+// reproduced BTF
+func describeType(published, reproduced *btf.Spec, id btf.TypeID) string {
+	describe := func(s *btf.Spec) string {
+		t, err := s.TypeByID(id)
+		if err != nil {
+			return "missing"
+		}
+		return strings.TrimSpace(fmt.Sprintf("%s %s", t.Kind, t.Name))
+	}
+	return fmt.Sprintf("type %d differs: published %s, reproduced %s", id, describe(published), describe(reproduced))
+}
+
+// extractPublished extracts the BTF of a published archive to dir, and
+// returns its path and hash
+func extractPublished(archivePath string, format pkg.ArchiveFormat, dir string) (string, string, error) {
+	if err := os.MkdirAll(dir, 0775); err != nil {
+		return "", "", err
+	}
+	files, err := pkg.ArchiveFiles(archivePath, format, dir)
+	if err != nil {
+		return "", "", err
+	}
+	if len(files) != 1 {
+		return "", "", fmt.Errorf("%s has %d files, expected one BTF file", archivePath, len(files))
+	}
+	for name, hash := range files {
+		return filepath.Join(dir, name), hash, nil
+	}
+	return "", "", nil
+}
+
+// Tools are the versions of the tools which generate BTF archives
+type Tools struct {
+	Pahole  string `json:"pahole"`
+	Bpftool string `json:"bpftool"`
+	// Btfhub writes the archives, and merges the BTF of kernel modules with
+	// -merger go
+	Btfhub string `json:"btfhub"`
+	// XZ and Zstd are the versions of the Go modules of the encoders
+	XZ   string `json:"xz"`
+	Zstd string `json:"zstd"`
+}
+
+// ToolVersions returns the versions of the tools used by this binary
+func ToolVersions() Tools {
+	var tools Tools
+	pahole, err := job.PaholeVersion()
+	if err != nil {
+		pahole = fmt.Sprintf("unknown (%s)", err)
+	}
+	tools.Pahole = pahole
+	bpftool, err := job.BpftoolVersion()
+	if err != nil {
+		bpftool = fmt.Sprintf("unknown (%s)", err)
+	}
+	tools.Bpftool = bpftool
+	tools.Btfhub = job.BtfhubVersion()
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return tools
+	}
+	for _, dep := range info.Deps {
+		switch dep.Path {
+		case "github.com/ulikunitz/xz":
+			tools.XZ = dep.Version
+		case "github.com/DataDog/zstd":
+			tools.Zstd = dep.Version
+		}
+	}
+	return tools
+}
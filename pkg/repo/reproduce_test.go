@@ -0,0 +1,119 @@
+package repo
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/DataDog/btfhub/pkg/btf"
+	"github.com/DataDog/btfhub/pkg/catalog"
+	"github.com/DataDog/btfhub/pkg/pkg"
+	"github.com/DataDog/btfhub/pkg/utils"
+)
+
+// testVMLinux returns the BTF of vmlinux, with a struct named name
+func testVMLinux(name string) *btf.Spec {
+	s := btf.NewSpec(nil)
+	intID := s.Add(&btf.Type{Kind: btf.KindInt, Name: "int", SizeType: 4, Extra: 32})
+	s.Add(&btf.Type{Kind: btf.KindStruct, Name: name, SizeType: 4, Members: []btf.Member{{Name: "a", Type: intID}}})
+	return s
+}
+
+// testMerged returns the BTF of vmlinux merged with a kernel module with a
+// variable named name
+func testMerged(t *testing.T, vmlinux *btf.Spec, name string) *btf.Spec {
+	data, err := vmlinux.Marshal()
+	require.NoError(t, err)
+	base, err := btf.Parse(data, nil)
+	require.NoError(t, err)
+	mod := btf.NewSpec(base)
+	mod.Add(&btf.Type{Kind: btf.KindVar, Name: name, SizeType: 1, Extra: 1})
+	data, err = mod.Marshal()
+	require.NoError(t, err)
+	mod, err = btf.Parse(data, base)
+	require.NoError(t, err)
+	merged, err := btf.Merge(base, mod)
+	require.NoError(t, err)
+	return merged
+}
+
+// testArchive writes an archive of the BTF, named name, and returns its entry
+func testArchive(t *testing.T, s *btf.Spec, name string) (catalog.BTFEntry, string) {
+	dir := t.TempDir()
+	btfPath := filepath.Join(dir, "btf", name)
+	require.NoError(t, os.Mkdir(filepath.Dir(btfPath), 0775))
+	require.NoError(t, s.WriteFile(btfPath))
+	btfHash, err := utils.SHA256File(btfPath)
+	require.NoError(t, err)
+	archivePath := filepath.Join(dir, name+pkg.FormatXZ.Suffix())
+	require.NoError(t, pkg.ArchiveBTF(context.Background(), filepath.Dir(btfPath), archivePath, pkg.FormatXZ))
+	hash, err := utils.SHA256File(archivePath)
+	require.NoError(t, err)
+	return catalog.BTFEntry{SHA256: hash, BTFSHA256: btfHash, PaholeVersion: "v1.27", SourcePackage: "kernel"}, archivePath
+}
+
+func TestCompareReproduction(t *testing.T) {
+	dir := t.TempDir()
+	vmlinux := testVMLinux("task_struct")
+	b := builtBTF{
+		genDir:   filepath.Join(dir, "btfgen"),
+		vmlinux:  filepath.Join(dir, "btfgen", "vmlinux"),
+		modules:  1,
+		mergeDir: filepath.Join(dir, "btfmerge"),
+		path:     filepath.Join(dir, "btfmerge", "5.0.1-100.x86_64.btf"),
+	}
+	require.NoError(t, os.Mkdir(b.genDir, 0775))
+	require.NoError(t, os.Mkdir(b.mergeDir, 0775))
+	require.NoError(t, vmlinux.WriteFile(b.vmlinux))
+	merged := testMerged(t, vmlinux, "mod_var")
+	require.NoError(t, merged.WriteFile(b.path))
+	reproduced, _ := testArchive(t, merged, "5.0.1-100.x86_64.btf")
+
+	compare := func(published catalog.BTFEntry, archivePath string) (Stage, string) {
+		stage, detail, err := compareReproduction(published, reproduced, map[string]string{"tar.xz": archivePath}, b, t.TempDir())
+		require.NoError(t, err)
+		return stage, detail
+	}
+
+	stage, _ := compare(reproduced, "")
+	assert.Equal(t, Stage(""), stage)
+
+	// the same BTF, archived under another name
+	published, archivePath := testArchive(t, merged, "other.btf")
+	stage, detail := compare(published, archivePath)
+	assert.Equal(t, StageCompression, stage)
+	assert.Equal(t, "identical BTF in different tar.xz archives", detail)
+
+	published, archivePath = testArchive(t, testMerged(t, vmlinux, "other_var"), "5.0.1-100.x86_64.btf")
+	stage, detail = compare(published, archivePath)
+	assert.Equal(t, StageMerge, stage)
+	assert.Equal(t, "identical vmlinux types, kernel module type 3 differs: published VAR other_var, reproduced VAR mod_var", detail)
+	published.Merger = "bpftool v7.4.0"
+	stage, detail = compare(published, archivePath)
+	assert.Equal(t, StageMerge, stage)
+	assert.Equal(t, "identical vmlinux types, kernel module type 3 differs: published VAR other_var, reproduced VAR mod_var, published merged by bpftool v7.4.0", detail)
+	published.PaholeVersion = "v1.25"
+	stage, detail = compare(published, archivePath)
+	assert.Equal(t, StagePahole, stage)
+	assert.Equal(t, "kernel module type 3 differs: published VAR other_var, reproduced VAR mod_var, published with pahole v1.25", detail)
+
+	published, archivePath = testArchive(t, testMerged(t, testVMLinux("mm_struct"), "mod_var"), "5.0.1-100.x86_64.btf")
+	stage, detail = compare(published, archivePath)
+	assert.Equal(t, StagePahole, stage)
+	assert.Equal(t, "vmlinux type 2 differs: published STRUCT mm_struct, reproduced STRUCT task_struct", detail)
+
+	published.SourcePackage = "kernel-debug"
+	stage, detail = compare(published, archivePath)
+	assert.Equal(t, StageExtraction, stage)
+	assert.Equal(t, "published from package kernel-debug", detail)
+
+	// without kernel modules, the types of vmlinux are all the types
+	published, archivePath = testArchive(t, vmlinux, "5.0.1-100.x86_64.btf")
+	stage, detail = compare(published, archivePath)
+	assert.Equal(t, StageExtraction, stage)
+	assert.Equal(t, "published BTF has no kernel module types, reproduced BTF has 1", detail)
+}
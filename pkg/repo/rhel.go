@@ -5,43 +5,39 @@ import (
 	"fmt"
 	"sort"
 
+	"github.com/DataDog/btfhub/pkg/config"
 	"github.com/DataDog/btfhub/pkg/kernel"
 	"github.com/DataDog/btfhub/pkg/pkg"
 )
 
 type RHELRepo struct {
-	archs      map[string]string
+	distro     *config.Distro
 	minVersion kernel.Version
 }
 
-func NewRHELRepo() Repository {
+func NewRHELRepo(distro *config.Distro) Repository {
 	return &RHELRepo{
-		archs: map[string]string{
-			"x86_64": "x86_64",
-			"arm64":  "aarch64",
-		},
-		minVersion: kernel.NewKernelVersion("3.10.0-957"),
+		distro:     distro,
+		minVersion: kernel.NewKernelVersion(distro.MinVersion),
 	}
 }
 
 func (d *RHELRepo) GetKernelPackages(
 	ctx context.Context,
-	workDir string,
 	_ string,
 	arch string,
 	opts RepoOptions,
-	chans *JobChannels,
-) error {
-	altArch := d.archs[arch]
+) (map[string][]pkg.Package, error) {
+	altArch := d.distro.Archs[arch]
 	searchOut, err := repoquery(ctx, "kernel-debuginfo", altArch)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	pkgs, err := parseRepoqueryPackages(searchOut, d.minVersion)
 	if err != nil {
-		return fmt.Errorf("parse package listing: %s", err)
+		return nil, fmt.Errorf("parse package listing: %s", err)
 	}
 	sort.Sort(pkg.ByVersion(pkgs))
 
-	return processPackages(ctx, workDir, pkgs, opts, chans)
+	return map[string][]pkg.Package{"": pkgs}, nil
 }
@@ -13,75 +13,53 @@ import (
 	"strings"
 	"unicode"
 
-	"golang.org/x/sync/errgroup"
-
+	"github.com/DataDog/btfhub/pkg/config"
 	"github.com/DataDog/btfhub/pkg/kernel"
 	"github.com/DataDog/btfhub/pkg/pkg"
 	"github.com/DataDog/btfhub/pkg/utils"
 )
 
 type suseRepo struct {
-	archs       map[string]string
+	distro      *config.Distro
 	repoAliases map[string]string
 }
 
-func NewSUSERepo() Repository {
+func NewSUSERepo(distro *config.Distro) Repository {
 	return &suseRepo{
-		archs: map[string]string{
-			"x86_64": "x86_64",
-			"arm64":  "aarch64",
-		},
+		distro:      distro,
 		repoAliases: map[string]string{},
 	}
 }
 
-func (d *suseRepo) GetKernelPackages(ctx context.Context, dir string, release string, arch string, opts RepoOptions, chans *JobChannels) error {
-	var repos []string
-	altArch := d.archs[arch]
-
-	switch release {
-	case "12.3":
-		repos = append(repos, fmt.Sprintf("SUSE_Linux_Enterprise_Server_12_SP3_%s:SLES12-SP3-Debuginfo-Pool", altArch))
-		repos = append(repos, fmt.Sprintf("SUSE_Linux_Enterprise_Server_12_SP3_%s:SLES12-SP3-Debuginfo-Updates", altArch))
-	case "12.4":
-		repos = append(repos, fmt.Sprintf("SUSE_Linux_Enterprise_Server_12_SP4_%s:SLES12-SP4-Debuginfo-Pool", altArch))
-		repos = append(repos, fmt.Sprintf("SUSE_Linux_Enterprise_Server_12_SP4_%s:SLES12-SP4-Debuginfo-Updates", altArch))
-	case "12.5":
-		repos = append(repos, fmt.Sprintf("SUSE_Linux_Enterprise_Server_%s:SLES12-SP5-Debuginfo-Pool", altArch))
-		repos = append(repos, fmt.Sprintf("SUSE_Linux_Enterprise_Server_%s:SLES12-SP5-Debuginfo-Updates", altArch))
-	case "15.0":
-		repos = append(repos, fmt.Sprintf("Basesystem_Module_15_%s:SLE-Module-Basesystem15-Debuginfo-Pool", altArch))
-		repos = append(repos, fmt.Sprintf("Basesystem_Module_15_%s:SLE-Module-Basesystem15-Debuginfo-Updates", altArch))
-	case "15.1":
-		repos = append(repos, fmt.Sprintf("Basesystem_Module_15_SP1_%s:SLE-Module-Basesystem15-SP1-Debuginfo-Pool", altArch))
-		repos = append(repos, fmt.Sprintf("Basesystem_Module_15_SP1_%s:SLE-Module-Basesystem15-SP1-Debuginfo-Updates", altArch))
-	case "15.2":
-		repos = append(repos, fmt.Sprintf("Basesystem_Module_15_SP2_%s:SLE-Module-Basesystem15-SP2-Debuginfo-Pool", altArch))
-		repos = append(repos, fmt.Sprintf("Basesystem_Module_15_SP2_%s:SLE-Module-Basesystem15-SP2-Debuginfo-Updates", altArch))
-	case "15.3":
-		repos = append(repos, fmt.Sprintf("Basesystem_Module_15_SP3_%s:SLE-Module-Basesystem15-SP3-Debuginfo-Pool", altArch))
-		repos = append(repos, fmt.Sprintf("Basesystem_Module_15_SP3_%s:SLE-Module-Basesystem15-SP3-Debuginfo-Updates", altArch))
-	}
+func (d *suseRepo) GetKernelPackages(
+	ctx context.Context,
+	release string,
+	arch string,
+	opts RepoOptions,
+) (map[string][]pkg.Package, error) {
+	altArch := d.distro.Archs[arch]
+	repos := d.distro.Release(release).RepoURLs(arch)
+
 	for _, r := range repos {
 		if _, err := utils.RunZypperCMD(ctx, "modifyrepo", "--enable", r); err != nil {
-			return err
+			return nil, err
 		}
 	}
 
 	if err := d.getRepoAliases(ctx); err != nil {
-		return fmt.Errorf("repo aliases: %s", err)
+		return nil, fmt.Errorf("repo aliases: %s", err)
 	}
 
 	// packages are named kernel-<type>-debuginfo
 	// possible types are: default, azure
 	searchOut, err := zypperSearch(ctx, "kernel-*-debuginfo")
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	pkgs, err := d.parseZypperPackages(searchOut, altArch)
 	if err != nil {
-		return fmt.Errorf("parse package listing: %s", err)
+		return nil, fmt.Errorf("parse package listing: %s", err)
 	}
 
 	pkgsByKernelType := make(map[string][]pkg.Package)
@@ -99,18 +77,7 @@ func (d *suseRepo) GetKernelPackages(ctx context.Context, dir string, release st
 		log.Printf("DEBUG: %s %s flavor %d kernels\n", arch, kt, len(ks))
 	}
 
-	g, ctx := errgroup.WithContext(ctx)
-	for kt, ks := range pkgsByKernelType {
-		ckt := kt
-		cks := ks
-		g.Go(func() error {
-			log.Printf("DEBUG: start kernel type %s %s (%d pkgs)\n", ckt, arch, len(cks))
-			err := processPackages(ctx, dir, cks, opts, chans)
-			log.Printf("DEBUG: end kernel type %s %s\n", ckt, arch)
-			return err
-		})
-	}
-	return g.Wait()
+	return pkgsByKernelType, nil
 }
 
 func (d *suseRepo) getRepoAliases(ctx context.Context) error {
@@ -163,7 +130,7 @@ func (d *suseRepo) parseZypperPackages(rdr io.Reader, arch string) ([]*pkg.SUSEP
 				return nil, fmt.Errorf("unknown repo %s", repo)
 			}
 			flavor := match[1]
-			if flavor == "preempt" {
+			if !d.distro.AllowsFlavor(flavor) {
 				continue
 			}
 
@@ -6,92 +6,94 @@ import (
 	"log"
 	"regexp"
 	"sort"
+	"strings"
 
-	"golang.org/x/sync/errgroup"
-
+	"github.com/DataDog/btfhub/pkg/config"
 	"github.com/DataDog/btfhub/pkg/pkg"
 )
 
 type UbuntuRepo struct {
-	repo         map[string]string // map[altArch]url
-	debugRepo    string            // url
-	kernelTypes  map[string]string // map[signed,unsigned]regex
-	archs        map[string]string // map[arch]altArch
-	releaseNames map[string]string // map[number]name
+	distro      *config.Distro
+	kernelTypes map[string]*regexp.Regexp // map[signed,unsigned]regex
 }
 
-func NewUbuntuRepo() Repository {
+// NewUbuntuRepo returns the repository of an ubuntu distro, whose flavors
+// must be set, see config.Distro.validate
+func NewUbuntuRepo(distro *config.Distro) Repository {
+	flavors := make([]string, len(distro.Flavors))
+	for i, f := range distro.Flavors {
+		flavors[i] = regexp.QuoteMeta(f)
+	}
+	pattern := strings.Join(flavors, "|")
 	return &UbuntuRepo{
-		repo: map[string]string{
-			"amd64": "http://archive.ubuntu.com/ubuntu",
-			"arm64": "http://ports.ubuntu.com",
-		},
-		debugRepo: "http://ddebs.ubuntu.com",
-		kernelTypes: map[string]string{
-			"signed":   "linux-image-[0-9.]+-.*-(generic|azure|gke|gkeop|gcp|aws)",
-			"unsigned": "linux-image-unsigned-[0-9.]+-.*-(generic|azure|gke|gkeop|gcp|aws)",
-		},
-		archs: map[string]string{
-			"x86_64": "amd64",
-			"arm64":  "arm64",
-		},
-		releaseNames: map[string]string{
-			"16.04": "xenial",
-			"18.04": "bionic",
-			"20.04": "focal",
+		distro: distro,
+		kernelTypes: map[string]*regexp.Regexp{
+			"signed":   regexp.MustCompile(fmt.Sprintf("linux-image-[0-9.]+-.*-(%s)-dbgsym", pattern)),
+			"unsigned": regexp.MustCompile(fmt.Sprintf("linux-image-unsigned-[0-9.]+-.*-(%s)-dbgsym", pattern)),
 		},
 	}
 }
 
+// flavor returns the flavor of a kernel debug package of a type, and whether
+// the flavor is processed
+func (uRepo *UbuntuRepo) flavor(ktype string, name string) (string, bool) {
+	match := uRepo.kernelTypes[ktype].FindStringSubmatch(name)
+	if match == nil || !uRepo.distro.AllowsFlavor(match[1]) {
+		return "", false
+	}
+	return match[1], true
+}
+
 // GetKernelPackages downloads Packages.xz from the main, updates and universe,
 // from the debug repo and parses the list of kernel packages to download. It
-// then filters out kernel packages that we already have or failed to download.
-// It then processes the list of kernel packages: they will be downloaded and then
-// the btf files will be extracted from them.
+// then filters the kernel packages by flavor and groups them by flavor.
 func (uRepo *UbuntuRepo) GetKernelPackages(
 	ctx context.Context,
-	workDir string,
 	release string,
 	arch string,
 	opts RepoOptions,
-	chans *JobChannels,
-) error {
-	altArch := uRepo.archs[arch]
-	releaseName := uRepo.releaseNames[release]
+) (map[string][]pkg.Package, error) {
+	altArch := uRepo.distro.Archs[arch]
+	rel := uRepo.distro.Release(release)
+	releaseName := rel.Name
 	filteredKernelDbgPkgMap := make(map[string]*pkg.UbuntuPackage) // map[filename]package
 
-	// Get Packages.xz from debug repo
-	dbgRawPkgs, err := pkg.GetPackageList(ctx, uRepo.debugRepo, releaseName, altArch)
-	if err != nil {
-		return fmt.Errorf("ddebs: %s", err)
-	}
-	// Get the list of kernel packages to download from debug repo
-	kernelDbgPkgs, err := pkg.ParseAPTPackages(dbgRawPkgs, uRepo.debugRepo, release, releaseName)
-	if err != nil {
-		return fmt.Errorf("parsing debug package list: %s", err)
+	var kernelDbgPkgs []*pkg.UbuntuPackage
+	for _, debugRepo := range rel.RepoURLs(arch) {
+		// Get Packages.xz from debug repo
+		dbgRawPkgs, err := pkg.GetPackageList(ctx, debugRepo, releaseName, altArch)
+		if err != nil {
+			return nil, fmt.Errorf("ddebs: %s", err)
+		}
+		// Get the list of kernel packages to download from debug repo
+		repoPkgs, err := pkg.ParseAPTPackages(dbgRawPkgs, debugRepo, release, releaseName)
+		if err != nil {
+			return nil, fmt.Errorf("parsing debug package list: %s", err)
+		}
+		kernelDbgPkgs = append(kernelDbgPkgs, repoPkgs...)
 	}
 
 	var lpDbgPkgs []*pkg.UbuntuPackage
 	if opts.Launchpad {
+		var err error
 		lpDbgPkgs, err = getLaunchpadPackages(ctx, release, releaseName, altArch)
 		if err != nil {
-			return fmt.Errorf("launchpad search: %s", err)
+			return nil, fmt.Errorf("launchpad search: %s", err)
 		}
 	}
 
 	for _, ktype := range []string{"unsigned", "signed"} {
-		re := regexp.MustCompile(fmt.Sprintf("%s-dbgsym", uRepo.kernelTypes[ktype]))
 		for _, pkgs := range [][]*pkg.UbuntuPackage{kernelDbgPkgs, lpDbgPkgs} {
 			for _, p := range pkgs {
-				match := re.FindStringSubmatch(p.Name)
-				if match == nil {
+				flavor, ok := uRepo.flavor(ktype, p.Name)
+				if !ok {
 					continue
 				}
 				if p.Size < 10_000_000 { // ignore smaller than 10MB (signed vs unsigned emptiness)
 					continue
 				}
-				// match = [filename = linux-image-{unsigned}-XXX-dbgsym, flavor = generic, gke, aws, ...]
-				p.Flavor = match[1]
+				// flavor = generic, gke, aws, ...
+				p.Flavor = flavor
 				if dp, ok := filteredKernelDbgPkgMap[p.Filename()]; !ok {
 					filteredKernelDbgPkgMap[p.Filename()] = p
 				} else {
@@ -132,21 +134,5 @@ func (uRepo *UbuntuRepo) GetKernelPackages(
 		log.Printf("DEBUG: %s %s flavor %d kernels\n", arch, flavor, len(pkgSlice))
 	}
 
-	g, ctx := errgroup.WithContext(ctx)
-
-	for flavor, pkgSlice := range pkgsByKernelFlavor {
-		theFlavor := flavor
-		thePkgSlice := pkgSlice
-
-		// Start a goroutine for each flavor to process all of its packages
-
-		g.Go(func() error {
-			log.Printf("DEBUG: start kernel flavor %s %s (%d pkgs)\n", theFlavor, arch, len(thePkgSlice))
-			err := processPackages(ctx, workDir, thePkgSlice, opts, chans)
-			log.Printf("DEBUG: end kernel flavor %s %s\n", theFlavor, arch)
-			return err
-		})
-	}
-
-	return g.Wait()
+	return pkgsByKernelFlavor, nil
 }
@@ -0,0 +1,34 @@
+package repo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/DataDog/btfhub/pkg/config"
+)
+
+func TestUbuntuFlavor(t *testing.T) {
+	uRepo := NewUbuntuRepo(&config.Distro{
+		Flavors:         []string{"generic", "aws", "lowlatency-64k", "a.b"},
+		ExcludedFlavors: []string{"lowlatency-64k"},
+	}).(*UbuntuRepo)
+
+	tests := map[string]struct {
+		ktype, name, flavor string
+	}{
+		"generic":         {"unsigned", "linux-image-unsigned-5.4.0-100-generic-dbgsym", "generic"},
+		"signed":          {"signed", "linux-image-5.4.0-1097-aws-dbgsym", "aws"},
+		"unknown flavor":  {"signed", "linux-image-5.4.0-1097-gcp-dbgsym", ""},
+		"excluded flavor": {"unsigned", "linux-image-unsigned-6.8.0-31-lowlatency-64k-dbgsym", ""},
+		"quoted flavor":   {"signed", "linux-image-5.4.0-100-aXb-dbgsym", ""},
+		"dotted flavor":   {"signed", "linux-image-5.4.0-100-a.b-dbgsym", "a.b"},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			flavor, ok := uRepo.flavor(tc.ktype, tc.name)
+			assert.Equal(t, tc.flavor != "", ok)
+			assert.Equal(t, tc.flavor, flavor)
+		})
+	}
+}
@@ -8,14 +8,46 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"time"
 
 	"golang.org/x/sync/errgroup"
 
+	"github.com/DataDog/btfhub/pkg/catalog"
 	"github.com/DataDog/btfhub/pkg/job"
 	"github.com/DataDog/btfhub/pkg/pkg"
+	"github.com/DataDog/btfhub/pkg/state"
 	"github.com/DataDog/btfhub/pkg/utils"
 )
 
+// ProcessPackages processes the packages of each kernel flavor concurrently,
+// sending jobs to the job channels.
+func ProcessPackages(
+	ctx context.Context,
+	workDir string,
+	pkgsByFlavor map[string][]pkg.Package,
+	opts RepoOptions,
+	chans *JobChannels,
+) error {
+	if opts.State == nil {
+		st, err := state.Open(workDir)
+		if err != nil {
+			return err
+		}
+		opts.State = st
+	}
+
+	g, ctx := errgroup.WithContext(ctx)
+	for flavor, pkgs := range pkgsByFlavor {
+		g.Go(func() error {
+			log.Printf("DEBUG: start kernel flavor %q %s (%d pkgs)\n", flavor, opts.Arch, len(pkgs))
+			err := processPackages(ctx, workDir, pkgs, opts, chans)
+			log.Printf("DEBUG: end kernel flavor %q %s\n", flavor, opts.Arch)
+			return err
+		})
+	}
+	return g.Wait()
+}
+
 // processPackages processes a list of packages, sending jobs to the job channel.
 func processPackages(
 	ctx context.Context,
@@ -46,7 +78,7 @@ func processUnorderedPackages(ctx context.Context, workDir string, pkgs []pkg.Pa
 				if errors.Is(err, context.Canceled) {
 					return nil
 				}
-				log.Printf("ERROR: %s: %s\n", gp, err)
+				log.Printf("ERROR: %s: %s (%s failure)\n", gp, err, state.Classify(err))
 			}
 			log.Printf("DEBUG: end pkg %s (%d/%d)\n", gp, pos, len(pkgs))
 			return nil
@@ -67,7 +99,7 @@ func processOrderedPackages(ctx context.Context, workDir string, pkgs []pkg.Pack
 			if errors.Is(err, context.Canceled) {
 				return nil
 			}
-			log.Printf("ERROR: %s: %s\n", p, err)
+			log.Printf("ERROR: %s: %s (%s failure)\n", p, err, state.Classify(err))
 			continue
 		}
 		log.Printf("DEBUG: end pkg %s (%d/%d)\n", p, i+1, len(pkgs))
@@ -84,69 +116,152 @@ func processPackage(
 	opts RepoOptions,
 	chans *JobChannels,
 ) error {
-	btfTarName := fmt.Sprintf("%s.btf.tar.xz", p.BTFFilename())
-	btfTarPath := filepath.Join(workDir, btfTarName)
-	if pkg.PackageKernelHasBTF(p, workDir) {
+	btfTarName := pkg.BTFArchiveName(p, opts.formats()[0])
+
+	action, reason, err := planPackage(ctx, p, workDir, opts)
+	if err != nil {
+		return err
+	}
+	switch action {
+	case ActionSkipHasBTF:
 		return utils.ErrKernelHasBTF
+	case ActionSkipFailed, ActionSkipArchived:
+		log.Printf("SKIP: %s %s\n", btfTarName, reason)
+		return nil
 	}
-	s3key := path.Join(opts.S3Prefix, btfTarName)
 
-	fileExists := false
-	if !opts.Force {
-		if pkg.PackageFailed(p, workDir) {
-			log.Printf("SKIP: %s previously failed\n", btfTarName)
-			return nil
-		}
-		fileExists = pkg.PackageBTFExists(p, workDir)
-		if fileExists && opts.S3Bucket == "" {
-			log.Printf("SKIP: %s exists\n", btfTarName)
-			return nil
-		}
+	if opts.DryRun {
+		log.Printf("DRY-RUN: %s would %s (%s)\n", btfTarName, action, reason)
+		return nil
 	}
 
-	if opts.DryRun {
+	err = runPackage(ctx, p, workDir, action, opts, chans)
+	if err := recordOutcome(opts.State, p, err); err != nil {
+		log.Printf("ERROR: %s: %s\n", p, err)
+	}
+	return err
+}
+
+// recordOutcome records the result of processing a package in the state ledger
+func recordOutcome(st *state.Store, p pkg.Package, err error) error {
+	switch {
+	case err == nil:
+		return st.RecordSuccess(p.BTFFilename())
+	case errors.Is(err, utils.ErrKernelHasBTF):
+		return st.RecordHasBTF(p.BTFFilename())
+	case errors.Is(err, context.Canceled):
+		// interrupted runs are not failures of the package
 		return nil
+	default:
+		return st.RecordFailure(p.BTFFilename(), err)
+	}
+}
+
+// runPackage generates, uploads and hashes the BTF of a package, as decided by action
+func runPackage(
+	ctx context.Context,
+	p pkg.Package,
+	workDir string,
+	action Action,
+	opts RepoOptions,
+	chans *JobChannels,
+) error {
+	btfTarName := pkg.BTFArchiveName(p, opts.formats()[0])
+	btfTarPath := filepath.Join(workDir, btfTarName)
+	ptrPath := filepath.Join(workDir, pkg.BTFPointerName(p))
+	// blobs are shared with other kernel versions, so only the pointer is
+	// removed on failure
+	removeArchive := func() {
+		for _, f := range opts.formats() {
+			os.Remove(filepath.Join(workDir, pkg.BTFArchiveName(p, f)))
+		}
+		os.Remove(ptrPath)
 	}
 
-	if !fileExists {
+	entry := catalog.BTFEntry{Key: path.Join(opts.StorePrefix, btfTarName), Format: opts.entryFormat()}
+	blob := false
+	if action == ActionGenerate {
 		// if there is no BTF file, generate it
-		err := generateBTFFile(ctx, p, workDir, opts, chans, btfTarPath)
+		var err error
+		entry, err = generateBTFFile(ctx, p, opts, chans, workDir)
+		if err != nil {
+			return err
+		}
+		if opts.ContentAddressed {
+			blob = true
+			if err := catalog.WriteEntry(ptrPath, entry); err != nil {
+				return fmt.Errorf("write pointer file: %w", err)
+			}
+		}
+	} else if !utils.Exists(btfTarPath) {
+		ptr, ok, err := readPointer(p, workDir)
+		if err != nil {
+			return err
+		}
+		if ok {
+			entry, blob = ptr, true
+		}
+		if ok && action == ActionConvert {
+			if entry, err = convertBlobs(ctx, p, chans, entry, opts); err != nil {
+				return state.WithStage(state.StageCompress, err)
+			}
+			if err := catalog.WriteEntry(ptrPath, entry); err != nil {
+				return fmt.Errorf("write pointer file: %w", err)
+			}
+		}
+	} else {
+		if action == ActionConvert {
+			for _, f := range missingFormats(p, workDir, catalog.BTFEntry{}, false, opts) {
+				out := filepath.Join(workDir, pkg.BTFArchiveName(p, pkg.ArchiveFormat(f)))
+				if err := convertArchive(btfTarPath, opts.formats()[0], func(btfDir string) error {
+					return compressArchive(ctx, chans, btfDir, out, pkg.ArchiveFormat(f))
+				}); err != nil {
+					return state.WithStage(state.StageCompress, err)
+				}
+			}
+		}
+		variants, err := archiveVariants(p, workDir, opts)
 		if err != nil {
 			return err
 		}
+		entry.Variants = variants
 	}
 
-	if opts.S3Bucket != "" {
-		var err error
-		s3exists := false
-		if fileExists {
-			// if the BTF file exists, check if it exists in S3, if not upload
-			s3exists, err = utils.S3Exists(ctx, opts.S3Bucket, s3key)
-			if err != nil {
-				return err
-			}
+	// archivePath returns the path of an archive of the entry
+	archivePath := func(archive catalog.BTFVariant) string {
+		if blob {
+			return opts.blobPath(archive.Key)
 		}
+		return filepath.Join(workDir, pkg.BTFArchiveName(p, pkg.ArchiveFormat(archive.Format)))
+	}
 
-		if !s3exists {
-			uploadJob := &job.S3UploadJob{
-				SourcePath: btfTarPath,
-				Bucket:     opts.S3Bucket,
-				Key:        s3key,
+	if opts.Store != nil && action != ActionHash {
+		for _, archive := range entry.Archives() {
+			uploadJob := &job.UploadJob{
+				SourcePath: archivePath(archive),
+				Store:      opts.Store,
+				Key:        archive.Key,
 				ReplyChan:  make(chan any),
+				Distro:     opts.Distro,
+				Version:    p.BTFFilename(),
+				// blobs are immutable, and usually uploaded for another version,
+				// and converted packages only miss their new archives
+				SkipExisting: blob || action == ActionConvert,
 			}
 			if err := job.SubmitAndWait(ctx, uploadJob, chans.BTF); err != nil {
 				// remove source file, so we don't end up out of sync with generation and upload
-				os.Remove(btfTarPath)
-				return err
+				removeArchive()
+				return state.WithStage(state.StageUpload, err)
 			}
 		}
 	}
 
 	if opts.HashDir != "" {
 		hashJob := &job.HashJob{
-			SourcePath: btfTarPath,
+			SourcePath: archivePath(entry.Archives()[0]),
 			DestPath:   filepath.Join(opts.HashDir, p.BTFFilename()),
 			ReplyChan:  make(chan any),
+			Entry:      entry,
 			Catalog:    opts.Catalog,
 			Arch:       opts.Arch,
 			Distro:     opts.Distro,
@@ -155,26 +270,118 @@ func processPackage(
 		}
 		if err := job.SubmitAndWait(ctx, hashJob, chans.BTF); err != nil {
 			// remove source file, so we don't end up out of sync with generation, upload, and hash
-			os.Remove(btfTarPath)
-			return err
+			removeArchive()
+			return state.WithStage(state.StageHash, err)
 		}
 	}
 
 	return nil
 }
 
-func generateBTFFile(ctx context.Context, p pkg.Package, workDir string, opts RepoOptions, chans *JobChannels, btfTarPath string) error {
+// archiveVariants returns the archived variants of a package, in the formats
+// other than the one of the catalog entry
+func archiveVariants(p pkg.Package, workDir string, opts RepoOptions) ([]catalog.BTFVariant, error) {
+	var variants []catalog.BTFVariant
+	for _, f := range opts.formats()[1:] {
+		name := pkg.BTFArchiveName(p, f)
+		archive, err := hashArchive(filepath.Join(workDir, name), f, path.Join(opts.StorePrefix, name))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		variants = append(variants, archive)
+	}
+	return variants, nil
+}
+
+// hashArchive returns the hash and size of an archive
+func hashArchive(archivePath string, format pkg.ArchiveFormat, key string) (catalog.BTFVariant, error) {
+	info, err := os.Stat(archivePath)
+	if err != nil {
+		return catalog.BTFVariant{}, err
+	}
+	hash, err := utils.SHA256File(archivePath)
+	if err != nil {
+		return catalog.BTFVariant{}, fmt.Errorf("sha256 hash: %w", err)
+	}
+	return catalog.BTFVariant{Format: string(format), SHA256: hash, Size: info.Size(), Key: key}, nil
+}
+
+// generateBTFFile generates the BTF archives of a package in workDir, or its
+// blobs in the content-addressed layout, and returns its catalog entry
+func generateBTFFile(ctx context.Context, p pkg.Package, opts RepoOptions, chans *JobChannels, workDir string) (catalog.BTFEntry, error) {
 	tmpDir, err := os.MkdirTemp("", fmt.Sprintf("btfhub-%s-*", p.BTFFilename()))
 	if err != nil {
-		return fmt.Errorf("create temp dir for package: %w", err)
+		return catalog.BTFEntry{}, fmt.Errorf("create temp dir for package: %w", err)
 	}
 	defer os.RemoveAll(tmpDir)
 
+	b, err := buildBTF(ctx, p, opts, chans, tmpDir)
+	if err != nil {
+		return catalog.BTFEntry{}, err
+	}
+	entry, err := newEntry(p, b, opts)
+	if err != nil {
+		return catalog.BTFEntry{}, err
+	}
+	btfHash, btfMergeDir, btfPath := entry.BTFSHA256, b.mergeDir, b.path
+
+	if opts.ContentAddressed {
+		// the archive must not depend on the kernel version to be shared
+		if err := os.Rename(btfPath, filepath.Join(btfMergeDir, btfHash+".btf")); err != nil {
+			return catalog.BTFEntry{}, fmt.Errorf("rename: %s", err)
+		}
+	}
+	for _, f := range opts.formats() {
+		name := pkg.BTFArchiveName(p, f)
+		key := path.Join(opts.StorePrefix, name)
+		archivePath := filepath.Join(workDir, name)
+		if opts.ContentAddressed {
+			key = catalog.BlobKey(btfHash, string(f))
+			archivePath = opts.blobPath(key)
+			err = compressBlob(ctx, p, chans, btfMergeDir, archivePath, f)
+		} else {
+			err = compressArchive(ctx, chans, btfMergeDir, archivePath, f)
+		}
+		if err != nil {
+			return catalog.BTFEntry{}, state.WithStage(state.StageCompress, err)
+		}
+		// archives are hashed once here, so HashJob does not hash them again
+		archive, err := hashArchive(archivePath, f, key)
+		if err != nil {
+			return catalog.BTFEntry{}, err
+		}
+		entry.SetArchive(archive)
+	}
+	return entry, nil
+}
+
+// builtBTF is the BTF of a kernel package, with the BTF of the stages which
+// generated it
+type builtBTF struct {
+	// genDir has the BTF generated by pahole, in vmlinux and a file per
+	// kernel module
+	genDir string
+	// vmlinux is the BTF of vmlinux, which is path if there are no modules
+	vmlinux string
+	modules int
+	// mergeDir only has path, which is the BTF to archive
+	mergeDir string
+	path     string
+}
+
+// buildBTF extracts the kernel package, generates the BTF of vmlinux and of
+// the kernel modules, merges and validates it, in dir
+func buildBTF(ctx context.Context, p pkg.Package, opts RepoOptions, chans *JobChannels, dir string) (builtBTF, error) {
 	// 1st job: Extract kernel vmlinux and module .ko.debug files
-	exDir := filepath.Join(tmpDir, "extract")
+	exDir := filepath.Join(dir, "extract")
 	if err := os.Mkdir(exDir, 0777); err != nil {
-		return err
+		return builtBTF{}, err
 	}
+	// the kernel debug files are large, and only needed by pahole
+	defer os.RemoveAll(exDir)
 	kernelExtJob := &job.KernelExtractionJob{
 		Pkg:           p,
 		WorkDir:       exDir,
@@ -184,16 +391,13 @@ func generateBTFFile(ctx context.Context, p pkg.Package, workDir string, opts Re
 	}
 	extractReply, err := job.SubmitAndWaitT[job.KernelExtractReply](ctx, kernelExtJob, chans.Default)
 	if err != nil {
-		if errors.Is(err, utils.ErrKernelHasBTF) {
-			_ = pkg.MarkPackageHasBTF(p, workDir)
-		}
-		return err
+		return builtBTF{}, state.WithStage(state.StageExtract, err)
 	}
 
 	// from this point on, we just want to kick the jobs off and proceed with other packages
-	btfGenDir := filepath.Join(tmpDir, "btfgen")
+	btfGenDir := filepath.Join(dir, "btfgen")
 	if err := os.Mkdir(btfGenDir, 0777); err != nil {
-		return err
+		return builtBTF{}, err
 	}
 
 	// submit vmlinux BTF gen first, and then kernel modules afterwards
@@ -204,7 +408,7 @@ func generateBTFFile(ctx context.Context, p pkg.Package, workDir string, opts Re
 		ReplyChan:     make(chan any),
 	}
 	if err := job.SubmitAndWait(ctx, btfGenJob, chans.BTF); err != nil {
-		return err
+		return builtBTF{}, state.WithStage(state.StageGenerate, err)
 	}
 
 	g := new(errgroup.Group)
@@ -218,7 +422,7 @@ func generateBTFFile(ctx context.Context, p pkg.Package, workDir string, opts Re
 			ReplyChan:     make(chan any),
 		}
 		if err := job.Submit(ctx, btfGenJob, chans.BTF); err != nil {
-			return err
+			return builtBTF{}, err
 		}
 		g.Go(func() error {
 			return job.Wait(btfGenJob)
@@ -229,37 +433,146 @@ func generateBTFFile(ctx context.Context, p pkg.Package, workDir string, opts Re
 		if !errors.Is(err, context.Canceled) {
 			log.Printf("ERROR: %s", err)
 		}
-		return err
+		return builtBTF{}, state.WithStage(state.StageGenerate, err)
 	}
 
-	btfMergeDir := filepath.Join(tmpDir, "btfmerge")
+	btfMergeDir := filepath.Join(dir, "btfmerge")
 	if err := os.Mkdir(btfMergeDir, 0777); err != nil {
-		return err
+		return builtBTF{}, err
 	}
 	btfPath := filepath.Join(btfMergeDir, fmt.Sprintf("%s.btf", p.BTFFilename()))
+	validateJob := &job.BTFValidationJob{
+		BTFPath:   btfPath,
+		ReplyChan: make(chan any),
+	}
 	if len(extractReply.Paths) > 0 {
 		mergeJob := &job.BTFMergeJob{
 			SourceDir: btfGenDir,
 			BTFPath:   btfPath,
+			Merger:    opts.Merger,
 			ReplyChan: make(chan any),
 		}
 		if err := job.SubmitAndWait(ctx, mergeJob, chans.BTF); err != nil {
-			return err
+			return builtBTF{}, state.WithStage(state.StageMerge, err)
 		}
+		validateJob.ModuleDir = btfGenDir
 	} else {
 		if err := os.Rename(vmlinuxBTF, btfPath); err != nil {
-			return fmt.Errorf("rename: %s", err)
+			return builtBTF{}, fmt.Errorf("rename: %s", err)
 		}
+		vmlinuxBTF = btfPath
 	}
 
+	// do not publish truncated or broken BTF
+	if err := job.SubmitAndWait(ctx, validateJob, chans.BTF); err != nil {
+		return builtBTF{}, state.WithStage(state.StageValidate, err)
+	}
+	return builtBTF{
+		genDir:   btfGenDir,
+		vmlinux:  vmlinuxBTF,
+		modules:  len(extractReply.Paths),
+		mergeDir: btfMergeDir,
+		path:     btfPath,
+	}, nil
+}
+
+// newEntry returns the catalog entry of a built BTF, without its archives
+func newEntry(p pkg.Package, b builtBTF, opts RepoOptions) (catalog.BTFEntry, error) {
+	info, err := os.Stat(b.path)
+	if err != nil {
+		return catalog.BTFEntry{}, err
+	}
+	btfHash, err := utils.SHA256File(b.path)
+	if err != nil {
+		return catalog.BTFEntry{}, fmt.Errorf("sha256 hash: %w", err)
+	}
+	pahole, err := job.PaholeVersion()
+	if err != nil {
+		log.Printf("WARN: pahole version: %s\n", err)
+	}
+	var merger string
+	if b.modules > 0 {
+		merger, err = job.MergerVersion(opts.Merger)
+		if err != nil {
+			log.Printf("WARN: merger version: %s\n", err)
+		}
+	}
+	return catalog.BTFEntry{
+		UncompressedSize: info.Size(),
+		BTFSHA256:        btfHash,
+		GeneratedAt:      time.Now().UTC().Truncate(time.Second),
+		SourcePackage:    p.Info().Name,
+		SourceURL:        p.Info().URL,
+		PaholeVersion:    pahole,
+		Merger:           merger,
+		HasModules:       b.modules > 0,
+		Format:           opts.entryFormat(),
+	}, nil
+}
+
+// compressArchive compresses the BTF in btfDir into an archive in a format
+func compressArchive(ctx context.Context, chans *JobChannels, btfDir, archivePath string, format pkg.ArchiveFormat) error {
 	compressJob := &job.BTFCompressionJob{
-		SourceDir:  btfMergeDir,
-		BTFTarPath: btfTarPath,
+		SourceDir:  btfDir,
+		BTFTarPath: archivePath,
+		Format:     format,
 		ReplyChan:  make(chan any),
 	}
-	if err := job.SubmitAndWait(ctx, compressJob, chans.BTF); err != nil {
-		return err
+	return job.SubmitAndWait(ctx, compressJob, chans.BTF)
+}
+
+// convertArchive extracts the BTF of an archive to a temporary directory, and
+// compresses it in another format with compress
+func convertArchive(src string, srcFormat pkg.ArchiveFormat, compress func(btfDir string) error) error {
+	tmpDir, err := os.MkdirTemp("", "btfhub-convert-*")
+	if err != nil {
+		return fmt.Errorf("create temp dir: %w", err)
 	}
+	defer os.RemoveAll(tmpDir)
+	if _, err := pkg.ArchiveFiles(src, srcFormat, tmpDir); err != nil {
+		return fmt.Errorf("extract %s: %w", src, err)
+	}
+	return compress(tmpDir)
+}
 
-	return nil
+// convertBlobs adds the blobs of a pointer in the formats it is missing, from
+// the blob of its archive, and returns the pointer with their archives
+func convertBlobs(ctx context.Context, p pkg.Package, chans *JobChannels, ptr catalog.BTFEntry, opts RepoOptions) (catalog.BTFEntry, error) {
+	src := opts.blobPath(ptr.Key)
+	for _, f := range missingFormats(p, "", ptr, true, opts) {
+		key := catalog.BlobKey(ptr.BTFSHA256, f)
+		blobPath := opts.blobPath(key)
+		err := convertArchive(src, pkg.ArchiveFormat(ptr.ArchiveFormat()), func(btfDir string) error {
+			return compressBlob(ctx, p, chans, btfDir, blobPath, pkg.ArchiveFormat(f))
+		})
+		if err != nil {
+			return ptr, err
+		}
+		archive, err := hashArchive(blobPath, pkg.ArchiveFormat(f), key)
+		if err != nil {
+			return ptr, err
+		}
+		ptr.SetArchive(archive)
+	}
+	return ptr, nil
+}
+
+// compressBlob compresses the BTF in btfDir into its blob, unless it was
+// already created for another kernel version
+func compressBlob(ctx context.Context, p pkg.Package, chans *JobChannels, btfDir, blobPath string, format pkg.ArchiveFormat) error {
+	if utils.Exists(blobPath) {
+		log.Printf("DEBUG: %s has the same BTF as %s\n", p, blobPath)
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(blobPath), 0775); err != nil {
+		return err
+	}
+	// packages with the same BTF may be compressed concurrently, so each one
+	// is compressed to its own file and renamed
+	tmpPath := blobPath + "." + p.BTFFilename() + ".tmp"
+	defer os.Remove(tmpPath)
+	if err := compressArchive(ctx, chans, btfDir, tmpPath, format); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, blobPath)
 }
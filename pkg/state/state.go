@@ -0,0 +1,282 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DataDog/btfhub/pkg/utils"
+)
+
+// Filename is the name of the state ledger in each archive directory
+const Filename = "state.json"
+
+// Status is the outcome of the last attempt to process a package
+type Status string
+
+const (
+	// StatusSuccess means the BTF was generated, uploaded and hashed
+	StatusSuccess Status = "success"
+	// StatusFailed means processing failed in one of the stages
+	StatusFailed Status = "failed"
+	// StatusHasBTF means the kernel has embedded BTF, so none is generated
+	StatusHasBTF Status = "hasbtf"
+)
+
+// Stage is a step of package processing
+type Stage string
+
+const (
+	StageDownload Stage = "download"
+	StageExtract  Stage = "extract"
+	StageGenerate Stage = "generate"
+	StageMerge    Stage = "merge"
+	StageValidate Stage = "validate"
+	StageCompress Stage = "compress"
+	StageUpload   Stage = "upload"
+	StageHash     Stage = "hash"
+)
+
+// FailureClass groups failures which share a retry policy
+type FailureClass string
+
+const (
+	// ClassDownload is a, usually transient, failure to download the package
+	ClassDownload FailureClass = "download"
+	// ClassNoVmlinux means the package does not contain a vmlinux file
+	ClassNoVmlinux FailureClass = "no_vmlinux"
+	// ClassPahole is a failure to generate BTF with pahole
+	ClassPahole FailureClass = "pahole"
+	// ClassMerge is a failure to merge the kernel and module BTF
+	ClassMerge FailureClass = "merge"
+	// ClassOther is any other failure
+	ClassOther FailureClass = "other"
+)
+
+// Classify returns the failure class of err
+func Classify(err error) FailureClass {
+	if errors.Is(err, utils.ErrVmlinuxNotFound) {
+		return ClassNoVmlinux
+	}
+	switch StageOf(err) {
+	case StageDownload:
+		return ClassDownload
+	case StageGenerate:
+		return ClassPahole
+	case StageMerge:
+		return ClassMerge
+	}
+	return ClassOther
+}
+
+// Record is the processing state of a single package
+type Record struct {
+	Status Status `json:"status"`
+	// Stage, Class and Error are only set for failed packages
+	Stage        Stage        `json:"stage,omitempty"`
+	Class        FailureClass `json:"class,omitempty"`
+	Error        string       `json:"error,omitempty"`
+	Attempts     int          `json:"attempts"`
+	FirstAttempt time.Time    `json:"first_attempt"`
+	LastAttempt  time.Time    `json:"last_attempt"`
+}
+
+// Store is the state ledger of the packages in one archive directory, keyed
+// by the package BTF filename. It is safe for concurrent use, and every
+// update is written to disk.
+type Store struct {
+	path    string
+	mu      sync.Mutex
+	records map[string]*Record
+	now     func() time.Time
+}
+
+// Open reads the state ledger in dir. A missing ledger is not an error.
+// Legacy .failed and .hasbtf marker files are imported for packages without
+// a record.
+func Open(dir string) (*Store, error) {
+	s := &Store{
+		path:    filepath.Join(dir, Filename),
+		records: map[string]*Record{},
+		now:     func() time.Time { return time.Now().UTC() },
+	}
+	data, err := os.ReadFile(s.path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("read state: %s", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &s.records); err != nil {
+			return nil, fmt.Errorf("unmarshal state %s: %s", s.path, err)
+		}
+	}
+	if err := s.importMarkers(dir); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Store) importMarkers(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("read dir: %s", err)
+	}
+	markers := map[string]Status{".failed": StatusFailed, ".hasbtf": StatusHasBTF}
+	for _, e := range entries {
+		ext := filepath.Ext(e.Name())
+		status, ok := markers[ext]
+		if !ok || e.IsDir() {
+			continue
+		}
+		name := strings.TrimSuffix(e.Name(), ext)
+		if _, ok := s.records[name]; ok {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			return fmt.Errorf("stat marker: %s", err)
+		}
+		rec := &Record{
+			Status:       status,
+			Attempts:     1,
+			FirstAttempt: info.ModTime().UTC(),
+			LastAttempt:  info.ModTime().UTC(),
+		}
+		if status == StatusFailed {
+			rec.Class = ClassOther
+			rec.Error = "imported from marker file"
+		}
+		s.records[name] = rec
+	}
+	return nil
+}
+
+// Get returns the record for a package
+func (s *Store) Get(name string) (Record, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.records[name]
+	if !ok {
+		return Record{}, false
+	}
+	return *rec, true
+}
+
+// Names returns the sorted names of all packages with a record
+func (s *Store) Names() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Sorted(maps.Keys(s.records))
+}
+
+// RecordSuccess records that a package was processed successfully
+func (s *Store) RecordSuccess(name string) error {
+	return s.record(name, StatusSuccess, "", nil)
+}
+
+// RecordHasBTF records that a package kernel has embedded BTF
+func (s *Store) RecordHasBTF(name string) error {
+	return s.record(name, StatusHasBTF, "", nil)
+}
+
+// RecordFailure records that processing a package failed. The stage is
+// taken from err, if it is a StageError.
+func (s *Store) RecordFailure(name string, err error) error {
+	return s.record(name, StatusFailed, StageOf(err), err)
+}
+
+func (s *Store) record(name string, status Status, stage Stage, err error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	rec, ok := s.records[name]
+	if !ok {
+		rec = &Record{FirstAttempt: now}
+		s.records[name] = rec
+	}
+	rec.Status = status
+	rec.Stage = stage
+	rec.Class = ""
+	rec.Error = ""
+	if err != nil {
+		rec.Class = Classify(err)
+		rec.Error = err.Error()
+	}
+	rec.Attempts++
+	rec.LastAttempt = now
+	return s.save()
+}
+
+// save writes the ledger atomically, so an interrupted run never leaves a
+// truncated file behind. Must be called with the lock held.
+func (s *Store) save() error {
+	data, err := json.MarshalIndent(s.records, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal state: %s", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), Filename+".*")
+	if err != nil {
+		return fmt.Errorf("create state: %s", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write state: %s", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close state: %s", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("chmod state: %s", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("rename state: %s", err)
+	}
+	return nil
+}
+
+// StageError is an error which occurred in a specific processing stage
+type StageError struct {
+	Stage Stage
+	Err   error
+}
+
+func (e *StageError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Stage, e.Err)
+}
+
+func (e *StageError) Unwrap() error {
+	return e.Err
+}
+
+// WithStage annotates err with the stage it occurred in. Errors which are
+// already annotated keep their original stage.
+func WithStage(stage Stage, err error) error {
+	if err == nil {
+		return nil
+	}
+	var serr *StageError
+	if errors.As(err, &serr) {
+		return err
+	}
+	return &StageError{Stage: stage, Err: err}
+}
+
+// StageOf returns the stage err occurred in, or an empty stage if unknown
+func StageOf(err error) Stage {
+	var serr *StageError
+	if errors.As(err, &serr) {
+		return serr.Stage
+	}
+	return ""
+}
@@ -0,0 +1,85 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/DataDog/btfhub/pkg/utils"
+)
+
+func TestStore(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "5.0.1.failed"), nil, 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "5.0.2.hasbtf"), nil, 0644))
+
+	s, err := Open(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"5.0.1", "5.0.2"}, s.Names())
+	rec, ok := s.Get("5.0.1")
+	require.True(t, ok)
+	assert.Equal(t, StatusFailed, rec.Status)
+	rec, ok = s.Get("5.0.2")
+	require.True(t, ok)
+	assert.Equal(t, StatusHasBTF, rec.Status)
+
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	err = fmt.Errorf("btf gen: %w", errors.New("pahole crashed"))
+	require.NoError(t, s.RecordFailure("5.0.3", WithStage(StageGenerate, err)))
+	now = now.Add(time.Hour)
+	require.NoError(t, s.RecordFailure("5.0.3", WithStage(StageMerge, WithStage(StageDownload, errors.New("timeout")))))
+	require.NoError(t, s.RecordSuccess("5.0.1"))
+
+	// reopen, to read back from disk
+	s, err = Open(dir)
+	require.NoError(t, err)
+	rec, ok = s.Get("5.0.3")
+	require.True(t, ok)
+	assert.Equal(t, Record{
+		Status:       StatusFailed,
+		Stage:        StageDownload,
+		Class:        ClassDownload,
+		Error:        "download: timeout",
+		Attempts:     2,
+		FirstAttempt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		LastAttempt:  time.Date(2024, 1, 2, 4, 4, 5, 0, time.UTC),
+	}, rec)
+
+	// records take precedence over marker files
+	rec, ok = s.Get("5.0.1")
+	require.True(t, ok)
+	assert.Equal(t, StatusSuccess, rec.Status)
+	assert.Equal(t, 2, rec.Attempts)
+	assert.Empty(t, rec.Error)
+
+	_, ok = s.Get("5.0.4")
+	assert.False(t, ok)
+}
+
+func TestClassify(t *testing.T) {
+	tests := map[FailureClass]error{
+		ClassDownload:  WithStage(StageDownload, errors.New("connection reset")),
+		ClassNoVmlinux: WithStage(StageExtract, fmt.Errorf("extracting vmlinux: %w", utils.ErrVmlinuxNotFound)),
+		ClassPahole:    WithStage(StageGenerate, errors.New("btf gen: signal: segmentation fault")),
+		ClassMerge:     WithStage(StageMerge, errors.New("merge: exit status 1")),
+		ClassOther:     WithStage(StageUpload, errors.New("access denied")),
+	}
+	for class, err := range tests {
+		assert.Equal(t, class, Classify(err), err.Error())
+	}
+	assert.Equal(t, ClassOther, Classify(errors.New("plain")))
+}
+
+func TestStageOf(t *testing.T) {
+	assert.Equal(t, Stage(""), StageOf(errors.New("plain")))
+	assert.Equal(t, StageUpload, StageOf(fmt.Errorf("wrapped: %w", WithStage(StageUpload, errors.New("denied")))))
+	assert.Nil(t, WithStage(StageHash, nil))
+}
@@ -0,0 +1,49 @@
+package store
+
+import (
+	"fmt"
+	"slices"
+)
+
+// ACL is the access control applied to uploaded objects
+type ACL string
+
+const (
+	// ACLNone leaves the access control to the defaults of the store, for
+	// buckets where ACLs are disabled
+	ACLNone ACL = "none"
+	// ACLPrivate gives access to the owner of the object only
+	ACLPrivate ACL = "private"
+	// ACLPublicRead gives read access to everyone
+	ACLPublicRead ACL = "public-read"
+	// ACLBucketOwnerFullControl gives full control to the owner of the bucket
+	ACLBucketOwnerFullControl ACL = "bucket-owner-full-control"
+)
+
+// ACLs are the supported values of ACL
+var ACLs = []ACL{ACLNone, ACLPrivate, ACLPublicRead, ACLBucketOwnerFullControl}
+
+// ParseACL returns the ACL named s, or the zero ACL if s is empty, for the
+// default ACL of the store, see Open
+func ParseACL(s string) (ACL, error) {
+	if s != "" && !slices.Contains(ACLs, ACL(s)) {
+		return "", fmt.Errorf("invalid ACL %s, must be one of %v", s, ACLs)
+	}
+	return ACL(s), nil
+}
+
+// Object attributes, stored as metadata and/or tags of uploaded archives
+const (
+	AttrKernelVersion = "kernel-version"
+	AttrDistro        = "distro"
+	AttrSHA256        = "sha256"
+)
+
+// ArchiveAttributes returns the attributes of a BTF archive
+func ArchiveAttributes(distro, kernelVersion, sha256 string) map[string]string {
+	return map[string]string{
+		AttrDistro:        distro,
+		AttrKernelVersion: kernelVersion,
+		AttrSHA256:        sha256,
+	}
+}
@@ -0,0 +1,128 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+)
+
+// Azure is an Azure Blob Storage container
+type Azure struct {
+	client    *azblob.Client
+	container string
+	opts      Options
+}
+
+// NewAzure returns the store of an Azure Blob Storage container. The client
+// is configured from AZURE_STORAGE_CONNECTION_STRING if set, otherwise the
+// account in AZURE_STORAGE_ACCOUNT is used with AZURE_STORAGE_KEY, or the
+// default Azure credentials.
+//
+// Azure Blob has no object ACLs, access is set on the container, so the ACL
+// must be none, which is the default.
+func NewAzure(_ context.Context, container string, opts Options) (*Azure, error) {
+	if opts.acl() != ACLNone {
+		return nil, fmt.Errorf("azure does not support object ACLs, access is set on the container: use ACL %s", ACLNone)
+	}
+	if cs := os.Getenv("AZURE_STORAGE_CONNECTION_STRING"); cs != "" {
+		client, err := azblob.NewClientFromConnectionString(cs, nil)
+		if err != nil {
+			return nil, fmt.Errorf("azure client: %w", err)
+		}
+		return &Azure{client: client, container: container, opts: opts}, nil
+	}
+
+	account := os.Getenv("AZURE_STORAGE_ACCOUNT")
+	if account == "" {
+		return nil, errors.New("azure: AZURE_STORAGE_ACCOUNT is required")
+	}
+	serviceURL := fmt.Sprintf("https://%s.blob.core.windows.net/", account)
+	var client *azblob.Client
+	if key := os.Getenv("AZURE_STORAGE_KEY"); key != "" {
+		cred, err := azblob.NewSharedKeyCredential(account, key)
+		if err != nil {
+			return nil, fmt.Errorf("azure shared key: %w", err)
+		}
+		client, err = azblob.NewClientWithSharedKeyCredential(serviceURL, cred, nil)
+		if err != nil {
+			return nil, fmt.Errorf("azure client: %w", err)
+		}
+	} else {
+		cred, err := azidentity.NewDefaultAzureCredential(nil)
+		if err != nil {
+			return nil, fmt.Errorf("azure credentials: %w", err)
+		}
+		client, err = azblob.NewClient(serviceURL, cred, nil)
+		if err != nil {
+			return nil, fmt.Errorf("azure client: %w", err)
+		}
+	}
+	return &Azure{client: client, container: container, opts: opts}, nil
+}
+
+func (s *Azure) Exists(ctx context.Context, key string) (bool, error) {
+	blob := s.client.ServiceClient().NewContainerClient(s.container).NewBlobClient(key)
+	_, err := blob.GetProperties(ctx, nil)
+	if err == nil {
+		return true, nil
+	}
+	if bloberror.HasCode(err, bloberror.BlobNotFound) {
+		return false, nil
+	}
+	return false, fmt.Errorf("azure properties %s/%s: %w", s.container, key, err)
+}
+
+func (s *Azure) Upload(ctx context.Context, key string, data io.Reader, attrs map[string]string) error {
+	opts := &azblob.UploadStreamOptions{}
+	if s.opts.Metadata {
+		opts.Metadata = map[string]*string{}
+		for k, v := range attrs {
+			// metadata names must be C# identifiers
+			opts.Metadata[strings.ReplaceAll(k, "-", "_")] = &v
+		}
+	}
+	if s.opts.Tags {
+		opts.Tags = attrs
+	}
+	if _, err := s.client.UploadStream(ctx, s.container, key, data, opts); err != nil {
+		return fmt.Errorf("azure upload: %w", err)
+	}
+	return nil
+}
+
+func (s *Azure) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	p := listPrefix(prefix)
+	pager := s.client.NewListBlobsFlatPager(s.container, &azblob.ListBlobsFlatOptions{Prefix: &p})
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("azure list: %w", err)
+		}
+		for _, item := range page.Segment.BlobItems {
+			keys = append(keys, *item.Name)
+		}
+	}
+	return keys, nil
+}
+
+// ACL returns none, as access is set on the container
+func (s *Azure) ACL(context.Context, string) (ACL, error) {
+	return ACLNone, nil
+}
+
+// SetACL does nothing, as access is set on the container
+func (s *Azure) SetACL(context.Context, string) error {
+	return nil
+}
+
+func (s *Azure) URL(key string) string {
+	return fmt.Sprintf("azblob://%s/%s", s.container, key)
+}
@@ -0,0 +1,134 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// File is a local directory, for tests and air-gapped mirrors. ACLs are
+// file modes, public-read is readable by everyone and the other ACLs by the
+// owner only.
+type File struct {
+	root string
+	opts Options
+}
+
+// NewFile returns the store of a local directory, creating it if necessary.
+// Files have no metadata or tags.
+func NewFile(root string, opts Options) (*File, error) {
+	if root == "" {
+		return nil, fmt.Errorf("file store: missing path")
+	}
+	if opts.Metadata || opts.Tags {
+		return nil, errors.New("file store does not support object metadata or tags")
+	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+	return &File{root: root, opts: opts}, nil
+}
+
+func (s *File) path(key string) string {
+	return filepath.Join(s.root, filepath.FromSlash(path.Clean("/"+key)))
+}
+
+func (s *File) Exists(_ context.Context, key string) (bool, error) {
+	_, err := os.Stat(s.path(key))
+	if err == nil {
+		return true, nil
+	}
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return false, err
+}
+
+// Upload writes data to a temporary file which is renamed to key, so readers
+// never see a partial object
+func (s *File) Upload(_ context.Context, key string, data io.Reader, _ map[string]string) error {
+	dst := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(dst), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := io.Copy(f, data); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("write %s: %w", dst, err)
+	}
+	if err := f.Chmod(s.mode()); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), dst)
+}
+
+func (s *File) List(_ context.Context, prefix string) ([]string, error) {
+	var keys []string
+	dir := s.path(prefix)
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && p == dir {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(s.root, p)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (s *File) mode() os.FileMode {
+	switch s.opts.acl() {
+	case ACLPrivate, ACLBucketOwnerFullControl:
+		return 0600
+	}
+	return 0644
+}
+
+// ACL returns public-read if the file is readable by everyone, and private
+// otherwise
+func (s *File) ACL(_ context.Context, key string) (ACL, error) {
+	info, err := os.Stat(s.path(key))
+	if err != nil {
+		return "", err
+	}
+	if info.Mode().Perm()&0004 != 0 {
+		return ACLPublicRead, nil
+	}
+	return ACLPrivate, nil
+}
+
+func (s *File) SetACL(_ context.Context, key string) error {
+	if s.opts.acl() == ACLNone {
+		return nil
+	}
+	return os.Chmod(s.path(key), s.mode())
+}
+
+func (s *File) URL(key string) string {
+	return "file://" + filepath.ToSlash(s.path(key))
+}
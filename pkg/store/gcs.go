@@ -0,0 +1,119 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+)
+
+// gcsPredefinedACLs are the GCS names of the ACLs
+var gcsPredefinedACLs = map[ACL]string{
+	ACLPrivate:                "private",
+	ACLPublicRead:             "publicRead",
+	ACLBucketOwnerFullControl: "bucketOwnerFullControl",
+}
+
+// GCS is a Google Cloud Storage bucket
+type GCS struct {
+	bucket *storage.BucketHandle
+	name   string
+	opts   Options
+}
+
+// NewGCS returns the store of a Google Cloud Storage bucket, using the
+// application default credentials. GCS has no object tags, so only metadata
+// is supported.
+func NewGCS(ctx context.Context, bucket string, opts Options) (*GCS, error) {
+	if opts.Tags {
+		return nil, errors.New("gcs does not support object tags, use metadata")
+	}
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("gcs client: %w", err)
+	}
+	return &GCS{bucket: client.Bucket(bucket), name: bucket, opts: opts}, nil
+}
+
+func (s *GCS) Exists(ctx context.Context, key string) (bool, error) {
+	_, err := s.bucket.Object(key).Attrs(ctx)
+	if err == nil {
+		return true, nil
+	}
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return false, nil
+	}
+	return false, fmt.Errorf("gcs attrs %s/%s: %w", s.name, key, err)
+}
+
+func (s *GCS) Upload(ctx context.Context, key string, data io.Reader, attrs map[string]string) error {
+	w := s.bucket.Object(key).NewWriter(ctx)
+	w.PredefinedACL = gcsPredefinedACLs[s.opts.acl()]
+	if s.opts.Metadata {
+		w.Metadata = attrs
+	}
+	if _, err := io.Copy(w, data); err != nil {
+		_ = w.Close()
+		return fmt.Errorf("gcs write: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("gcs write: %w", err)
+	}
+	return nil
+}
+
+func (s *GCS) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	it := s.bucket.Objects(ctx, &storage.Query{Prefix: listPrefix(prefix)})
+	for {
+		attrs, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("gcs list: %w", err)
+		}
+		keys = append(keys, attrs.Name)
+	}
+	return keys, nil
+}
+
+// ACL returns public-read if all users can read the object,
+// bucket-owner-full-control if the project owners own it, and private
+// otherwise
+func (s *GCS) ACL(ctx context.Context, key string) (ACL, error) {
+	rules, err := s.bucket.Object(key).ACL().List(ctx)
+	if err != nil {
+		return "", fmt.Errorf("gcs get ACL: %w", err)
+	}
+	acl := ACLPrivate
+	for _, r := range rules {
+		switch {
+		case r.Entity == storage.AllUsers:
+			return ACLPublicRead, nil
+		case strings.HasPrefix(string(r.Entity), "project-owners-") && r.Role == storage.RoleOwner:
+			acl = ACLBucketOwnerFullControl
+		}
+	}
+	return acl, nil
+}
+
+func (s *GCS) SetACL(ctx context.Context, key string) error {
+	acl := s.opts.acl()
+	if acl == ACLNone {
+		return nil
+	}
+	_, err := s.bucket.Object(key).Update(ctx, storage.ObjectAttrsToUpdate{PredefinedACL: gcsPredefinedACLs[acl]})
+	if err != nil {
+		return fmt.Errorf("gcs set ACL: %w", err)
+	}
+	return nil
+}
+
+func (s *GCS) URL(key string) string {
+	return fmt.Sprintf("gs://%s/%s", s.name, key)
+}
@@ -0,0 +1,235 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// S3 is an AWS S3 bucket
+type S3 struct {
+	client *s3.Client
+	bucket string
+	opts   Options
+
+	// bucketOwner is the canonical user ID of the owner of the bucket, once
+	// it is known
+	ownerMu     sync.Mutex
+	bucketOwner string
+}
+
+// S3Options configures the S3 client, for S3 compatible stores such as MinIO
+// or Ceph. The zero value uses the default AWS configuration.
+type S3Options struct {
+	// Endpoint is the URL of the S3 API, instead of AWS
+	Endpoint string
+	// Region overrides the configured AWS region
+	Region string
+	// PathStyle puts the bucket in the path instead of the host name
+	PathStyle bool
+	// CABundle is a PEM file with the certificates to trust for TLS
+	CABundle string
+	// AccessKeyID and SecretAccessKey are static credentials, instead of the
+	// default AWS credential chain
+	AccessKeyID     string
+	SecretAccessKey string
+}
+
+// NewS3 returns the store of an S3 bucket
+func NewS3(ctx context.Context, bucket string, storeOpts Options) (*S3, error) {
+	opts := storeOpts.S3
+	var loadOpts []func(*config.LoadOptions) error
+	if opts.Region != "" {
+		loadOpts = append(loadOpts, config.WithRegion(opts.Region))
+	}
+	if opts.CABundle != "" {
+		pem, err := os.ReadFile(opts.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("s3 CA bundle: %w", err)
+		}
+		loadOpts = append(loadOpts, config.WithCustomCABundle(bytes.NewReader(pem)))
+	}
+	if opts.AccessKeyID != "" || opts.SecretAccessKey != "" {
+		if opts.AccessKeyID == "" || opts.SecretAccessKey == "" {
+			return nil, errors.New("s3 static credentials require both an access key ID and a secret access key")
+		}
+		creds := credentials.NewStaticCredentialsProvider(opts.AccessKeyID, opts.SecretAccessKey, "")
+		loadOpts = append(loadOpts, config.WithCredentialsProvider(creds))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, loadOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("aws config: %w", err)
+	}
+	if opts.Endpoint != "" && cfg.Region == "" {
+		// S3 compatible stores usually ignore the region, but it is required
+		// to sign requests
+		cfg.Region = "us-east-1"
+	}
+
+	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if opts.Endpoint != "" {
+			o.BaseEndpoint = aws.String(opts.Endpoint)
+		}
+		o.UsePathStyle = opts.PathStyle
+	})
+	return &S3{client: client, bucket: bucket, opts: storeOpts}, nil
+}
+
+func (s *S3) Exists(ctx context.Context, key string) (bool, error) {
+	_, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err == nil {
+		return true, nil
+	}
+
+	var notFoundError *types.NotFound
+	if errors.As(err, &notFoundError) {
+		return false, nil
+	}
+	return false, fmt.Errorf("s3 head %s/%s: %w", s.bucket, key, err)
+}
+
+func (s *S3) Upload(ctx context.Context, key string, data io.Reader, attrs map[string]string) error {
+	input := &s3.PutObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+		Body:   data,
+	}
+	if acl := s.opts.acl(); acl != ACLNone {
+		input.ACL = types.ObjectCannedACL(acl)
+	}
+	if s.opts.Metadata {
+		input.Metadata = attrs
+	}
+	if s.opts.Tags && len(attrs) > 0 {
+		tags := url.Values{}
+		for k, v := range attrs {
+			tags.Set(k, v)
+		}
+		input.Tagging = aws.String(tags.Encode())
+	}
+	_, err := s.client.PutObject(ctx, input)
+	if err != nil {
+		return fmt.Errorf("s3 put: %w", err)
+	}
+	// S3 has read-after-write consistency, so the object exists once the put
+	// returns, there is no need to wait for it
+	return nil
+}
+
+func (s *S3) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	page := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(listPrefix(prefix)),
+	})
+	for page.HasMorePages() {
+		out, err := page.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("s3 list: %w", err)
+		}
+		for _, obj := range out.Contents {
+			keys = append(keys, *obj.Key)
+		}
+	}
+	return keys, nil
+}
+
+// allUsersURI is the grantee of public access
+const allUsersURI = "http://acs.amazonaws.com/groups/global/AllUsers"
+
+// ACL returns public-read if everyone can read the object,
+// bucket-owner-full-control if the owner of the bucket has full control, and
+// private otherwise. The owner of the bucket has full control of the objects
+// it owns, which are both private and bucket-owner-full-control, so they are
+// reported with the ACL of the store if it is one of these.
+func (s *S3) ACL(ctx context.Context, key string) (ACL, error) {
+	out, err := s.client.GetObjectAcl(ctx, &s3.GetObjectAclInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return "", fmt.Errorf("s3 get ACL: %w", err)
+	}
+	bucketOwner, err := s.bucketOwnerID(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	var owner string
+	if out.Owner != nil {
+		owner = aws.ToString(out.Owner.ID)
+	}
+	ownerControl := false
+	for _, g := range out.Grants {
+		if g.Grantee == nil {
+			continue
+		}
+		switch {
+		case g.Grantee.Type == types.TypeGroup && aws.ToString(g.Grantee.URI) == allUsersURI &&
+			(g.Permission == types.PermissionRead || g.Permission == types.PermissionFullControl):
+			return ACLPublicRead, nil
+		case g.Grantee.Type == types.TypeCanonicalUser && aws.ToString(g.Grantee.ID) == bucketOwner &&
+			g.Permission == types.PermissionFullControl:
+			ownerControl = true
+		}
+	}
+	if owner == bucketOwner && s.opts.acl() == ACLBucketOwnerFullControl {
+		return ACLBucketOwnerFullControl, nil
+	}
+	if ownerControl && owner != bucketOwner {
+		return ACLBucketOwnerFullControl, nil
+	}
+	return ACLPrivate, nil
+}
+
+// bucketOwnerID returns the canonical user ID of the owner of the bucket
+func (s *S3) bucketOwnerID(ctx context.Context) (string, error) {
+	s.ownerMu.Lock()
+	defer s.ownerMu.Unlock()
+	if s.bucketOwner != "" {
+		return s.bucketOwner, nil
+	}
+	out, err := s.client.GetBucketAcl(ctx, &s3.GetBucketAclInput{Bucket: aws.String(s.bucket)})
+	if err != nil {
+		return "", fmt.Errorf("s3 get bucket ACL: %w", err)
+	}
+	if out.Owner == nil || aws.ToString(out.Owner.ID) == "" {
+		return "", fmt.Errorf("s3 get bucket ACL: %s has no owner", s.bucket)
+	}
+	s.bucketOwner = aws.ToString(out.Owner.ID)
+	return s.bucketOwner, nil
+}
+
+func (s *S3) SetACL(ctx context.Context, key string) error {
+	acl := s.opts.acl()
+	if acl == ACLNone {
+		return nil
+	}
+	_, err := s.client.PutObjectAcl(ctx, &s3.PutObjectAclInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+		ACL:    types.ObjectCannedACL(acl),
+	})
+	if err != nil {
+		return fmt.Errorf("s3 put ACL: %w", err)
+	}
+	return nil
+}
+
+func (s *S3) URL(key string) string {
+	return fmt.Sprintf("s3://%s/%s", s.bucket, key)
+}
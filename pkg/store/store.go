@@ -0,0 +1,175 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// ObjectStore is where BTF archives are published, such as an S3 bucket. Keys
+// are slash separated paths relative to the root of the store.
+type ObjectStore interface {
+	// Exists returns true if an object exists at key
+	Exists(ctx context.Context, key string) (bool, error)
+	// Upload writes data to key, replacing any existing object, with the ACL
+	// of the store. attrs are stored as object metadata and tags, if enabled
+	// in the Options.
+	Upload(ctx context.Context, key string, data io.Reader, attrs map[string]string) error
+	// List returns the keys of all objects under prefix
+	List(ctx context.Context, prefix string) ([]string, error)
+	// ACL returns the current ACL of an object, as the closest of ACLs
+	ACL(ctx context.Context, key string) (ACL, error)
+	// SetACL applies the ACL of the store to an existing object
+	SetACL(ctx context.Context, key string) error
+	// URL returns the URL of key, for logs
+	URL(key string) string
+}
+
+// Options configures the clients of object stores
+type Options struct {
+	// ACL is applied to uploaded objects and by SetACL. The zero value is
+	// ACLNone, and Open defaults it to the ACL of the store, see defaultACLs.
+	ACL ACL
+	// Metadata stores the attributes of uploaded objects as object metadata
+	Metadata bool
+	// Tags stores the attributes of uploaded objects as object tags
+	Tags bool
+
+	S3 S3Options
+}
+
+func (o Options) acl() ACL {
+	if o.ACL == "" {
+		return ACLNone
+	}
+	return o.ACL
+}
+
+// defaultACLs are the ACLs of the stores opened without an ACL. Published
+// archives are public in S3 and GCS, and Azure Blob has no object ACLs.
+var defaultACLs = map[string]ACL{
+	"s3": ACLPublicRead,
+	"gs": ACLPublicRead,
+}
+
+// ResolveACL returns acl, or the default ACL of the store of a URL if acl is
+// the zero value
+func ResolveACL(rawURL string, acl ACL) (ACL, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("store url: %w", err)
+	}
+	return resolveACL(u.Scheme, acl), nil
+}
+
+func resolveACL(scheme string, acl ACL) ACL {
+	if acl == "" {
+		if def, ok := defaultACLs[scheme]; ok {
+			return def
+		}
+		return ACLNone
+	}
+	return acl
+}
+
+// Open returns the object store of a URL:
+//
+//	s3://bucket/prefix
+//	gs://bucket/prefix
+//	azblob://container/prefix
+//	file:///path
+//
+// Azure Blob uses the storage account in AZURE_STORAGE_ACCOUNT.
+func Open(ctx context.Context, rawURL string, opts Options) (ObjectStore, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("store url: %w", err)
+	}
+	opts.ACL = resolveACL(u.Scheme, opts.ACL)
+
+	if u.Scheme == "file" {
+		if u.Host != "" && u.Host != "localhost" {
+			return nil, fmt.Errorf("store url %s: file URLs must not have a host", rawURL)
+		}
+		return NewFile(u.Path, opts)
+	}
+	if u.Scheme == "" {
+		return nil, fmt.Errorf("store url %s: missing scheme", rawURL)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("store url %s: missing bucket", rawURL)
+	}
+
+	var s ObjectStore
+	switch u.Scheme {
+	case "s3":
+		s, err = NewS3(ctx, u.Host, opts)
+	case "gs":
+		s, err = NewGCS(ctx, u.Host, opts)
+	case "azblob":
+		s, err = NewAzure(ctx, u.Host, opts)
+	default:
+		return nil, fmt.Errorf("store url %s: unsupported scheme %s", rawURL, u.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return WithPrefix(s, strings.Trim(u.Path, "/")), nil
+}
+
+type prefixStore struct {
+	ObjectStore
+	prefix string
+}
+
+// WithPrefix returns a store with all keys under prefix
+func WithPrefix(s ObjectStore, prefix string) ObjectStore {
+	if prefix == "" {
+		return s
+	}
+	return &prefixStore{ObjectStore: s, prefix: prefix}
+}
+
+func (s *prefixStore) Exists(ctx context.Context, key string) (bool, error) {
+	return s.ObjectStore.Exists(ctx, path.Join(s.prefix, key))
+}
+
+func (s *prefixStore) Upload(ctx context.Context, key string, data io.Reader, attrs map[string]string) error {
+	return s.ObjectStore.Upload(ctx, path.Join(s.prefix, key), data, attrs)
+}
+
+func (s *prefixStore) List(ctx context.Context, prefix string) ([]string, error) {
+	keys, err := s.ObjectStore.List(ctx, path.Join(s.prefix, prefix))
+	if err != nil {
+		return nil, err
+	}
+	for i, key := range keys {
+		keys[i] = strings.TrimPrefix(key, s.prefix+"/")
+	}
+	return keys, nil
+}
+
+func (s *prefixStore) ACL(ctx context.Context, key string) (ACL, error) {
+	return s.ObjectStore.ACL(ctx, path.Join(s.prefix, key))
+}
+
+func (s *prefixStore) SetACL(ctx context.Context, key string) error {
+	return s.ObjectStore.SetACL(ctx, path.Join(s.prefix, key))
+}
+
+func (s *prefixStore) URL(key string) string {
+	return s.ObjectStore.URL(path.Join(s.prefix, key))
+}
+
+// listPrefix returns the prefix to list the objects under a directory-like
+// prefix, so that a/b does not match a/bc
+func listPrefix(prefix string) string {
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" || prefix == "." {
+		return ""
+	}
+	return prefix + "/"
+}
@@ -0,0 +1,263 @@
+package store
+
+import (
+	"context"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	s, err := Open(ctx, "file://"+root, Options{})
+	require.NoError(t, err)
+
+	exists, err := s.Exists(ctx, "amzn/2/x86_64/k1.btf.tar.xz")
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	require.NoError(t, s.Upload(ctx, "amzn/2/x86_64/k1.btf.tar.xz", strings.NewReader("k1"), nil))
+	require.NoError(t, s.Upload(ctx, "amzn/2/x86_64/k2.btf.tar.xz", strings.NewReader("k2"), nil))
+	require.NoError(t, s.Upload(ctx, "amzn/2023/x86_64/k3.btf.tar.xz", strings.NewReader("k3"), nil))
+	exists, err = s.Exists(ctx, "amzn/2/x86_64/k1.btf.tar.xz")
+	require.NoError(t, err)
+	assert.True(t, exists)
+	data, err := os.ReadFile(filepath.Join(root, "amzn/2/x86_64/k2.btf.tar.xz"))
+	require.NoError(t, err)
+	assert.Equal(t, "k2", string(data))
+
+	keys, err := s.List(ctx, "amzn/2")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"amzn/2/x86_64/k1.btf.tar.xz", "amzn/2/x86_64/k2.btf.tar.xz"}, keys)
+	keys, err = s.List(ctx, "ubuntu")
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+
+	acl, err := s.ACL(ctx, "amzn/2/x86_64/k1.btf.tar.xz")
+	require.NoError(t, err)
+	assert.Equal(t, ACLPublicRead, acl)
+	assert.Equal(t, "file://"+root+"/amzn/2/x86_64/k1.btf.tar.xz", s.URL("amzn/2/x86_64/k1.btf.tar.xz"))
+
+	// keys cannot escape the root
+	require.NoError(t, s.Upload(ctx, "../escape", strings.NewReader("x"), nil))
+	assert.FileExists(t, filepath.Join(root, "escape"))
+}
+
+func TestFileStoreACL(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	public, err := NewFile(root, Options{ACL: ACLPublicRead})
+	require.NoError(t, err)
+	private, err := NewFile(root, Options{ACL: ACLPrivate})
+	require.NoError(t, err)
+
+	require.NoError(t, private.Upload(ctx, "k1.btf.tar.xz", strings.NewReader("k1"), nil))
+	acl, err := public.ACL(ctx, "k1.btf.tar.xz")
+	require.NoError(t, err)
+	assert.Equal(t, ACLPrivate, acl)
+	require.NoError(t, public.SetACL(ctx, "k1.btf.tar.xz"))
+	acl, err = private.ACL(ctx, "k1.btf.tar.xz")
+	require.NoError(t, err)
+	assert.Equal(t, ACLPublicRead, acl)
+
+	_, err = NewFile(root, Options{Metadata: true})
+	assert.Error(t, err)
+	_, err = ParseACL("public")
+	assert.Error(t, err)
+}
+
+func TestPrefixStore(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	f, err := NewFile(root, Options{})
+	require.NoError(t, err)
+	s := WithPrefix(f, "btfs")
+
+	require.NoError(t, s.Upload(ctx, "amzn/2/x86_64/k1.btf.tar.xz", strings.NewReader("k1"), nil))
+	assert.FileExists(t, filepath.Join(root, "btfs/amzn/2/x86_64/k1.btf.tar.xz"))
+	exists, err := s.Exists(ctx, "amzn/2/x86_64/k1.btf.tar.xz")
+	require.NoError(t, err)
+	assert.True(t, exists)
+	keys, err := s.List(ctx, "amzn")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"amzn/2/x86_64/k1.btf.tar.xz"}, keys)
+	assert.Equal(t, "file://"+root+"/btfs/amzn/2/x86_64/k1.btf.tar.xz", s.URL("amzn/2/x86_64/k1.btf.tar.xz"))
+}
+
+func TestOpenErrors(t *testing.T) {
+	ctx := context.Background()
+	for _, u := range []string{"bucket/prefix", "ftp://bucket", "file://host/path", "s3:///prefix"} {
+		_, err := Open(ctx, u, Options{})
+		assert.Error(t, err, u)
+	}
+}
+
+func TestOpenDefaultACL(t *testing.T) {
+	ctx := context.Background()
+	s, err := Open(ctx, "file://"+t.TempDir(), Options{})
+	require.NoError(t, err)
+	assert.Equal(t, ACLNone, s.(*File).opts.acl())
+
+	t.Setenv("AZURE_STORAGE_CONNECTION_STRING", "")
+	t.Setenv("AZURE_STORAGE_ACCOUNT", "btfhub")
+	t.Setenv("AZURE_STORAGE_KEY", "a2V5")
+	_, err = Open(ctx, "azblob://btfs", Options{})
+	require.NoError(t, err)
+	_, err = Open(ctx, "azblob://btfs", Options{ACL: ACLPublicRead})
+	assert.Error(t, err)
+
+	acl, err := ParseACL("")
+	require.NoError(t, err)
+	assert.Equal(t, ACL(""), acl)
+	for u, expected := range map[string]ACL{"s3://b": ACLPublicRead, "gs://b": ACLPublicRead, "azblob://c": ACLNone, "file:///tmp": ACLNone} {
+		acl, err := ResolveACL(u, "")
+		require.NoError(t, err)
+		assert.Equal(t, expected, acl, u)
+	}
+	acl, err = ResolveACL("azblob://c", ACLPrivate)
+	require.NoError(t, err)
+	assert.Equal(t, ACLPrivate, acl)
+}
+
+func TestS3Endpoint(t *testing.T) {
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		assert.Contains(t, r.Header.Get("Authorization"), "Credential=minio/")
+		switch {
+		case r.Method == http.MethodHead && r.URL.Path == "/btfhub/btfs/k1.btf.tar.xz":
+			w.WriteHeader(http.StatusOK)
+		case r.Method == http.MethodHead:
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == http.MethodPut:
+			assert.Equal(t, "public-read", r.Header.Get("X-Amz-Acl"))
+			assert.Equal(t, "abc", r.Header.Get("X-Amz-Meta-Sha256"))
+			assert.Equal(t, "distro=amzn&kernel-version=k2&sha256=abc", r.Header.Get("X-Amz-Tagging"))
+			_, _ = io.Copy(io.Discard, r.Body)
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	// public-read is the default ACL of S3
+	opts := Options{Metadata: true, Tags: true, S3: S3Options{
+		Endpoint:        srv.URL,
+		PathStyle:       true,
+		AccessKeyID:     "minio",
+		SecretAccessKey: "minio123",
+	}}
+	s, err := Open(ctx, "s3://btfhub/btfs", opts)
+	require.NoError(t, err)
+
+	exists, err := s.Exists(ctx, "k1.btf.tar.xz")
+	require.NoError(t, err)
+	assert.True(t, exists)
+	exists, err = s.Exists(ctx, "k2.btf.tar.xz")
+	require.NoError(t, err)
+	assert.False(t, exists)
+	require.NoError(t, s.Upload(ctx, "k2.btf.tar.xz", strings.NewReader("k2"), ArchiveAttributes("amzn", "k2", "abc")))
+	assert.Equal(t, []string{
+		"HEAD /btfhub/btfs/k1.btf.tar.xz",
+		"HEAD /btfhub/btfs/k2.btf.tar.xz",
+		"PUT /btfhub/btfs/k2.btf.tar.xz",
+	}, requests)
+
+	opts.S3.SecretAccessKey = ""
+	_, err = Open(ctx, "s3://btfhub", opts)
+	assert.Error(t, err)
+}
+
+func TestS3ACL(t *testing.T) {
+	const (
+		userGrant  = `<Grant><Grantee xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:type="CanonicalUser"><ID>%s</ID></Grantee><Permission>FULL_CONTROL</Permission></Grant>`
+		publicRead = `<Grant><Grantee xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:type="Group"><URI>http://acs.amazonaws.com/groups/global/AllUsers</URI></Grantee><Permission>READ</Permission></Grant>`
+	)
+	policy := func(owner string, grants ...string) string {
+		return fmt.Sprintf(`<AccessControlPolicy><Owner><ID>%s</ID></Owner><AccessControlList>%s</AccessControlList></AccessControlPolicy>`, owner, strings.Join(grants, ""))
+	}
+	var objectPolicy string
+	bucketRequests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/btfhub":
+			bucketRequests++
+			_, _ = io.WriteString(w, policy("bucket-owner", fmt.Sprintf(userGrant, "bucket-owner")))
+		case "/btfhub/k1.btf.tar.xz":
+			_, _ = io.WriteString(w, objectPolicy)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+
+	tests := map[string]struct {
+		policy        string
+		acl, expected ACL
+	}{
+		"owner only private":    {policy("bucket-owner", fmt.Sprintf(userGrant, "bucket-owner")), ACLPrivate, ACLPrivate},
+		"owner only bucket":     {policy("bucket-owner", fmt.Sprintf(userGrant, "bucket-owner")), ACLBucketOwnerFullControl, ACLBucketOwnerFullControl},
+		"owner only public":     {policy("bucket-owner", fmt.Sprintf(userGrant, "bucket-owner")), ACLPublicRead, ACLPrivate},
+		"public":                {policy("bucket-owner", fmt.Sprintf(userGrant, "bucket-owner"), publicRead), ACLPublicRead, ACLPublicRead},
+		"other uploader":        {policy("uploader", fmt.Sprintf(userGrant, "uploader"), fmt.Sprintf(userGrant, "bucket-owner")), ACLBucketOwnerFullControl, ACLBucketOwnerFullControl},
+		"other uploader only":   {policy("uploader", fmt.Sprintf(userGrant, "uploader")), ACLBucketOwnerFullControl, ACLPrivate},
+		"other grantee private": {policy("uploader", fmt.Sprintf(userGrant, "uploader"), fmt.Sprintf(userGrant, "someone")), ACLPrivate, ACLPrivate},
+	}
+	ctx := context.Background()
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			s, err := NewS3(ctx, "btfhub", Options{ACL: tc.acl, S3: S3Options{
+				Endpoint:        srv.URL,
+				PathStyle:       true,
+				AccessKeyID:     "minio",
+				SecretAccessKey: "minio123",
+			}})
+			require.NoError(t, err)
+			objectPolicy = tc.policy
+			acl, err := s.ACL(ctx, "k1.btf.tar.xz")
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, acl)
+			_, err = s.ACL(ctx, "k1.btf.tar.xz")
+			require.NoError(t, err)
+		})
+	}
+	// the owner of the bucket is requested once per store
+	assert.Equal(t, len(tests), bucketRequests)
+}
+
+func TestS3CABundle(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	require.NoError(t, os.WriteFile(bundle, cert, 0644))
+
+	ctx := context.Background()
+	opts := S3Options{Endpoint: srv.URL, PathStyle: true, AccessKeyID: "minio", SecretAccessKey: "minio123"}
+	s, err := NewS3(ctx, "btfhub", Options{S3: opts})
+	require.NoError(t, err)
+	_, err = s.Exists(ctx, "k1.btf.tar.xz")
+	assert.Error(t, err, "certificate must not be trusted without the CA bundle")
+
+	opts.CABundle = bundle
+	s, err = NewS3(ctx, "btfhub", Options{S3: opts})
+	require.NoError(t, err)
+	exists, err := s.Exists(ctx, "k1.btf.tar.xz")
+	require.NoError(t, err)
+	assert.True(t, exists)
+}
@@ -0,0 +1,105 @@
+package upload
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Entry is an object which was uploaded, or already existed, with the size and
+// modification time of the local file at that time. Store is the URL of the
+// object store.
+type Entry struct {
+	Store   string `json:"store"`
+	Key     string `json:"key"`
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"mtime"`
+}
+
+// Manifest is a local record of completed uploads, so an interrupted upload
+// can resume without checking every object again. Entries are appended to the
+// file, one JSON object per line, as soon as each upload completes.
+type Manifest struct {
+	mu      sync.Mutex
+	f       *os.File
+	entries map[string]Entry
+}
+
+// OpenManifest reads the manifest at path, creating it if it does not exist.
+// A truncated last line, from an interrupted write, is ignored.
+func OpenManifest(path string) (*Manifest, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	m := &Manifest{f: f, entries: map[string]Entry{}}
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	lines := bytes.Split(data, []byte("\n"))
+	// the last line is empty, or was truncated by an interrupted write
+	last := lines[len(lines)-1]
+	lines = lines[:len(lines)-1]
+	end := int64(len(data) - len(last))
+	for i, l := range lines {
+		var e Entry
+		if err := json.Unmarshal(l, &e); err != nil {
+			_ = f.Close()
+			return nil, fmt.Errorf("%s:%d: %w", path, i+1, err)
+		}
+		m.entries[e.Store+"/"+e.Key] = e
+	}
+	// drop a truncated last line, so new entries start on their own line
+	if err := f.Truncate(end); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(end, io.SeekStart); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return m, nil
+}
+
+// Done returns true if the object was uploaded from a file with the same size
+// and modification time
+func (m *Manifest) Done(store, key string, size int64, modTime time.Time) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.entries[store+"/"+key]
+	return ok && e.Size == size && e.ModTime == modTime.Unix()
+}
+
+// Add records a completed upload
+func (m *Manifest) Add(e Entry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, err := m.f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("write manifest: %w", err)
+	}
+	m.entries[e.Store+"/"+e.Key] = e
+	return nil
+}
+
+// Len returns the number of objects in the manifest
+func (m *Manifest) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.entries)
+}
+
+// Close closes the manifest file
+func (m *Manifest) Close() error {
+	return m.f.Close()
+}
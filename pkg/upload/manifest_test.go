@@ -0,0 +1,51 @@
+package upload
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManifest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "manifest")
+	mtime := time.Unix(1700000000, 0)
+
+	m, err := OpenManifest(path)
+	require.NoError(t, err)
+	assert.False(t, m.Done("s3://bucket", "a.btf.tar.xz", 10, mtime))
+	require.NoError(t, m.Add(Entry{Store: "s3://bucket", Key: "a.btf.tar.xz", Size: 10, ModTime: mtime.Unix()}))
+	require.NoError(t, m.Add(Entry{Store: "s3://bucket", Key: "b.btf.tar.xz", Size: 20, ModTime: mtime.Unix()}))
+	require.NoError(t, m.Close())
+
+	// simulate a write interrupted in the middle of an entry
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"store":"s3://bucket","key":"c.bt`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	m, err = OpenManifest(path)
+	require.NoError(t, err)
+	assert.Equal(t, 2, m.Len())
+	assert.True(t, m.Done("s3://bucket", "a.btf.tar.xz", 10, mtime))
+	assert.False(t, m.Done("s3://other", "a.btf.tar.xz", 10, mtime))
+	// a changed local file is uploaded again
+	assert.False(t, m.Done("s3://bucket", "a.btf.tar.xz", 11, mtime))
+	assert.False(t, m.Done("s3://bucket", "a.btf.tar.xz", 10, mtime.Add(time.Second)))
+	require.NoError(t, m.Add(Entry{Store: "s3://bucket", Key: "c.btf.tar.xz", Size: 30, ModTime: mtime.Unix()}))
+	require.NoError(t, m.Close())
+
+	m, err = OpenManifest(path)
+	require.NoError(t, err)
+	defer m.Close()
+	assert.Equal(t, 3, m.Len())
+	assert.True(t, m.Done("s3://bucket", "c.btf.tar.xz", 30, mtime))
+
+	require.NoError(t, os.WriteFile(path, []byte("not json\n"), 0644))
+	_, err = OpenManifest(path)
+	assert.Error(t, err)
+}
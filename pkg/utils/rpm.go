@@ -113,7 +113,7 @@ func ExtractVmlinuxFromRPM(ctx context.Context, rpmPath string, extractDir strin
 		}
 	}
 	if vmlinuxPath == "" {
-		return "", nil, fmt.Errorf("vmlinux file not found in rpm")
+		return "", nil, fmt.Errorf("%w in rpm", ErrVmlinuxNotFound)
 	}
 	return vmlinuxPath, paths, nil
 }
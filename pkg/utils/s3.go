@@ -1,110 +0,0 @@
-package utils
-
-import (
-	"context"
-	"errors"
-	"fmt"
-	"io"
-	"sync"
-	"time"
-
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
-	"github.com/aws/aws-sdk-go-v2/service/s3/types"
-)
-
-var S3Client = sync.OnceValues(func() (*s3.Client, error) {
-	cfg, err := config.LoadDefaultConfig(context.Background())
-	if err != nil {
-		return nil, err
-	}
-	return s3.NewFromConfig(cfg), nil
-})
-
-func S3Exists(ctx context.Context, bucket string, key string) (bool, error) {
-	client, err := S3Client()
-	if err != nil {
-		return false, err
-	}
-
-	_, err = client.HeadObject(ctx, &s3.HeadObjectInput{
-		Bucket: aws.String(bucket),
-		Key:    aws.String(key),
-	})
-	if err == nil {
-		return true, nil
-	}
-
-	var notFoundError *types.NotFound
-	if errors.As(err, &notFoundError) {
-		return false, nil
-	}
-	return false, fmt.Errorf("s3 head %s/%s: %w", bucket, key, err)
-}
-
-func S3Upload(ctx context.Context, bucket string, key string, data io.Reader) error {
-	client, err := S3Client()
-	if err != nil {
-		return err
-	}
-
-	_, err = client.PutObject(ctx, &s3.PutObjectInput{
-		Bucket: aws.String(bucket),
-		Key:    aws.String(key),
-		Body:   data,
-		ACL:    types.ObjectCannedACLPublicRead,
-	})
-	if err != nil {
-		return fmt.Errorf("s3 put: %w", err)
-	}
-
-	err = s3.NewObjectExistsWaiter(client).Wait(ctx, &s3.HeadObjectInput{
-		Bucket: aws.String(bucket),
-		Key:    aws.String(key),
-	}, time.Minute)
-	if err != nil {
-		return errors.New("timed out waiting for object to exist")
-	}
-	return nil
-}
-
-func S3List(ctx context.Context, bucket string, prefix string) ([]string, error) {
-	client, err := S3Client()
-	if err != nil {
-		return nil, err
-	}
-
-	var keys []string
-	page := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
-		Bucket: aws.String(bucket),
-		Prefix: aws.String(prefix + "/"),
-	})
-	for page.HasMorePages() {
-		out, err := page.NextPage(ctx)
-		if err != nil {
-			return nil, err
-		}
-		for _, obj := range out.Contents {
-			keys = append(keys, *obj.Key)
-		}
-	}
-	return keys, nil
-}
-
-func S3PutACL(ctx context.Context, bucket string, key string) error {
-	client, err := S3Client()
-	if err != nil {
-		return err
-	}
-
-	_, err = client.PutObjectAcl(ctx, &s3.PutObjectAclInput{
-		Bucket: aws.String(bucket),
-		Key:    aws.String(key),
-		ACL:    types.ObjectCannedACLPublicRead,
-	})
-	if err != nil {
-		return fmt.Errorf("s3 put ACL: %w", err)
-	}
-	return nil
-}
@@ -1,13 +1,34 @@
 package utils
 
 import (
+	"crypto/sha256"
 	"errors"
+	"fmt"
+	"io"
 	"os"
 )
 
 var ErrKernelHasBTF = errors.New("vmlinux has .BTF section")
 
+// ErrVmlinuxNotFound is returned when a kernel package does not contain vmlinux
+var ErrVmlinuxNotFound = errors.New("vmlinux file not found")
+
 func Exists(p string) bool {
 	_, err := os.Stat(p)
 	return err == nil
 }
+
+// SHA256File returns the hex encoded SHA256 hash of the file contents
+func SHA256File(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}